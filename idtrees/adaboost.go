@@ -0,0 +1,114 @@
+package idtrees
+
+import "math"
+
+// minBoostError is the smallest weighted error used to
+// compute a stump's vote, preventing infinite votes.
+const minBoostError = 1e-10
+
+// An AdaBoostClassifier is an ensemble of decision stumps
+// which were trained with AdaBoost to distinguish between
+// two classes.
+type AdaBoostClassifier struct {
+	// Stumps contains the depth-1 trees in the ensemble.
+	Stumps []*Tree
+
+	// Weights contains one vote weight per stump.
+	Weights []float64
+}
+
+// AdaBoost trains an AdaBoostClassifier using at most
+// the given number of rounds.
+//
+// The samples may belong to at most two classes.
+// If a round produces a stump whose weighted error is
+// 50% or worse, then boosting stops early.
+//
+// The maxGos argument is used to train each stump, and
+// works just like it does for ID3.
+func AdaBoost(samples []Sample, attrs []Attr, rounds, maxGos int) *AdaBoostClassifier {
+	classes := map[Class]bool{}
+	for _, s := range samples {
+		classes[s.Class()] = true
+	}
+	if len(classes) > 2 {
+		panic("AdaBoost requires at most two classes")
+	}
+
+	weighted := make([]Sample, len(samples))
+	boostSamples := make([]*boostSample, len(samples))
+	for i, s := range samples {
+		boostSamples[i] = &boostSample{Sample: s, weight: 1 / float64(len(samples))}
+		weighted[i] = boostSamples[i]
+	}
+
+	res := &AdaBoostClassifier{}
+	builder := &Builder{MaxGos: maxGos, MaxDepth: 1}
+	correct := make([]bool, len(samples))
+	for round := 0; round < rounds; round++ {
+		stump := builder.Build(weighted, attrs)
+
+		var err float64
+		for i, s := range boostSamples {
+			class, ok := topClass(stump.Classify(s))
+			correct[i] = ok && class == s.Class()
+			if !correct[i] {
+				err += s.weight
+			}
+		}
+		if err >= 0.5 {
+			break
+		}
+
+		vote := 0.5 * math.Log((1-err)/math.Max(err, minBoostError))
+		res.Stumps = append(res.Stumps, stump)
+		res.Weights = append(res.Weights, vote)
+		if err == 0 {
+			break
+		}
+
+		var total float64
+		for i, s := range boostSamples {
+			if correct[i] {
+				s.weight *= math.Exp(-vote)
+			} else {
+				s.weight *= math.Exp(vote)
+			}
+			total += s.weight
+		}
+		for _, s := range boostSamples {
+			s.weight /= total
+		}
+	}
+
+	return res
+}
+
+// Classify computes the weighted vote of the stumps for
+// each class.
+// The resulting values are normalized to sum to 1.
+func (a *AdaBoostClassifier) Classify(s AttrMap) map[Class]float64 {
+	res := map[Class]float64{}
+	var total float64
+	for i, stump := range a.Stumps {
+		if class, ok := topClass(stump.Classify(s)); ok {
+			res[class] += a.Weights[i]
+			total += a.Weights[i]
+		}
+	}
+	if total > 0 {
+		for class, vote := range res {
+			res[class] = vote / total
+		}
+	}
+	return res
+}
+
+type boostSample struct {
+	Sample
+	weight float64
+}
+
+func (b *boostSample) Weight() float64 {
+	return b.weight
+}
@@ -0,0 +1,36 @@
+package idtrees
+
+import "testing"
+
+func TestAdaBoost(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 30; i++ {
+		samples = append(samples, treeTestSample{"x": int64(i), "class": i >= 10 && i < 20})
+	}
+	attrs := []Attr{"x"}
+
+	stump := LimitedID3(samples, attrs, 1, 1)
+	if treeErrors(stump, samples) == 0 {
+		t.Fatal("a single stump should not fit the data")
+	}
+
+	classifier := AdaBoost(samples, attrs, 20, 1)
+	for _, s := range samples {
+		if class, _ := topClass(classifier.Classify(s)); class != s.Class() {
+			t.Errorf("sample %v misclassified", s)
+		}
+	}
+}
+
+func TestAdaBoostEarlyStop(t *testing.T) {
+	samples := []Sample{
+		treeTestSample{"a": false, "b": false, "class": false},
+		treeTestSample{"a": false, "b": true, "class": true},
+		treeTestSample{"a": true, "b": false, "class": true},
+		treeTestSample{"a": true, "b": true, "class": false},
+	}
+	classifier := AdaBoost(samples, []Attr{"a", "b"}, 10, 1)
+	if len(classifier.Stumps) != 0 {
+		t.Errorf("expected no stumps but got %d", len(classifier.Stumps))
+	}
+}
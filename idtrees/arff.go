@@ -0,0 +1,271 @@
+package idtrees
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LoadARFF reads samples from a Weka ARFF file.
+//
+// The final attribute declared in the header provides
+// each sample's class, as is the convention for ARFF
+// datasets.
+// The names of the other attributes are returned in
+// order, followed by the name of the class attribute.
+//
+// Nominal and string attributes have string values, and
+// the values of a nominal attribute must be among the
+// ones it declares.
+// A numeric attribute is int64 if every value is an
+// integer, and float64 otherwise.
+// Missing values, written as "?", become nil attributes.
+// Sparse data rows and date attributes are not supported.
+func LoadARFF(r io.Reader) ([]Sample, []string, string, error) {
+	var columns []*arffAttribute
+	var rows [][]string
+	inData := false
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "%") {
+			continue
+		}
+		if inData {
+			if strings.HasPrefix(line, "{") {
+				return nil, nil, "", fmt.Errorf("line %d: sparse data is not supported",
+					lineNum)
+			}
+			fields, err := splitARFFList(line)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("line %d: %s", lineNum, err)
+			}
+			if len(fields) != len(columns) {
+				return nil, nil, "", fmt.Errorf("line %d: expected %d values but got %d",
+					lineNum, len(columns), len(fields))
+			}
+			rows = append(rows, fields)
+			continue
+		}
+		keyword, rest := splitARFFToken(line)
+		switch strings.ToLower(keyword) {
+		case "@relation":
+		case "@attribute":
+			attr, err := parseARFFAttribute(rest)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("line %d: %s", lineNum, err)
+			}
+			columns = append(columns, attr)
+		case "@data":
+			inData = true
+		default:
+			return nil, nil, "", fmt.Errorf("line %d: unexpected declaration: %s",
+				lineNum, keyword)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, "", err
+	}
+	if !inData {
+		return nil, nil, "", errors.New("missing ARFF data section")
+	}
+	if len(columns) == 0 {
+		return nil, nil, "", errors.New("missing ARFF attributes")
+	}
+
+	names := map[string]int{}
+	var attrs []string
+	for i, col := range columns {
+		if _, ok := names[col.Name]; ok {
+			return nil, nil, "", fmt.Errorf("duplicate attribute: %s", col.Name)
+		}
+		names[col.Name] = i
+		if i < len(columns)-1 {
+			attrs = append(attrs, col.Name)
+		}
+	}
+
+	values := make([][]Val, len(rows))
+	for i := range values {
+		values[i] = make([]Val, len(columns))
+	}
+	for i, col := range columns {
+		if err := col.parseColumn(rows, values, i); err != nil {
+			return nil, nil, "", err
+		}
+	}
+
+	samples := make([]Sample, len(rows))
+	for i, row := range values {
+		samples[i] = &csvSample{
+			columns:  names,
+			values:   row,
+			classIdx: len(columns) - 1,
+		}
+	}
+	return samples, attrs, columns[len(columns)-1].Name, nil
+}
+
+type arffAttribute struct {
+	Name    string
+	Numeric bool
+
+	// Nominal is the set of declared values of a nominal
+	// attribute, or nil for other attributes.
+	Nominal map[string]bool
+}
+
+func parseARFFAttribute(decl string) (*arffAttribute, error) {
+	name, typeName := splitARFFToken(decl)
+	if name == "" {
+		return nil, errors.New("missing attribute name")
+	}
+	name, err := unquoteARFF(name)
+	if err != nil {
+		return nil, err
+	}
+	res := &arffAttribute{Name: name}
+	if strings.HasPrefix(typeName, "{") {
+		if !strings.HasSuffix(typeName, "}") {
+			return nil, fmt.Errorf("attribute %s: unterminated nominal values", name)
+		}
+		vals, err := splitARFFList(typeName[1 : len(typeName)-1])
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %s", name, err)
+		}
+		res.Nominal = map[string]bool{}
+		for _, val := range vals {
+			res.Nominal[val] = true
+		}
+		return res, nil
+	}
+	switch strings.ToLower(typeName) {
+	case "numeric", "real", "integer":
+		res.Numeric = true
+	case "string":
+	default:
+		return nil, fmt.Errorf("attribute %s: unsupported type: %s", name, typeName)
+	}
+	return res, nil
+}
+
+// parseColumn converts the strings in one column to the
+// attribute's values.
+func (a *arffAttribute) parseColumn(rows [][]string, values [][]Val, col int) error {
+	allInt := true
+	for _, row := range rows {
+		str := row[col]
+		if str == "?" {
+			continue
+		}
+		if a.Numeric {
+			if _, err := strconv.ParseInt(str, 10, 64); err != nil {
+				allInt = false
+			}
+			if _, err := strconv.ParseFloat(str, 64); err != nil {
+				return fmt.Errorf("attribute %s: invalid number: %s", a.Name, str)
+			}
+		} else if a.Nominal != nil && !a.Nominal[str] {
+			return fmt.Errorf("attribute %s: undeclared value: %s", a.Name, str)
+		}
+	}
+	for i, row := range rows {
+		str := row[col]
+		if str == "?" {
+			continue
+		}
+		if !a.Numeric {
+			values[i][col] = str
+		} else if allInt {
+			values[i][col], _ = strconv.ParseInt(str, 10, 64)
+		} else {
+			values[i][col], _ = strconv.ParseFloat(str, 64)
+		}
+	}
+	return nil
+}
+
+// splitARFFToken splits the first whitespace-separated
+// token, which may be quoted, from the rest of a line.
+func splitARFFToken(line string) (string, string) {
+	end := len(line)
+	if line != "" && (line[0] == '\'' || line[0] == '"') {
+		for i := 1; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == line[0] {
+				end = i + 1
+				break
+			}
+		}
+	} else if idx := strings.IndexAny(line, " \t"); idx >= 0 {
+		end = idx
+	}
+	return line[:end], strings.TrimSpace(line[end:])
+}
+
+// splitARFFList splits a comma-separated list of values,
+// removing the quotes around quoted values.
+// The missing value "?" is left as it is.
+func splitARFFList(list string) ([]string, error) {
+	var res []string
+	for {
+		list = strings.TrimLeft(list, " \t")
+		end := strings.IndexByte(list, ',')
+		if list != "" && (list[0] == '\'' || list[0] == '"') {
+			end = -1
+			for i := 1; i < len(list); i++ {
+				if list[i] == '\\' {
+					i++
+				} else if list[i] == list[0] {
+					end = strings.IndexByte(list[i:], ',')
+					if end >= 0 {
+						end += i
+					}
+					break
+				}
+			}
+		}
+		field := list
+		if end >= 0 {
+			field = list[:end]
+		}
+		val, err := unquoteARFF(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+		if end < 0 {
+			return res, nil
+		}
+		list = list[end+1:]
+	}
+}
+
+// unquoteARFF removes the quotes around a quoted name or
+// value and resolves its backslash escapes.
+func unquoteARFF(str string) (string, error) {
+	if str == "" || (str[0] != '\'' && str[0] != '"') {
+		return str, nil
+	}
+	quote := str[0]
+	if len(str) < 2 || str[len(str)-1] != quote {
+		return "", fmt.Errorf("unterminated quote: %s", str)
+	}
+	var res bytes.Buffer
+	for i := 1; i < len(str)-1; i++ {
+		if str[i] == '\\' && i+1 < len(str)-1 {
+			i++
+		}
+		res.WriteByte(str[i])
+	}
+	return res.String(), nil
+}
@@ -0,0 +1,90 @@
+package idtrees
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadARFF(t *testing.T) {
+	data := `% A small weather dataset.
+@RELATION weather
+
+@attribute outlook {sunny, overcast, 'light rain'}
+@attribute temperature real
+@attribute 'humidity level' integer
+@attribute windy {TRUE, FALSE}
+@attribute play {yes, no}
+
+@data
+sunny,85,85,FALSE,no
+sunny,80.5,90,TRUE,no
+overcast,83,?,FALSE,yes
+'light rain',70,96,FALSE,yes
+'light rain', 68, 80, TRUE, no
+overcast,64,65,TRUE,yes
+`
+	samples, attrs, classAttr, err := LoadARFF(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedAttrs := []string{"outlook", "temperature", "humidity level", "windy"}
+	if len(attrs) != len(expectedAttrs) {
+		t.Fatalf("expected attrs %v but got %v", expectedAttrs, attrs)
+	}
+	for i, attr := range expectedAttrs {
+		if attrs[i] != attr {
+			t.Fatalf("expected attrs %v but got %v", expectedAttrs, attrs)
+		}
+	}
+	if classAttr != "play" {
+		t.Errorf("expected class attribute play but got %s", classAttr)
+	}
+	if len(samples) != 6 {
+		t.Fatalf("expected 6 samples but got %d", len(samples))
+	}
+
+	expected := []map[string]Val{
+		{"outlook": "sunny", "temperature": 85.0, "humidity level": int64(85), "windy": "FALSE"},
+		{"outlook": "sunny", "temperature": 80.5, "humidity level": int64(90), "windy": "TRUE"},
+		{"outlook": "overcast", "temperature": 83.0, "humidity level": nil, "windy": "FALSE"},
+		{"outlook": "light rain", "temperature": 70.0, "humidity level": int64(96), "windy": "FALSE"},
+		{"outlook": "light rain", "temperature": 68.0, "humidity level": int64(80), "windy": "TRUE"},
+		{"outlook": "overcast", "temperature": 64.0, "humidity level": int64(65), "windy": "TRUE"},
+	}
+	classes := []Class{"no", "no", "yes", "yes", "no", "yes"}
+	for i, s := range samples {
+		for attr, val := range expected[i] {
+			if actual := s.Attr(attr); actual != val {
+				t.Errorf("sample %d: %s should be %#v but got %#v", i, attr, val, actual)
+			}
+		}
+		if s.Class() != classes[i] {
+			t.Errorf("sample %d: expected class %v but got %v", i, classes[i], s.Class())
+		}
+	}
+
+	var treeAttrs []Attr
+	for _, attr := range attrs {
+		treeAttrs = append(treeAttrs, attr)
+	}
+	tree := ID3(samples, treeAttrs, 0)
+	for i, s := range samples {
+		if class := tree.ClassifyOne(s); class != classes[i] {
+			t.Errorf("sample %d: classified as %v", i, class)
+		}
+	}
+
+	invalid := []string{
+		"@attribute x numeric\n@attribute y {a,b}\n",
+		"@attribute x numeric\n@attribute y {a,b}\n@data\nfoo,a\n",
+		"@attribute x numeric\n@attribute y {a,b}\n@data\n1,c\n",
+		"@attribute x numeric\n@attribute y {a,b}\n@data\n1\n",
+		"@attribute x date\n@attribute y {a,b}\n@data\n",
+		"@attribute x numeric\n@attribute y {a,b}\n@data\n{0 1, 1 a}\n",
+	}
+	for _, data := range invalid {
+		if _, _, _, err := LoadARFF(strings.NewReader(data)); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package idtrees
+
+import "math/rand"
+
+// An Ensemble is a list of trees whose classifications
+// are averaged.
+type Ensemble struct {
+	Trees []*Tree
+}
+
+// Bagging trains an Ensemble of numTrees trees with ID3,
+// where each tree is trained on a bootstrap sample of
+// the samples using all the attributes.
+//
+// Unlike BuildForest, no attribute sampling is done, so
+// this is plain bootstrap aggregating.
+// The bootstrap samples are drawn from a source seeded
+// with seed, so the result is deterministic.
+//
+// The maxGos argument is used to train each tree, and
+// works just like it does for ID3.
+func Bagging(samples []Sample, attrs []Attr, numTrees, maxGos int,
+	seed int64) *Ensemble {
+	rng := rand.New(rand.NewSource(seed))
+	res := &Ensemble{Trees: make([]*Tree, numTrees)}
+	for i := range res.Trees {
+		res.Trees[i] = ID3(Bootstrap(samples, rng), attrs, maxGos)
+	}
+	return res
+}
+
+// Classify averages the class probabilities of the
+// trees for the given sample.
+func (e *Ensemble) Classify(s AttrMap) map[Class]float64 {
+	return averageClassification(e.Trees, s)
+}
+
+// averageClassification computes the mean of the trees'
+// class probabilities for a sample.
+func averageClassification(trees []*Tree, s AttrMap) map[Class]float64 {
+	res := map[Class]float64{}
+	for _, t := range trees {
+		x := t.Classify(s)
+		for k, v := range x {
+			res[k] += v
+		}
+	}
+	scaler := 1 / float64(len(trees))
+	for k, v := range res {
+		res[k] = v * scaler
+	}
+	return res
+}
@@ -0,0 +1,45 @@
+package idtrees
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBagging(t *testing.T) {
+	rand.Seed(1337)
+	samples := forestTestSamples()[:200]
+	attrs := []Attr{0, 1, 2, 3}
+	ensemble := Bagging(samples, attrs, 5, 1, 42)
+	if len(ensemble.Trees) != 5 {
+		t.Fatalf("expected 5 trees but got %d", len(ensemble.Trees))
+	}
+	if treesEqual(ensemble.Trees[0], ensemble.Trees[1]) {
+		t.Error("trees were trained on the same samples")
+	}
+
+	for _, s := range samples[:20] {
+		expected := map[Class]float64{}
+		for _, tree := range ensemble.Trees {
+			for class, prob := range tree.Classify(s) {
+				expected[class] += prob / float64(len(ensemble.Trees))
+			}
+		}
+		actual := ensemble.Classify(s)
+		if len(actual) != len(expected) {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+		for class, prob := range expected {
+			if math.Abs(actual[class]-prob) > 1e-8 {
+				t.Fatalf("expected %v but got %v", expected, actual)
+			}
+		}
+	}
+
+	again := Bagging(samples, attrs, 5, 4, 42)
+	for i, tree := range again.Trees {
+		if !treesEqual(tree, ensemble.Trees[i]) {
+			t.Errorf("tree %d changed with the same seed", i)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package idtrees
+
+import "container/heap"
+
+// ID3BestFirst is like ID3, but it produces a tree with
+// at most maxLeaves leaves.
+//
+// Rather than growing the tree depth-first, it keeps a
+// frontier of unexpanded nodes and repeatedly expands
+// the one whose best split yields the largest decrease
+// in weighted impurity.
+// Once no more nodes can be expanded without exceeding
+// maxLeaves, the remaining frontier nodes become leaves.
+func ID3BestFirst(samples []Sample, attrs []Attr, maxGos, maxLeaves int) *Tree {
+	b := &Builder{MaxGos: maxGos, MaxLeafNodes: maxLeaves}
+	return b.Build(samples, attrs)
+}
+
+// frontierNode is an unexpanded node in a tree which is
+// being grown best-first.
+type frontierNode struct {
+	tree     *Tree
+	samples  *nodeSamples
+	attrs    []Attr
+	maxDepth int
+	split    *potentialSplit
+
+	// entropy is the impurity of the node's samples.
+	entropy float64
+
+	// gain is the decrease in impurity from the split,
+	// scaled by the total weight of the samples.
+	gain float64
+}
+
+type frontier []*frontierNode
+
+func (f frontier) Len() int {
+	return len(f)
+}
+
+func (f frontier) Less(i, j int) bool {
+	return f[i].gain > f[j].gain
+}
+
+func (f frontier) Swap(i, j int) {
+	f[i], f[j] = f[j], f[i]
+}
+
+func (f *frontier) Push(x interface{}) {
+	*f = append(*f, x.(*frontierNode))
+}
+
+func (f *frontier) Pop() interface{} {
+	old := *f
+	res := old[len(old)-1]
+	*f = old[:len(old)-1]
+	return res
+}
+
+func (b *id3Builder) bestFirst(samples *nodeSamples, attrs []Attr, maxDepth int,
+	entropy float64) *Tree {
+	root := &Tree{}
+	var nodes frontier
+	numLeaves := 1
+
+	// Nodes which cannot be split are finalized right
+	// away, so every node in the frontier has a split.
+	addNode := func(t *Tree, samples *nodeSamples, attrs []Attr, maxDepth int,
+		entropy float64) {
+		b.onNode(samples)
+		var split *potentialSplit
+		if b.canSplit(samples.Samples, maxDepth, entropy) {
+			split = b.bestSplit(samples, attrs, entropy)
+		}
+		if split == nil {
+			*t = *b.createLeaf(samples)
+			return
+		}
+		weight := b.newCounter(samples.Samples).TotalWeight()
+		heap.Push(&nodes, &frontierNode{
+			tree:     t,
+			samples:  samples,
+			attrs:    attrs,
+			maxDepth: maxDepth,
+			split:    split,
+			entropy:  entropy,
+			gain:     weight * (entropy - split.Entropy),
+		})
+	}
+
+	addNode(root, samples, attrs, maxDepth, entropy)
+	for nodes.Len() > 0 && !b.cancelled() {
+		node := heap.Pop(&nodes).(*frontierNode)
+		split := node.split
+		if numLeaves+split.numBranches()-1 > b.MaxLeafNodes {
+			*node.tree = *b.createLeaf(node.samples)
+			continue
+		}
+		numLeaves += split.numBranches() - 1
+
+		node.tree.Attr = split.Attr
+		node.tree.Gain = node.entropy - split.Entropy
+		node.tree.Weight = b.newCounter(node.samples.Samples).TotalWeight()
+		node.tree.SampleCount = len(node.samples.Samples)
+		node.tree.Surrogates = b.surrogates(node.samples, node.attrs, split)
+		if split.Thresholds != nil {
+			node.tree.NumSplit = &NumSplit{Thresholds: split.Thresholds}
+			for i, samples := range split.MultiSplitSamples {
+				child := &Tree{}
+				node.tree.NumSplit.Branches = append(node.tree.NumSplit.Branches, child)
+				addNode(child, b.partition(node.samples, samples), node.attrs,
+					node.maxDepth-1, split.MultiSplitEntropies[i])
+			}
+		} else if split.Threshold != nil {
+			node.tree.NumSplit = &NumSplit{
+				Threshold: split.Threshold,
+				Order:     split.Order,
+				LessEqual: &Tree{},
+				Greater:   &Tree{},
+			}
+			less, greater := b.partitionNumeric(node.samples, split)
+			addNode(node.tree.NumSplit.LessEqual, less, node.attrs,
+				node.maxDepth-1, split.NumSplitEntropies[0])
+			addNode(node.tree.NumSplit.Greater, greater, node.attrs,
+				node.maxDepth-1, split.NumSplitEntropies[1])
+		} else {
+			node.tree.ValSplit = ValSplit{}
+			childAttrs := b.childAttrs(node.attrs, split)
+			for _, val := range sortedSplitVals(split.ValSplitSamples) {
+				samples := split.ValSplitSamples[val]
+				child := &Tree{}
+				node.tree.ValSplit[val] = child
+				addNode(child, b.partition(node.samples, samples), childAttrs,
+					node.maxDepth-1, split.ValSplitEntropies[val])
+			}
+		}
+	}
+
+	for _, node := range nodes {
+		*node.tree = *b.createLeaf(node.samples)
+	}
+
+	// The branches of a ValSplit are only complete once
+	// every leaf has been created.
+	root.visit(func(t *Tree) {
+		if t.ValSplit != nil {
+			b.setFallback(t)
+		}
+	})
+	return root
+}
@@ -0,0 +1,42 @@
+package idtrees
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestID3BestFirst(t *testing.T) {
+	rand.Seed(1337)
+	var samples []Sample
+	for i := 0; i < 300; i++ {
+		x, y := rand.Float64(), rand.Float64()
+		class := 0
+		if x > 0.5 {
+			class++
+		}
+		if y > 0.3 {
+			class += 2
+		}
+		samples = append(samples, treeTestSample{"x": x, "y": y,
+			"color": rand.Intn(3), "class": class})
+	}
+	attrs := []Attr{"x", "y", "color"}
+
+	full := ID3(samples, attrs, 0)
+	fullLeaves := full.NumLeaves()
+	for _, maxLeaves := range []int{1, 2, 3, 5, 10} {
+		tree := ID3BestFirst(samples, attrs, 0, maxLeaves)
+		if n := tree.NumLeaves(); n > maxLeaves {
+			t.Errorf("budget %d: got %d leaves", maxLeaves, n)
+		}
+	}
+
+	if n := ID3BestFirst(samples, attrs, 0, 4).NumLeaves(); n != 4 {
+		t.Errorf("expected 4 leaves but got %d", n)
+	}
+
+	tree := ID3BestFirst(samples, attrs, 0, fullLeaves)
+	if !treesEqual(tree, full) {
+		t.Error("unlimited best-first tree differs from ID3")
+	}
+}
@@ -0,0 +1,637 @@
+package idtrees
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Node kinds of the binary encoding.
+const (
+	binaryRegressionLeaf byte = iota
+	binaryClassificationLeaf
+	binaryMultiOutputLeaf
+	binaryNumSplit
+	binaryValSplit
+	binaryMultiwaySplit
+
+	// binaryFallbackValSplit is a ValSplit with a
+	// Fallback, which is stored after the surrogates.
+	binaryFallbackValSplit
+)
+
+// Value tags of the binary encoding.
+const (
+	binaryNil byte = iota
+	binaryInt
+	binaryInt64
+	binaryFloat64
+	binaryString
+	binaryBool
+)
+
+// MarshalBinary encodes the tree in a compact binary
+// format, which is much smaller than the JSON or gob
+// encodings.
+//
+// The nodes are stored in preorder, and each attribute,
+// value, and class is tagged with its type, so, as with
+// MarshalJSON, they must be int, int64, float64, string,
+// or bool values.
+// Maps are encoded in sorted order, so equal trees have
+// equal encodings.
+func (t *Tree) MarshalBinary() ([]byte, error) {
+	var w binaryWriter
+	if err := w.writeTree(t); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a tree which was encoded with
+// MarshalBinary.
+func (t *Tree) UnmarshalBinary(data []byte) error {
+	r := &binaryReader{data: data}
+	res, err := r.readTree()
+	if err != nil {
+		return err
+	}
+	if len(r.data) != 0 {
+		return errors.New("extra data after tree")
+	}
+	*t = *res
+	return nil
+}
+
+// MarshalBinary encodes the forest's trees, using the
+// same format as Tree.MarshalBinary for each tree.
+func (f Forest) MarshalBinary() ([]byte, error) {
+	var w binaryWriter
+	if err := w.writeForest(f); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a forest which was encoded with
+// MarshalBinary.
+func (f *Forest) UnmarshalBinary(data []byte) error {
+	r := &binaryReader{data: data}
+	res, err := r.readForest()
+	if err != nil {
+		return err
+	}
+	if len(r.data) != 0 {
+		return errors.New("extra data after forest")
+	}
+	*f = res
+	return nil
+}
+
+// MarshalBinary encodes the forest like
+// Forest.MarshalBinary, followed by its out-of-bag
+// indices.
+func (f *OOBForest) MarshalBinary() ([]byte, error) {
+	var w binaryWriter
+	if err := w.writeForest(f.Forest); err != nil {
+		return nil, err
+	}
+	w.writeUvarint(uint64(len(f.OutOfBag)))
+	for _, indices := range f.OutOfBag {
+		w.writeUvarint(uint64(len(indices)))
+		for _, idx := range indices {
+			w.writeUvarint(uint64(idx))
+		}
+	}
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a forest which was encoded with
+// MarshalBinary.
+func (f *OOBForest) UnmarshalBinary(data []byte) error {
+	r := &binaryReader{data: data}
+	forest, err := r.readForest()
+	if err != nil {
+		return err
+	}
+	res := OOBForest{Forest: forest}
+	numOOB, err := r.readLength()
+	if err != nil {
+		return err
+	}
+	if numOOB > 0 {
+		res.OutOfBag = make([][]int, numOOB)
+	}
+	for i := range res.OutOfBag {
+		n, err := r.readLength()
+		if err != nil {
+			return err
+		}
+		res.OutOfBag[i] = make([]int, n)
+		for j := range res.OutOfBag[i] {
+			idx, err := r.readUvarint()
+			if err != nil {
+				return err
+			}
+			res.OutOfBag[i][j] = int(idx)
+		}
+	}
+	if len(r.data) != 0 {
+		return errors.New("extra data after forest")
+	}
+	*f = res
+	return nil
+}
+
+type binaryWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *binaryWriter) writeForest(f Forest) error {
+	w.writeUvarint(uint64(len(f)))
+	for _, t := range f {
+		if err := w.writeTree(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *binaryWriter) writeTree(t *Tree) error {
+	var kind byte
+	switch {
+	case t.NumSplit != nil && t.NumSplit.Branches != nil:
+		kind = binaryMultiwaySplit
+	case t.NumSplit != nil:
+		kind = binaryNumSplit
+	case t.ValSplit != nil && t.Fallback != nil:
+		kind = binaryFallbackValSplit
+	case t.ValSplit != nil:
+		kind = binaryValSplit
+	case t.Classification != nil:
+		kind = binaryClassificationLeaf
+	case t.Classifications != nil:
+		kind = binaryMultiOutputLeaf
+	default:
+		kind = binaryRegressionLeaf
+	}
+	w.buf.WriteByte(kind)
+	w.writeFloat(t.Weight)
+	w.writeUvarint(uint64(t.SampleCount))
+
+	switch kind {
+	case binaryRegressionLeaf:
+		w.writeFloat(t.Value)
+		return nil
+	case binaryClassificationLeaf:
+		return w.writeClassification(t.Classification)
+	case binaryMultiOutputLeaf:
+		w.writeUvarint(uint64(len(t.Classifications)))
+		for _, c := range t.Classifications {
+			if err := w.writeClassification(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := w.writeValues(t.Attr, t.MissingValue); err != nil {
+		return err
+	}
+	w.writeFloat(t.Gain)
+	w.writeUvarint(uint64(len(t.Surrogates)))
+	for i := range t.Surrogates {
+		if err := w.writeSurrogate(&t.Surrogates[i]); err != nil {
+			return err
+		}
+	}
+
+	if kind == binaryNumSplit {
+		if err := w.writeValue(t.NumSplit.Threshold); err != nil {
+			return err
+		}
+		w.writeUvarint(uint64(len(t.NumSplit.Order)))
+		if err := w.writeValues(t.NumSplit.Order...); err != nil {
+			return err
+		}
+		if err := w.writeTree(t.NumSplit.LessEqual); err != nil {
+			return err
+		}
+		return w.writeTree(t.NumSplit.Greater)
+	} else if kind == binaryMultiwaySplit {
+		w.writeUvarint(uint64(len(t.NumSplit.Thresholds)))
+		if err := w.writeValues(t.NumSplit.Thresholds...); err != nil {
+			return err
+		}
+		for _, child := range t.NumSplit.Branches {
+			if err := w.writeTree(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if kind == binaryFallbackValSplit {
+		if err := w.writeClassification(t.Fallback); err != nil {
+			return err
+		}
+	}
+	w.writeUvarint(uint64(len(t.ValSplit)))
+	for _, val := range t.SortedValSplitKeys() {
+		if err := w.writeValue(val); err != nil {
+			return err
+		}
+		if err := w.writeTree(t.ValSplit[val]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *binaryWriter) writeClassification(c map[Class]float64) error {
+	classes := make([]Val, 0, len(c))
+	for class := range c {
+		classes = append(classes, class)
+	}
+	sortVals(classes)
+	w.writeUvarint(uint64(len(classes)))
+	for _, class := range classes {
+		if err := w.writeValue(class); err != nil {
+			return err
+		}
+		w.writeFloat(c[class])
+	}
+	return nil
+}
+
+func (w *binaryWriter) writeSurrogate(s *Surrogate) error {
+	err := w.writeValues(s.Attr, s.MissingValue, s.Threshold, s.LessEqual, s.Greater)
+	if err != nil {
+		return err
+	}
+	w.writeFloat(s.Agreement)
+	vals := make([]Val, 0, len(s.Branches))
+	for val := range s.Branches {
+		vals = append(vals, val)
+	}
+	sortVals(vals)
+	w.writeUvarint(uint64(len(vals)))
+	for _, val := range vals {
+		if err := w.writeValues(val, s.Branches[val]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *binaryWriter) writeValues(vals ...Val) error {
+	for _, val := range vals {
+		if err := w.writeValue(val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *binaryWriter) writeValue(v Comparable) error {
+	switch v := v.(type) {
+	case nil:
+		w.buf.WriteByte(binaryNil)
+	case int:
+		w.buf.WriteByte(binaryInt)
+		w.writeVarint(int64(v))
+	case int64:
+		w.buf.WriteByte(binaryInt64)
+		w.writeVarint(v)
+	case float64:
+		w.buf.WriteByte(binaryFloat64)
+		w.writeFloat(v)
+	case string:
+		w.buf.WriteByte(binaryString)
+		w.writeUvarint(uint64(len(v)))
+		w.buf.WriteString(v)
+	case bool:
+		w.buf.WriteByte(binaryBool)
+		if v {
+			w.buf.WriteByte(1)
+		} else {
+			w.buf.WriteByte(0)
+		}
+	default:
+		return fmt.Errorf("cannot encode value of type %T", v)
+	}
+	return nil
+}
+
+func (w *binaryWriter) writeUvarint(x uint64) {
+	var data [binary.MaxVarintLen64]byte
+	w.buf.Write(data[:binary.PutUvarint(data[:], x)])
+}
+
+func (w *binaryWriter) writeVarint(x int64) {
+	var data [binary.MaxVarintLen64]byte
+	w.buf.Write(data[:binary.PutVarint(data[:], x)])
+}
+
+func (w *binaryWriter) writeFloat(x float64) {
+	var data [8]byte
+	binary.LittleEndian.PutUint64(data[:], math.Float64bits(x))
+	w.buf.Write(data[:])
+}
+
+var errBinaryTruncated = errors.New("truncated binary tree")
+
+type binaryReader struct {
+	data []byte
+}
+
+func (r *binaryReader) readForest() (Forest, error) {
+	numTrees, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	res := make(Forest, numTrees)
+	for i := range res {
+		if res[i], err = r.readTree(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (r *binaryReader) readTree() (*Tree, error) {
+	kind, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	res := &Tree{}
+	if res.Weight, err = r.readFloat(); err != nil {
+		return nil, err
+	}
+	count, err := r.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	res.SampleCount = int(count)
+
+	switch kind {
+	case binaryRegressionLeaf:
+		res.Value, err = r.readFloat()
+		return res, err
+	case binaryClassificationLeaf:
+		res.Classification, err = r.readClassification()
+		return res, err
+	case binaryMultiOutputLeaf:
+		n, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		res.Classifications = make([]map[Class]float64, n)
+		for i := range res.Classifications {
+			if res.Classifications[i], err = r.readClassification(); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case binaryNumSplit, binaryValSplit, binaryMultiwaySplit, binaryFallbackValSplit:
+	default:
+		return nil, fmt.Errorf("unknown node kind %d", kind)
+	}
+
+	if res.Attr, err = r.readValue(); err != nil {
+		return nil, err
+	}
+	if res.MissingValue, err = r.readValue(); err != nil {
+		return nil, err
+	}
+	if res.Gain, err = r.readFloat(); err != nil {
+		return nil, err
+	}
+	numSurrogates, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < numSurrogates; i++ {
+		surrogate, err := r.readSurrogate()
+		if err != nil {
+			return nil, err
+		}
+		res.Surrogates = append(res.Surrogates, *surrogate)
+	}
+
+	if kind == binaryNumSplit {
+		res.NumSplit = &NumSplit{}
+		if res.NumSplit.Threshold, err = r.readValue(); err != nil {
+			return nil, err
+		}
+		orderLen, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		if orderLen > 0 {
+			res.NumSplit.Order = make([]Val, orderLen)
+			for i := range res.NumSplit.Order {
+				if res.NumSplit.Order[i], err = r.readValue(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if res.NumSplit.LessEqual, err = r.readTree(); err != nil {
+			return nil, err
+		}
+		if res.NumSplit.Greater, err = r.readTree(); err != nil {
+			return nil, err
+		}
+		return res, nil
+	} else if kind == binaryMultiwaySplit {
+		numThresholds, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		if numThresholds == 0 {
+			return nil, errors.New("multi-way split has no thresholds")
+		}
+		res.NumSplit = &NumSplit{
+			Thresholds: make([]Val, numThresholds),
+			Branches:   make([]*Tree, numThresholds+1),
+		}
+		for i := range res.NumSplit.Thresholds {
+			if res.NumSplit.Thresholds[i], err = r.readValue(); err != nil {
+				return nil, err
+			}
+		}
+		for i := range res.NumSplit.Branches {
+			if res.NumSplit.Branches[i], err = r.readTree(); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+
+	if kind == binaryFallbackValSplit {
+		if res.Fallback, err = r.readClassification(); err != nil {
+			return nil, err
+		}
+	}
+	numBranches, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	res.ValSplit = ValSplit{}
+	for i := 0; i < numBranches; i++ {
+		val, err := r.readValue()
+		if err != nil {
+			return nil, err
+		}
+		if res.ValSplit[val], err = r.readTree(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (r *binaryReader) readClassification() (map[Class]float64, error) {
+	n, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[Class]float64, n)
+	for i := 0; i < n; i++ {
+		class, err := r.readValue()
+		if err != nil {
+			return nil, err
+		}
+		if res[class], err = r.readFloat(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (r *binaryReader) readSurrogate() (*Surrogate, error) {
+	var vals [5]Val
+	for i := range vals {
+		val, err := r.readValue()
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	res := &Surrogate{
+		Attr:         vals[0],
+		MissingValue: vals[1],
+		Threshold:    vals[2],
+		LessEqual:    vals[3],
+		Greater:      vals[4],
+	}
+	var err error
+	if res.Agreement, err = r.readFloat(); err != nil {
+		return nil, err
+	}
+	n, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if res.Threshold == nil {
+		res.Branches = make(map[Val]Val, n)
+	}
+	for i := 0; i < n; i++ {
+		val, err := r.readValue()
+		if err != nil {
+			return nil, err
+		}
+		branch, err := r.readValue()
+		if err != nil {
+			return nil, err
+		}
+		if res.Branches == nil {
+			return nil, errors.New("branches in numerical surrogate")
+		}
+		res.Branches[val] = branch
+	}
+	return res, nil
+}
+
+func (r *binaryReader) readValue() (Val, error) {
+	tag, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case binaryNil:
+		return nil, nil
+	case binaryInt:
+		x, err := r.readVarint()
+		return int(x), err
+	case binaryInt64:
+		return r.readVarint()
+	case binaryFloat64:
+		return r.readFloat()
+	case binaryString:
+		n, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		res := string(r.data[:n])
+		r.data = r.data[n:]
+		return res, nil
+	case binaryBool:
+		b, err := r.readByte()
+		return b != 0, err
+	default:
+		return nil, fmt.Errorf("unknown value tag %d", tag)
+	}
+}
+
+func (r *binaryReader) readByte() (byte, error) {
+	if len(r.data) == 0 {
+		return 0, errBinaryTruncated
+	}
+	res := r.data[0]
+	r.data = r.data[1:]
+	return res, nil
+}
+
+// readLength reads a length, ensuring that it is no
+// larger than the remaining data so that corrupt input
+// cannot cause huge allocations.
+func (r *binaryReader) readLength() (int, error) {
+	x, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		return 0, errBinaryTruncated
+	}
+	r.data = r.data[n:]
+	if x > uint64(len(r.data)) {
+		return 0, errBinaryTruncated
+	}
+	return int(x), nil
+}
+
+func (r *binaryReader) readUvarint() (uint64, error) {
+	x, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		return 0, errBinaryTruncated
+	}
+	r.data = r.data[n:]
+	return x, nil
+}
+
+func (r *binaryReader) readVarint() (int64, error) {
+	x, n := binary.Varint(r.data)
+	if n <= 0 {
+		return 0, errBinaryTruncated
+	}
+	r.data = r.data[n:]
+	return x, nil
+}
+
+func (r *binaryReader) readFloat() (float64, error) {
+	if len(r.data) < 8 {
+		return 0, errBinaryTruncated
+	}
+	res := math.Float64frombits(binary.LittleEndian.Uint64(r.data))
+	r.data = r.data[8:]
+	return res, nil
+}
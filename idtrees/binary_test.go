@@ -0,0 +1,97 @@
+package idtrees
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestTreeBinary(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(2000, 4)
+	for i, s := range samples {
+		s.(treeTestSample)["color"] = []string{"red", "green", "blue"}[rand.Intn(3)]
+		if i%10 == 0 {
+			s.(treeTestSample)[1] = nil
+		}
+	}
+	attrs := []Attr{0, 1, 2, 3, "color"}
+	b := &Builder{MaxSurrogates: 2}
+	tree := b.Build(samples, attrs)
+
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Tree
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !treesEqual(tree, &decoded) {
+		t.Fatal("tree changed after binary round trip")
+	}
+	for _, s := range samples {
+		expected, actual := tree.Classify(s), decoded.Classify(s)
+		if len(expected) != len(actual) {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+		// Merged classifications may differ by rounding
+		// error, since ValSplits are maps.
+		for class, prob := range expected {
+			if math.Abs(actual[class]-prob) > 1e-8 {
+				t.Fatalf("expected %v but got %v", expected, actual)
+			}
+		}
+	}
+
+	jsonData, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data)*4 > len(jsonData) {
+		t.Errorf("binary encoding has %d bytes, JSON has %d", len(data), len(jsonData))
+	}
+
+	for _, n := range []int{0, 1, len(data) / 2, len(data) - 1} {
+		if err := decoded.UnmarshalBinary(data[:n]); err == nil {
+			t.Errorf("no error for %d bytes of %d", n, len(data))
+		}
+	}
+}
+
+func TestTreeBinaryLeaves(t *testing.T) {
+	trees := []*Tree{
+		{Value: 3.5, Weight: 2},
+		{Classification: map[Class]float64{}},
+		{Classifications: []map[Class]float64{{"a": 1}, {true: 0.5, false: 0.5}}},
+		{
+			Attr: "level",
+			NumSplit: &NumSplit{
+				Threshold: "medium",
+				Order:     []Val{"low", "medium", "high"},
+				LessEqual: &Tree{Classification: map[Class]float64{int64(1): 1}},
+				Greater:   &Tree{Classification: map[Class]float64{1: 1}},
+			},
+			MissingValue: "NA",
+		},
+	}
+	for i, tree := range trees {
+		data, err := tree.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Tree
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if !treesEqual(tree, &decoded) {
+			t.Errorf("tree %d: expected %+v but got %+v", i, tree, decoded)
+		}
+	}
+
+	tree := &Tree{Classification: map[Class]float64{gobTestClass{"x"}: 1}}
+	if _, err := tree.MarshalBinary(); err == nil {
+		t.Error("expected an error for an unsupported class type")
+	}
+}
@@ -0,0 +1,124 @@
+package idtrees
+
+import (
+	"container/list"
+	"sync"
+)
+
+// A CachingClassifier wraps a Tree to remember the
+// classifications of samples which are classified over
+// and over, such as in iterative algorithms.
+//
+// Samples are identified by a key function, and the
+// classifications of the most recently used keys are
+// kept, up to a fixed capacity.
+//
+// A CachingClassifier may be used from many Goroutines
+// at once.
+type CachingClassifier struct {
+	tree     *Tree
+	key      func(s AttrMap) interface{}
+	capacity int
+
+	lock    sync.Mutex
+	entries map[interface{}]*list.Element
+	order   *list.List
+	hits    int
+	misses  int
+}
+
+type cacheEntry struct {
+	key            interface{}
+	classification map[Class]float64
+}
+
+// NewCachingClassifier creates a CachingClassifier which
+// stores at most capacity classifications.
+//
+// The key function must return the same comparable key
+// for samples which the tree classifies the same way, and
+// different keys for any other samples.
+// The capacity must be positive.
+func NewCachingClassifier(t *Tree, key func(s AttrMap) interface{},
+	capacity int) *CachingClassifier {
+	if capacity <= 0 {
+		panic("cache capacity must be positive")
+	}
+	return &CachingClassifier{
+		tree:     t,
+		key:      key,
+		capacity: capacity,
+		entries:  map[interface{}]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Classify returns the tree's classification of the
+// sample, using a cached classification if the sample's
+// key has been seen recently.
+//
+// Like Tree.Classify, this does not copy the
+// distributions, so they must not be modified.
+func (c *CachingClassifier) Classify(s AttrMap) map[Class]float64 {
+	key := c.key(s)
+
+	c.lock.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.hits++
+		c.order.MoveToFront(elem)
+		res := elem.Value.(*cacheEntry).classification
+		c.lock.Unlock()
+		return res
+	}
+	c.misses++
+	c.lock.Unlock()
+
+	// The tree is traversed without the lock, so that
+	// misses in different Goroutines do not wait on each
+	// other.
+	res := c.tree.Classify(s)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return res
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, classification: res})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	return res
+}
+
+// ClassifyOne returns the most likely class for the
+// given sample, breaking ties like Tree.ClassifyOne.
+func (c *CachingClassifier) ClassifyOne(s AttrMap) Class {
+	class, _ := topClass(c.Classify(s))
+	return class
+}
+
+// Hits returns the number of calls to Classify which
+// were served from the cache.
+func (c *CachingClassifier) Hits() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.hits
+}
+
+// Misses returns the number of calls to Classify which
+// had to traverse the tree.
+func (c *CachingClassifier) Misses() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.misses
+}
+
+// Len returns the number of cached classifications.
+func (c *CachingClassifier) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.order.Len()
+}
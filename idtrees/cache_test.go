@@ -0,0 +1,68 @@
+package idtrees
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCachingClassifier(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(200, 4)
+	attrs := []Attr{0, 1, 2, 3}
+	tree := (&Builder{MaxDepth: 5}).Build(samples, attrs)
+	key := func(s AttrMap) interface{} {
+		return fmt.Sprint(s.Attr(0), s.Attr(1), s.Attr(2), s.Attr(3))
+	}
+
+	cache := NewCachingClassifier(tree, key, len(samples))
+	for pass := 0; pass < 3; pass++ {
+		for _, s := range samples {
+			if !reflect.DeepEqual(cache.Classify(s), tree.Classify(s)) {
+				t.Fatalf("pass %d: cached classification differs for %v", pass, s)
+			}
+		}
+	}
+	if cache.Misses() != len(samples) || cache.Hits() != 2*len(samples) {
+		t.Errorf("expected %d misses and %d hits but got %d and %d", len(samples),
+			2*len(samples), cache.Misses(), cache.Hits())
+	}
+
+	// The least recently used key is evicted first.
+	cache = NewCachingClassifier(tree, key, 2)
+	for _, idx := range []int{0, 1, 0, 2, 0, 1} {
+		cache.Classify(samples[idx])
+	}
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 entries but got %d", cache.Len())
+	}
+	if cache.Hits() != 2 || cache.Misses() != 4 {
+		t.Errorf("expected 2 hits and 4 misses but got %d and %d", cache.Hits(),
+			cache.Misses())
+	}
+
+	cache = NewCachingClassifier(tree, key, 50)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s := samples[(i+j)%len(samples)]
+				if !reflect.DeepEqual(cache.Classify(s), tree.Classify(s)) {
+					t.Errorf("cached classification differs for %v", s)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if cache.Len() > 50 {
+		t.Errorf("cache has %d entries", cache.Len())
+	}
+	if cache.Hits()+cache.Misses() != 100*100 {
+		t.Errorf("expected %d lookups but got %d", 100*100, cache.Hits()+cache.Misses())
+	}
+}
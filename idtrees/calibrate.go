@@ -0,0 +1,164 @@
+package idtrees
+
+import "math"
+
+// Parameters of the Newton method used to fit Platt
+// scaling.
+const (
+	plattMaxIters   = 100
+	plattMinStep    = 1e-10
+	plattHessianEps = 1e-12
+	plattGradEps    = 1e-5
+)
+
+// A CalibratedTree wraps a Tree to calibrate the
+// probabilities it predicts.
+type CalibratedTree struct {
+	Tree *Tree
+
+	// Scalers maps each class to the scaling applied to
+	// the tree's probability for that class.
+	Scalers map[Class]PlattScaler
+}
+
+// A PlattScaler maps a raw probability p to a calibrated
+// probability 1/(1+exp(A*p+B)).
+type PlattScaler struct {
+	A float64
+	B float64
+}
+
+// Scale computes the calibrated probability.
+func (p PlattScaler) Scale(raw float64) float64 {
+	return 1 / (1 + math.Exp(p.A*raw+p.B))
+}
+
+// Calibrate fits one-vs-rest Platt scaling for every
+// class of the samples, which should be held out from
+// the tree's training set.
+//
+// For each class, a logistic function is fit to predict
+// whether a sample is in the class from the probability
+// which the tree assigns to the class, using the
+// regularized targets described by Platt so that the
+// fit never predicts probabilities of exactly 0 or 1.
+func Calibrate(tree *Tree, samples []Sample) *CalibratedTree {
+	res := &CalibratedTree{Tree: tree, Scalers: map[Class]PlattScaler{}}
+	raw := make([]map[Class]float64, len(samples))
+	for i, s := range samples {
+		raw[i] = tree.Classify(s)
+	}
+	for _, class := range newEntropyCounter(samples).classes {
+		probs := make([]float64, len(samples))
+		labels := make([]bool, len(samples))
+		for i, s := range samples {
+			probs[i] = raw[i][class]
+			labels[i] = s.Class() == class
+		}
+		res.Scalers[class] = fitPlatt(probs, labels)
+	}
+	return res
+}
+
+// Classify computes the calibrated probability of each
+// class, normalized so that the probabilities sum to 1.
+//
+// Only classes which appeared in the calibration samples
+// are included.
+func (c *CalibratedTree) Classify(s AttrMap) map[Class]float64 {
+	raw := c.Tree.Classify(s)
+	res := make(map[Class]float64, len(c.Scalers))
+	var total float64
+	for class, scaler := range c.Scalers {
+		prob := scaler.Scale(raw[class])
+		res[class] = prob
+		total += prob
+	}
+	for class, prob := range res {
+		res[class] = prob / total
+	}
+	return res
+}
+
+// ClassifyOne returns the most likely class for the
+// given sample, breaking ties like Tree.ClassifyOne.
+func (c *CalibratedTree) ClassifyOne(s AttrMap) Class {
+	class, _ := topClass(c.Classify(s))
+	return class
+}
+
+// fitPlatt fits Platt scaling with Newton's method and a
+// backtracking line search, as described by Lin, Lin, and
+// Weng in "A note on Platt's probabilistic outputs for
+// support vector machines".
+func fitPlatt(probs []float64, labels []bool) PlattScaler {
+	var numPos, numNeg float64
+	for _, label := range labels {
+		if label {
+			numPos++
+		} else {
+			numNeg++
+		}
+	}
+	targets := make([]float64, len(labels))
+	for i, label := range labels {
+		if label {
+			targets[i] = (numPos + 1) / (numPos + 2)
+		} else {
+			targets[i] = 1 / (numNeg + 2)
+		}
+	}
+
+	res := PlattScaler{B: math.Log((numNeg + 1) / (numPos + 1))}
+	loss := plattLoss(res, probs, targets)
+	for iter := 0; iter < plattMaxIters; iter++ {
+		h11, h22, h21 := plattHessianEps, plattHessianEps, 0.0
+		var g1, g2 float64
+		for i, f := range probs {
+			p := res.Scale(f)
+			d2 := p * (1 - p)
+			h11 += f * f * d2
+			h22 += d2
+			h21 += f * d2
+			d1 := targets[i] - p
+			g1 += f * d1
+			g2 += d1
+		}
+		if math.Abs(g1) < plattGradEps && math.Abs(g2) < plattGradEps {
+			break
+		}
+
+		det := h11*h22 - h21*h21
+		dA := -(h22*g1 - h21*g2) / det
+		dB := -(-h21*g1 + h11*g2) / det
+		gd := g1*dA + g2*dB
+		step := 1.0
+		for step >= plattMinStep {
+			next := PlattScaler{A: res.A + step*dA, B: res.B + step*dB}
+			if nextLoss := plattLoss(next, probs, targets); nextLoss < loss+1e-4*step*gd {
+				res, loss = next, nextLoss
+				break
+			}
+			step /= 2
+		}
+		if step < plattMinStep {
+			break
+		}
+	}
+	return res
+}
+
+// plattLoss computes the cross-entropy of a scaler's
+// predictions, in a form which cannot overflow.
+func plattLoss(p PlattScaler, probs, targets []float64) float64 {
+	var loss float64
+	for i, f := range probs {
+		x := p.A*f + p.B
+		if x >= 0 {
+			loss += targets[i]*x + math.Log1p(math.Exp(-x))
+		} else {
+			loss += (targets[i]-1)*x + math.Log1p(math.Exp(x))
+		}
+	}
+	return loss
+}
@@ -0,0 +1,86 @@
+package idtrees
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestCalibrate(t *testing.T) {
+	rand.Seed(1337)
+	noisySamples := func(n int) []Sample {
+		var res []Sample
+		for i := 0; i < n; i++ {
+			x := rand.Float64()
+			class := "low"
+			if x > 0.5 {
+				class = "high"
+			}
+			if rand.Float64() < 0.25 {
+				class = []string{"low", "high", "other"}[rand.Intn(3)]
+			}
+			res = append(res, treeTestSample{"x": x, "y": rand.Float64(), "class": class})
+		}
+		return res
+	}
+	attrs := []Attr{"x", "y"}
+	tree := ID3(noisySamples(500), attrs, 1)
+	calibrated := Calibrate(tree, noisySamples(1000))
+	if len(calibrated.Scalers) != 3 {
+		t.Fatalf("expected 3 scalers but got %d", len(calibrated.Scalers))
+	}
+
+	validation := noisySamples(1000)
+	rawScore := brierScore(tree.Classify, validation)
+	calibratedScore := brierScore(calibrated.Classify, validation)
+	if calibratedScore >= rawScore {
+		t.Errorf("calibration increased the Brier score from %f to %f", rawScore,
+			calibratedScore)
+	}
+
+	for _, s := range validation[:10] {
+		var total float64
+		for _, prob := range calibrated.Classify(s) {
+			if prob <= 0 || prob >= 1 {
+				t.Errorf("bad calibrated probability %f", prob)
+			}
+			total += prob
+		}
+		if math.Abs(total-1) > 1e-8 {
+			t.Errorf("probabilities sum to %f", total)
+		}
+	}
+}
+
+func TestFitPlatt(t *testing.T) {
+	// Samples with a raw probability of 1 are positive
+	// 80% of the time, and samples with a raw probability
+	// of 0 are positive 20% of the time.
+	var probs []float64
+	var labels []bool
+	for i := 0; i < 1000; i++ {
+		probs = append(probs, float64(i%2))
+		labels = append(labels, (i%2 == 1) == (i%10 < 8))
+	}
+	scaler := fitPlatt(probs, labels)
+	if p := scaler.Scale(1); math.Abs(p-0.8) > 0.01 {
+		t.Errorf("expected probability 0.8 but got %f", p)
+	}
+	if p := scaler.Scale(0); math.Abs(p-0.2) > 0.01 {
+		t.Errorf("expected probability 0.2 but got %f", p)
+	}
+}
+
+func brierScore(classify func(s AttrMap) map[Class]float64, samples []Sample) float64 {
+	var score float64
+	for _, s := range samples {
+		dist := classify(s)
+		for class, prob := range dist {
+			if class != s.Class() {
+				score += prob * prob
+			}
+		}
+		score += math.Pow(1-dist[s.Class()], 2)
+	}
+	return score / float64(len(samples))
+}
@@ -0,0 +1,115 @@
+package idtrees
+
+import "math"
+
+const (
+	gammaEpsilon  = 1e-14
+	gammaMaxIters = 1000
+)
+
+// chiSquarePValue computes the probability of observing
+// a chi-square statistic of at least stat under the null
+// hypothesis, given the degrees of freedom.
+func chiSquarePValue(stat float64, df int) float64 {
+	if df <= 0 || stat <= 0 {
+		return 1
+	}
+	return upperGamma(float64(df)/2, stat/2)
+}
+
+// upperGamma computes the regularized upper incomplete
+// gamma function Q(a, x).
+func upperGamma(a, x float64) float64 {
+	lgamma, _ := math.Lgamma(a)
+	logPrefix := a*math.Log(x) - x - lgamma
+	if x < a+1 {
+		// Use the series for P(a, x).
+		term := 1 / a
+		sum := term
+		for n := 1; n < gammaMaxIters; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*gammaEpsilon {
+				break
+			}
+		}
+		return 1 - sum*math.Exp(logPrefix)
+	}
+
+	// Use Lentz's method on the continued fraction for
+	// Q(a, x).
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < gammaMaxIters; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < gammaEpsilon {
+			break
+		}
+	}
+	return h * math.Exp(logPrefix)
+}
+
+// chiSquareIndependence tests whether the classes of the
+// samples are independent of the branches they belong to,
+// returning the p-value of the chi-square test.
+// Sample weights are used as counts.
+func chiSquareIndependence(branches [][]Sample) float64 {
+	var rowTotals []float64
+	var cells []map[Class]float64
+	colTotals := map[Class]float64{}
+	var total float64
+	for _, branch := range branches {
+		row := map[Class]float64{}
+		var rowTotal float64
+		for _, s := range branch {
+			w := sampleWeight(s)
+			row[s.Class()] += w
+			colTotals[s.Class()] += w
+			rowTotal += w
+		}
+		if rowTotal > 0 {
+			rowTotals = append(rowTotals, rowTotal)
+			cells = append(cells, row)
+			total += rowTotal
+		}
+	}
+
+	var numCols int
+	for _, colTotal := range colTotals {
+		if colTotal > 0 {
+			numCols++
+		}
+	}
+	df := (len(rowTotals) - 1) * (numCols - 1)
+	if df <= 0 {
+		return 1
+	}
+
+	var stat float64
+	for i, row := range cells {
+		for class, colTotal := range colTotals {
+			if colTotal <= 0 {
+				continue
+			}
+			expected := rowTotals[i] * colTotal / total
+			diff := row[class] - expected
+			stat += diff * diff / expected
+		}
+	}
+	return chiSquarePValue(stat, df)
+}
@@ -0,0 +1,55 @@
+package idtrees
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestChiSquarePValue(t *testing.T) {
+	cases := []struct {
+		stat     float64
+		df       int
+		expected float64
+	}{
+		{3.841459, 1, 0.05},
+		{5.991465, 2, 0.05},
+		{6.634897, 1, 0.01},
+		{1.386294, 2, 0.5},
+		{23.20925, 10, 0.01},
+		{0.454936, 1, 0.5},
+	}
+	for _, c := range cases {
+		if p := chiSquarePValue(c.stat, c.df); math.Abs(p-c.expected) > 1e-5 {
+			t.Errorf("stat %f df %d: expected %f but got %f", c.stat, c.df, c.expected, p)
+		}
+	}
+}
+
+func TestID3ChiSquareThreshold(t *testing.T) {
+	rand.Seed(1337)
+	var samples []Sample
+	for i := 0; i < 300; i++ {
+		class := rand.Intn(2)
+		related := "no"
+		if (class == 1) != (rand.Intn(4) == 0) {
+			related = "yes"
+		}
+		samples = append(samples, treeTestSample{
+			"related": related,
+			"random":  []string{"a", "b", "c"}[rand.Intn(3)],
+			"class":   class,
+		})
+	}
+
+	b := &Builder{ChiSquareThreshold: 0.05, MaxDepth: 1}
+	if tree := b.Build(samples, []Attr{"random"}); !tree.leaf() {
+		t.Error("expected independent attribute to be rejected")
+	}
+	if tree := b.Build(samples, []Attr{"related"}); tree.Attr != "related" {
+		t.Error("expected associated attribute to be accepted")
+	}
+	if tree := LimitedID3(samples, []Attr{"random"}, 0, 1); tree.leaf() {
+		t.Error("expected independent attribute to be used without the test")
+	}
+}
@@ -0,0 +1,82 @@
+package idtrees
+
+import "math"
+
+// A SplitCriterion is a custom impurity measure for
+// classification trees.
+//
+// The impurity of a split is the average impurity of its
+// branches, weighted by their total sample weights, and
+// the split with the lowest impurity is used.
+type SplitCriterion interface {
+	// Impurity computes the impurity of a node, given the
+	// total weight of the samples of each class in the
+	// node and the total weight of all the samples.
+	//
+	// The classWeights slice may include classes with a
+	// weight of 0, and it must not be modified.
+	Impurity(classWeights []float64, totalWeight float64) float64
+}
+
+// EntropyCriterion is a SplitCriterion which measures
+// impurity as the Shannon entropy of the class
+// distribution in nats.
+//
+// It is equivalent to the Entropy Criterion, which is
+// faster since it computes entropies incrementally.
+// However, since the two differ in rounding error, they
+// may break near-ties between splits differently.
+type EntropyCriterion struct{}
+
+func (EntropyCriterion) Impurity(classWeights []float64, totalWeight float64) float64 {
+	if totalWeight <= 0 {
+		return 0
+	}
+	var entropy float64
+	for _, weight := range classWeights {
+		if weight > 0 {
+			probability := weight / totalWeight
+			entropy -= probability * math.Log(probability)
+		}
+	}
+	return entropy
+}
+
+// GiniCriterion is a SplitCriterion which measures
+// impurity as the Gini impurity of the class
+// distribution, like the Gini Criterion.
+type GiniCriterion struct{}
+
+func (GiniCriterion) Impurity(classWeights []float64, totalWeight float64) float64 {
+	if totalWeight <= 0 {
+		return 0
+	}
+	impurity := 1.0
+	for _, weight := range classWeights {
+		probability := weight / totalWeight
+		impurity -= probability * probability
+	}
+	return impurity
+}
+
+// Impurity computes the impurity of the class
+// distribution with a custom criterion.
+func (e *entropyCounter) Impurity(c SplitCriterion) float64 {
+	weights := make([]float64, len(e.classes))
+	for i, class := range e.classes {
+		weights[i] = e.classWeights[class]
+	}
+	return c.Impurity(weights, e.totalWeight)
+}
+
+func (i *indexedCounter) Impurity(c SplitCriterion) float64 {
+	return c.Impurity(i.classWeights, i.totalWeight)
+}
+
+func (m *multiCounter) Impurity(c SplitCriterion) float64 {
+	var res float64
+	for _, output := range m.outputs {
+		res += output.Impurity(c)
+	}
+	return res
+}
@@ -0,0 +1,49 @@
+package idtrees
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testEntropyCriterion is a custom criterion which
+// computes entropy in its own way.
+type testEntropyCriterion struct{}
+
+func (testEntropyCriterion) Impurity(classWeights []float64, totalWeight float64) float64 {
+	var res float64
+	for _, w := range classWeights {
+		if w > 0 {
+			res += w * math.Log(totalWeight/w)
+		}
+	}
+	return res / totalWeight
+}
+
+func TestSplitCriterion(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(300, 4)
+	for _, s := range samples {
+		s.(treeTestSample)["color"] = []string{"red", "green", "blue"}[rand.Intn(3)]
+	}
+	attrs := []Attr{0, 1, 2, 3, "color"}
+
+	// Deep nodes with few samples often have splits which
+	// are tied up to rounding error, so the depth is
+	// limited to keep the trees comparable.
+	tests := []struct {
+		Expected *Builder
+		Actual   *Builder
+	}{
+		{&Builder{MaxDepth: 3}, &Builder{MaxDepth: 3, SplitCriterion: testEntropyCriterion{}}},
+		{&Builder{MaxDepth: 3}, &Builder{MaxDepth: 3, SplitCriterion: EntropyCriterion{}}},
+		{&Builder{Criterion: Gini}, &Builder{SplitCriterion: GiniCriterion{}}},
+	}
+	for i, test := range tests {
+		expected := test.Expected.Build(samples, attrs)
+		actual := test.Actual.Build(samples, attrs)
+		if !treesEqual(expected, actual) {
+			t.Errorf("test %d: trees differ", i)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package idtrees
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// LoadCSV reads samples from a CSV file.
+//
+// The first row names the columns.
+// The column named classColumn provides each sample's
+// class, and the names of the remaining columns are
+// returned as attributes, in order.
+//
+// Each column's type is inferred from its values: a
+// column is int64 if every value parses as an integer,
+// float64 if every value parses as a number, and string
+// otherwise.
+// Empty cells are treated as missing values and become
+// nil attributes.
+func LoadCSV(r io.Reader, classColumn string) ([]Sample, []string, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("missing CSV header")
+	}
+	header, rows := records[0], records[1:]
+
+	columns := map[string]int{}
+	classIdx := -1
+	var attrs []string
+	for i, name := range header {
+		if _, ok := columns[name]; ok {
+			return nil, nil, fmt.Errorf("duplicate column: %s", name)
+		}
+		columns[name] = i
+		if name == classColumn {
+			classIdx = i
+		} else {
+			attrs = append(attrs, name)
+		}
+	}
+	if classIdx < 0 {
+		return nil, nil, fmt.Errorf("missing class column: %s", classColumn)
+	}
+
+	values := make([][]Val, len(rows))
+	for i := range values {
+		values[i] = make([]Val, len(header))
+	}
+	for col := range header {
+		parseColumn(rows, values, col)
+	}
+
+	samples := make([]Sample, len(rows))
+	for i, row := range values {
+		samples[i] = &csvSample{
+			columns:  columns,
+			values:   row,
+			classIdx: classIdx,
+		}
+	}
+	return samples, attrs, nil
+}
+
+// parseColumn converts the strings in one column to the
+// column's inferred type.
+func parseColumn(rows [][]string, values [][]Val, col int) {
+	allInt, allFloat := true, true
+	for _, row := range rows {
+		if row[col] == "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(row[col], 10, 64); err != nil {
+			allInt = false
+		}
+		if _, err := strconv.ParseFloat(row[col], 64); err != nil {
+			allFloat = false
+		}
+	}
+	for i, row := range rows {
+		str := row[col]
+		if str == "" {
+			continue
+		}
+		if allInt {
+			values[i][col], _ = strconv.ParseInt(str, 10, 64)
+		} else if allFloat {
+			values[i][col], _ = strconv.ParseFloat(str, 64)
+		} else {
+			values[i][col] = str
+		}
+	}
+}
+
+type csvSample struct {
+	columns  map[string]int
+	values   []Val
+	classIdx int
+}
+
+func (c *csvSample) Attr(attr Attr) Val {
+	name, ok := attr.(string)
+	if !ok {
+		return nil
+	}
+	idx, ok := c.columns[name]
+	if !ok {
+		return nil
+	}
+	return c.values[idx]
+}
+
+func (c *csvSample) Class() Class {
+	return c.values[c.classIdx]
+}
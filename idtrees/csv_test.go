@@ -0,0 +1,64 @@
+package idtrees
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadCSV(t *testing.T) {
+	data := `age,height,name,code,label
+3,2.5,"Smith, Ann",1,child
+5,3,Bob,x,child
+30,5.5,"Carol ""C""",2,adult
+32,,Dan,3,adult
+`
+	samples, attrs, err := LoadCSV(strings.NewReader(data), "label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedAttrs := []string{"age", "height", "name", "code"}
+	if len(attrs) != len(expectedAttrs) {
+		t.Fatalf("expected attrs %v but got %v", expectedAttrs, attrs)
+	}
+	for i, attr := range expectedAttrs {
+		if attrs[i] != attr {
+			t.Fatalf("expected attrs %v but got %v", expectedAttrs, attrs)
+		}
+	}
+	if len(samples) != 4 {
+		t.Fatalf("expected 4 samples but got %d", len(samples))
+	}
+
+	expected := []map[string]Val{
+		{"age": int64(3), "height": 2.5, "name": "Smith, Ann", "code": "1"},
+		{"age": int64(5), "height": 3.0, "name": "Bob", "code": "x"},
+		{"age": int64(30), "height": 5.5, "name": `Carol "C"`, "code": "2"},
+		{"age": int64(32), "height": nil, "name": "Dan", "code": "3"},
+	}
+	classes := []Class{"child", "child", "adult", "adult"}
+	for i, s := range samples {
+		for attr, val := range expected[i] {
+			if actual := s.Attr(attr); actual != val {
+				t.Errorf("sample %d: %s should be %#v but got %#v", i, attr, val, actual)
+			}
+		}
+		if s.Class() != classes[i] {
+			t.Errorf("sample %d: expected class %v but got %v", i, classes[i], s.Class())
+		}
+	}
+
+	var treeAttrs []Attr
+	for _, attr := range attrs {
+		treeAttrs = append(treeAttrs, attr)
+	}
+	tree := ID3(samples, treeAttrs, 0)
+	for i, s := range samples {
+		if class := tree.ClassifyOne(s); class != classes[i] {
+			t.Errorf("sample %d: classified as %v", i, class)
+		}
+	}
+
+	if _, _, err := LoadCSV(strings.NewReader(data), "missing"); err == nil {
+		t.Error("expected error for missing class column")
+	}
+}
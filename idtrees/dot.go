@@ -0,0 +1,92 @@
+package idtrees
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DOT returns a Graphviz representation of the tree.
+// See WriteDOT for details.
+func (t *Tree) DOT() string {
+	var buf bytes.Buffer
+	t.WriteDOT(&buf)
+	return buf.String()
+}
+
+// WriteDOT writes a Graphviz digraph representing the
+// tree, which can be rendered with a command like
+// "dot -Tpng".
+//
+// Numerical splits are labeled with their thresholds and
+// have "<=" and ">" edges, multi-way numerical splits
+// have one edge per range of values, categorical splits
+// have one edge per value, and leaves are labeled with
+// their class probabilities (one line per output for
+// multi-output trees) or regression targets.
+func (t *Tree) WriteDOT(w io.Writer) error {
+	bufWriter := bufio.NewWriter(w)
+	bufWriter.WriteString("digraph tree {\n")
+
+	type dotNode struct {
+		Tree *Tree
+		ID   int
+	}
+	nodes := []dotNode{{t, 0}}
+	nextID := 1
+	for len(nodes) > 0 {
+		node := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+
+		addChild := func(child *Tree, edgeLabel string) {
+			fmt.Fprintf(bufWriter, "  n%d -> n%d [label=\"%s\"];\n", node.ID, nextID,
+				dotEscape(edgeLabel))
+			nodes = append(nodes, dotNode{child, nextID})
+			nextID++
+		}
+
+		var label string
+		if node.Tree.Classification != nil {
+			label = classificationString(node.Tree.Classification)
+		} else if node.Tree.Classifications != nil {
+			label = outputsString(node.Tree.Classifications, classificationString, "\n")
+		} else if node.Tree.leaf() {
+			label = "value=" + valueString(node.Tree.Value)
+		} else if node.Tree.NumSplit != nil && node.Tree.NumSplit.Branches == nil {
+			label = fmt.Sprintf("%v <= %v", node.Tree.Attr, node.Tree.NumSplit.Threshold)
+		} else {
+			label = fmt.Sprintf("%v", node.Tree.Attr)
+		}
+		shape := "ellipse"
+		if node.Tree.leaf() {
+			shape = "box"
+		}
+		fmt.Fprintf(bufWriter, "  n%d [label=\"%s\", shape=%s];\n", node.ID,
+			dotEscape(label), shape)
+
+		if node.Tree.NumSplit != nil && node.Tree.NumSplit.Branches == nil {
+			addChild(node.Tree.NumSplit.LessEqual, "<=")
+			addChild(node.Tree.NumSplit.Greater, ">")
+		} else if node.Tree.NumSplit != nil {
+			tests := node.Tree.NumSplit.branchTests(fmt.Sprintf("%v", node.Tree.Attr))
+			for i, child := range node.Tree.NumSplit.Branches {
+				addChild(child, tests[i])
+			}
+		} else {
+			for _, val := range node.Tree.SortedValSplitKeys() {
+				addChild(node.Tree.ValSplit[val], fmt.Sprintf("== %v", val))
+			}
+		}
+	}
+
+	bufWriter.WriteString("}\n")
+	return bufWriter.Flush()
+}
+
+func dotEscape(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return strings.Replace(s, "\n", `\n`, -1)
+}
@@ -0,0 +1,147 @@
+package idtrees
+
+import "math"
+
+// equalTolerance is the relative tolerance which Equal
+// uses for floating-point numbers.
+const equalTolerance = 1e-8
+
+// Equal checks if two trees have the same structure:
+// the same attributes, thresholds, branches, surrogates,
+// missing-value sentinels, and sample counts, and
+// approximately equal gains, weights, targets, and class
+// distributions (including Fallbacks).
+//
+// Floating-point numbers, including float64 thresholds,
+// are compared with a small relative tolerance.
+// Other attributes and values must be equal and of the
+// same type, so an int64 threshold never equals a float64
+// one.
+// A class which is missing from a distribution is treated
+// as having probability 0.
+func (t *Tree) Equal(other *Tree) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+	if t.leaf() != other.leaf() || (t.NumSplit == nil) != (other.NumSplit == nil) {
+		return false
+	}
+	if t.SampleCount != other.SampleCount || !floatsEqual(t.Weight, other.Weight) ||
+		!floatsEqual(t.Value, other.Value) {
+		return false
+	}
+	if (t.Classification == nil) != (other.Classification == nil) ||
+		!distributionsEqual(t.Classification, other.Classification) {
+		return false
+	}
+	if len(t.Classifications) != len(other.Classifications) {
+		return false
+	}
+	for i, dist := range t.Classifications {
+		if !distributionsEqual(dist, other.Classifications[i]) {
+			return false
+		}
+	}
+	if t.leaf() {
+		return true
+	}
+
+	if t.Attr != other.Attr || t.MissingValue != other.MissingValue ||
+		!floatsEqual(t.Gain, other.Gain) || len(t.Surrogates) != len(other.Surrogates) {
+		return false
+	}
+	for i := range t.Surrogates {
+		if !t.Surrogates[i].equal(&other.Surrogates[i]) {
+			return false
+		}
+	}
+
+	if t.NumSplit != nil {
+		n1, n2 := t.NumSplit, other.NumSplit
+		if !valsEqual(n1.Threshold, n2.Threshold) || len(n1.Order) != len(n2.Order) {
+			return false
+		}
+		for i, val := range n1.Order {
+			if n2.Order[i] != val {
+				return false
+			}
+		}
+		if len(n1.Thresholds) != len(n2.Thresholds) ||
+			len(n1.Branches) != len(n2.Branches) {
+			return false
+		}
+		for i, val := range n1.Thresholds {
+			if !valsEqual(val, n2.Thresholds[i]) {
+				return false
+			}
+		}
+		b1, b2 := n1.branches(), n2.branches()
+		for i, child := range b1 {
+			if !child.Equal(b2[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if len(t.ValSplit) != len(other.ValSplit) ||
+		(t.Fallback == nil) != (other.Fallback == nil) ||
+		!distributionsEqual(t.Fallback, other.Fallback) {
+		return false
+	}
+	for val, child := range t.ValSplit {
+		otherChild, ok := other.ValSplit[val]
+		if !ok || !child.Equal(otherChild) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Surrogate) equal(other *Surrogate) bool {
+	if s.Attr != other.Attr || s.MissingValue != other.MissingValue ||
+		!valsEqual(s.Threshold, other.Threshold) || s.LessEqual != other.LessEqual ||
+		s.Greater != other.Greater || !floatsEqual(s.Agreement, other.Agreement) ||
+		len(s.Branches) != len(other.Branches) {
+		return false
+	}
+	for val, key := range s.Branches {
+		if otherKey, ok := other.Branches[val]; !ok || otherKey != key {
+			return false
+		}
+	}
+	return true
+}
+
+// valsEqual compares two values, using a tolerance for
+// float64 values.
+func valsEqual(v1, v2 Val) bool {
+	f1, ok1 := v1.(float64)
+	f2, ok2 := v2.(float64)
+	if ok1 && ok2 {
+		return floatsEqual(f1, f2)
+	}
+	return v1 == v2
+}
+
+func distributionsEqual(d1, d2 map[Class]float64) bool {
+	for class, prob := range d1 {
+		if !floatsEqual(prob, d2[class]) {
+			return false
+		}
+	}
+	for class, prob := range d2 {
+		if _, ok := d1[class]; !ok && !floatsEqual(prob, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func floatsEqual(x, y float64) bool {
+	if x == y {
+		return true
+	}
+	scale := math.Max(1, math.Max(math.Abs(x), math.Abs(y)))
+	return math.Abs(x-y) <= equalTolerance*scale
+}
@@ -0,0 +1,265 @@
+package idtrees
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"text/tabwriter"
+)
+
+// CrossValidate performs k-fold cross-validation.
+//
+// The samples are shuffled and split into k folds.
+// For each fold, g is used to train a tree on the
+// remaining folds, and the tree's accuracy is measured
+// on the fold.
+// The result is the mean accuracy across folds.
+//
+// An error is returned if k is less than 2 or greater
+// than the number of samples.
+//
+// If rng is nil, the global source from math/rand is
+// used.
+func CrossValidate(samples []Sample, attrs []Attr, k int, g TreeGen,
+	rng *rand.Rand) (float64, error) {
+	if k < 2 {
+		return 0, errors.New("cross-validation requires at least 2 folds")
+	} else if k > len(samples) {
+		return 0, errors.New("more folds than samples")
+	}
+
+	shuffled := make([]Sample, len(samples))
+	for i, j := range randPerm(rng, len(samples)) {
+		shuffled[i] = samples[j]
+	}
+
+	var totalAccuracy float64
+	for fold := 0; fold < k; fold++ {
+		start := fold * len(shuffled) / k
+		end := (fold + 1) * len(shuffled) / k
+		training := make([]Sample, 0, len(shuffled)-(end-start))
+		training = append(training, shuffled[:start]...)
+		training = append(training, shuffled[end:]...)
+
+		tree := g(training, attrs)
+		var correct int
+		for _, s := range shuffled[start:end] {
+			if tree.ClassifyOne(s) == s.Class() {
+				correct++
+			}
+		}
+		totalAccuracy += float64(correct) / float64(end-start)
+	}
+	return totalAccuracy / float64(k), nil
+}
+
+// Accuracy returns the fraction of the samples which
+// ClassifyOne classifies correctly.
+// It returns NaN if there are no samples.
+func (t *Tree) Accuracy(samples []Sample) float64 {
+	if len(samples) == 0 {
+		return math.NaN()
+	}
+	var correct int
+	for _, s := range samples {
+		if t.ClassifyOne(s) == s.Class() {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(samples))
+}
+
+// A ConfusionMatrix counts how often samples of each
+// class are classified as each class.
+type ConfusionMatrix struct {
+	// Counts maps actual classes to predicted classes to
+	// the number of samples with that pair of classes.
+	Counts map[Class]map[Class]int
+
+	// Total is the total number of samples.
+	Total int
+}
+
+// NewConfusionMatrix classifies each sample with
+// Tree.ClassifyOne and tabulates the results.
+func NewConfusionMatrix(t *Tree, samples []Sample) *ConfusionMatrix {
+	res := &ConfusionMatrix{Counts: map[Class]map[Class]int{}}
+	for _, s := range samples {
+		res.Add(s.Class(), t.ClassifyOne(s))
+	}
+	return res
+}
+
+// Add records a single classification.
+func (c *ConfusionMatrix) Add(actual, predicted Class) {
+	if c.Counts == nil {
+		c.Counts = map[Class]map[Class]int{}
+	}
+	if c.Counts[actual] == nil {
+		c.Counts[actual] = map[Class]int{}
+	}
+	c.Counts[actual][predicted]++
+	c.Total++
+}
+
+// Accuracy returns the fraction of samples which were
+// classified correctly.
+// It returns 0 if there are no samples.
+func (c *ConfusionMatrix) Accuracy() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	var correct int
+	for class, row := range c.Counts {
+		correct += row[class]
+	}
+	return float64(correct) / float64(c.Total)
+}
+
+// Precision returns the fraction of samples predicted as
+// the class which actually belong to it.
+// It returns 0 if no samples were predicted as the class.
+func (c *ConfusionMatrix) Precision(class Class) float64 {
+	var predicted int
+	for _, row := range c.Counts {
+		predicted += row[class]
+	}
+	if predicted == 0 {
+		return 0
+	}
+	return float64(c.Counts[class][class]) / float64(predicted)
+}
+
+// Recall returns the fraction of samples of the class
+// which were predicted as the class.
+// It returns 0 if there are no samples of the class.
+func (c *ConfusionMatrix) Recall(class Class) float64 {
+	var actual int
+	for _, count := range c.Counts[class] {
+		actual += count
+	}
+	if actual == 0 {
+		return 0
+	}
+	return float64(c.Counts[class][class]) / float64(actual)
+}
+
+// F1 returns the harmonic mean of the precision and
+// recall for the class.
+// It returns 0 if both are 0.
+func (c *ConfusionMatrix) F1(class Class) float64 {
+	p, r := c.Precision(class), c.Recall(class)
+	if p+r == 0 {
+		return 0
+	}
+	return 2 * p * r / (p + r)
+}
+
+// String renders the matrix as a table, with one row
+// per actual class and one column per predicted class.
+func (c *ConfusionMatrix) String() string {
+	classSet := map[Class]bool{}
+	for actual, row := range c.Counts {
+		classSet[actual] = true
+		for predicted := range row {
+			classSet[predicted] = true
+		}
+	}
+	var classes []Class
+	for class := range classSet {
+		classes = append(classes, class)
+	}
+	sort.SliceStable(classes, func(i, j int) bool {
+		return fmt.Sprintf("%v", classes[i]) < fmt.Sprintf("%v", classes[j])
+	})
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "actual\\predicted\t")
+	for _, class := range classes {
+		fmt.Fprintf(w, "%v\t", class)
+	}
+	fmt.Fprintln(w)
+	for _, actual := range classes {
+		fmt.Fprintf(w, "%v\t", actual)
+		for _, predicted := range classes {
+			fmt.Fprintf(w, "%d\t", c.Counts[actual][predicted])
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// A Point is a point on an ROC curve.
+type Point struct {
+	// FPR is the false positive rate.
+	FPR float64
+
+	// TPR is the true positive rate.
+	TPR float64
+}
+
+// ROCCurve computes the ROC curve of a binary tree,
+// ranking the samples by the probability of positiveClass
+// returned by Tree.Classify.
+//
+// The curve starts at (0, 0) and ends at (1, 1), with one
+// point for each distinct predicted probability.
+// Samples with tied probabilities are treated as a group,
+// so the curve steps diagonally across them.
+// The second return value is the area under the curve,
+// computed with the trapezoidal rule.
+//
+// If the samples do not include both positive and
+// negative samples, the curve is nil and the area is NaN.
+func ROCCurve(t *Tree, samples []Sample, positiveClass Class) ([]Point, float64) {
+	type scoredSample struct {
+		score    float64
+		positive bool
+	}
+	scored := make([]scoredSample, len(samples))
+	var numPositive, numNegative int
+	for i, s := range samples {
+		scored[i] = scoredSample{
+			score:    t.Classify(s)[positiveClass],
+			positive: s.Class() == positiveClass,
+		}
+		if scored[i].positive {
+			numPositive++
+		} else {
+			numNegative++
+		}
+	}
+	if numPositive == 0 || numNegative == 0 {
+		return nil, math.NaN()
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	points := []Point{{}}
+	var area float64
+	var truePositives, falsePositives int
+	for i, s := range scored {
+		if s.positive {
+			truePositives++
+		} else {
+			falsePositives++
+		}
+		if i+1 < len(scored) && scored[i+1].score == s.score {
+			continue
+		}
+		last := points[len(points)-1]
+		point := Point{
+			FPR: float64(falsePositives) / float64(numNegative),
+			TPR: float64(truePositives) / float64(numPositive),
+		}
+		area += (point.FPR - last.FPR) * (point.TPR + last.TPR) / 2
+		points = append(points, point)
+	}
+	return points, area
+}
@@ -0,0 +1,156 @@
+package idtrees
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestCrossValidate(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 50; i++ {
+		samples = append(samples, treeTestSample{"x": int64(i), "class": i < 25})
+	}
+	samples = append(samples, treeTestSample{"x": int64(100), "class": "rare"})
+
+	gen := func(s []Sample, a []Attr) *Tree {
+		return ID3(s, a, 1)
+	}
+
+	acc1, err := CrossValidate(samples, []Attr{"x"}, 5, gen, rand.New(rand.NewSource(1337)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc2, _ := CrossValidate(samples, []Attr{"x"}, 5, gen, rand.New(rand.NewSource(1337)))
+	if acc1 != acc2 {
+		t.Errorf("non-deterministic accuracy: %f vs %f", acc1, acc2)
+	}
+	if acc1 < 0.9 || acc1 > 1 {
+		t.Errorf("unexpected accuracy: %f", acc1)
+	}
+
+	if _, err := CrossValidate(samples, []Attr{"x"}, len(samples)+1, gen, nil); err == nil {
+		t.Error("expected error for too many folds")
+	}
+	if _, err := CrossValidate(samples, []Attr{"x"}, 1, gen, nil); err == nil {
+		t.Error("expected error for one fold")
+	}
+}
+
+func TestTreeAccuracy(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(300, 4)
+	for _, s := range samples {
+		s.(treeTestSample)["id"] = rand.Float64()
+	}
+	tree := ID3(samples, []Attr{0, 1, 2, 3, "id"}, 1)
+	if acc := tree.Accuracy(samples); acc != 1 {
+		t.Errorf("expected accuracy 1 on the training set but got %f", acc)
+	}
+
+	stump := LimitedID3(samples, []Attr{0, 1, 2, 3}, 1, 1)
+	expected := NewConfusionMatrix(stump, samples).Accuracy()
+	if acc := stump.Accuracy(samples); acc != expected || acc == 1 {
+		t.Errorf("expected accuracy %f but got %f", expected, acc)
+	}
+	if acc := tree.Accuracy(nil); !math.IsNaN(acc) {
+		t.Errorf("expected NaN for no samples but got %f", acc)
+	}
+}
+
+func TestConfusionMatrix(t *testing.T) {
+	tree := &Tree{
+		Attr: "x",
+		NumSplit: &NumSplit{
+			Threshold: int64(5),
+			LessEqual: &Tree{Classification: map[Class]float64{"a": 1}},
+			Greater:   &Tree{Classification: map[Class]float64{"b": 0.5, "c": 0.5}},
+		},
+	}
+	samples := []Sample{
+		treeTestSample{"x": int64(1), "class": "a"},
+		treeTestSample{"x": int64(2), "class": "a"},
+		treeTestSample{"x": int64(3), "class": "b"},
+		treeTestSample{"x": int64(6), "class": "b"},
+		treeTestSample{"x": int64(7), "class": "b"},
+		treeTestSample{"x": int64(8), "class": "c"},
+		treeTestSample{"x": int64(9), "class": "a"},
+	}
+	matrix := NewConfusionMatrix(tree, samples)
+
+	var diagonal int
+	for class, row := range matrix.Counts {
+		diagonal += row[class]
+	}
+	if diagonal != 4 || matrix.Total != 7 {
+		t.Errorf("expected 4/7 correct but got %d/%d", diagonal, matrix.Total)
+	}
+	if acc := matrix.Accuracy(); math.Abs(acc-4.0/7) > 1e-8 {
+		t.Errorf("unexpected accuracy: %f", acc)
+	}
+	if p := matrix.Precision("b"); math.Abs(p-0.5) > 1e-8 {
+		t.Errorf("unexpected precision: %f", p)
+	}
+	if r := matrix.Recall("b"); math.Abs(r-2.0/3) > 1e-8 {
+		t.Errorf("unexpected recall: %f", r)
+	}
+	if f := matrix.F1("b"); math.Abs(f-4.0/7) > 1e-8 {
+		t.Errorf("unexpected F1: %f", f)
+	}
+	if p := matrix.Precision("c"); p != 0 {
+		t.Errorf("unexpected precision: %f", p)
+	}
+
+	expected := "  actual\\predicted  a  b  c\n" +
+		"                 a  2  1  0\n" +
+		"                 b  1  2  0\n" +
+		"                 c  0  1  0\n"
+	if s := matrix.String(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+}
+
+func TestROCCurve(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 20; i++ {
+		samples = append(samples, treeTestSample{"x": int64(i), "class": i >= 12})
+	}
+	tree := ID3(samples, []Attr{"x"}, 1)
+	points, area := ROCCurve(tree, samples, true)
+	if area != 1 {
+		t.Errorf("expected AUC 1 but got %f", area)
+	}
+	if len(points) != 3 || points[0] != (Point{}) || points[1] != (Point{0, 1}) ||
+		points[2] != (Point{1, 1}) {
+		t.Errorf("unexpected points: %v", points)
+	}
+
+	// With every probability tied, the curve is the
+	// diagonal and the AUC is 0.5.
+	stump := &Tree{Classification: map[Class]float64{true: 0.4, false: 0.6}}
+	points, area = ROCCurve(stump, samples, true)
+	if area != 0.5 || len(points) != 2 || points[1] != (Point{1, 1}) {
+		t.Errorf("unexpected curve %v with AUC %f", points, area)
+	}
+
+	tree = &Tree{
+		Attr: "x",
+		NumSplit: &NumSplit{
+			Threshold: int64(9),
+			LessEqual: &Tree{Classification: map[Class]float64{true: 0.2, false: 0.8}},
+			Greater:   &Tree{Classification: map[Class]float64{true: 0.7, false: 0.3}},
+		},
+	}
+	// The samples above 9 include all 8 positives and 2
+	// of the 12 negatives, so the curve steps diagonally
+	// to (1/6, 1).
+	_, area = ROCCurve(tree, samples, true)
+	expected := 11.0 / 12
+	if math.Abs(area-expected) > 1e-8 {
+		t.Errorf("expected AUC %f but got %f", expected, area)
+	}
+
+	if _, area := ROCCurve(tree, samples[:5], true); !math.IsNaN(area) {
+		t.Errorf("expected NaN but got %f", area)
+	}
+}
@@ -11,8 +11,24 @@ type TreeGen func(s []Sample, attrs []Attr) *Tree
 
 // A Forest is a list of bagged trees that are used
 // to classify samples.
+//
+// A Forest may be encoded with encoding/json, which
+// uses Tree's JSON encoding for each tree, or with the
+// more compact MarshalBinary.
 type Forest []*Tree
 
+// An OOBForest is a Forest which remembers the
+// out-of-bag samples of each of its trees, so that its
+// generalization error can be estimated with OOBError.
+type OOBForest struct {
+	Forest
+
+	// OutOfBag stores, for each tree, the indices of the
+	// training samples which the tree was not trained
+	// on.
+	OutOfBag [][]int
+}
+
 // BuildForest creates a random forest with n trees,
 // where each tree was trained on nSamples samples
 // and nAttrs attributes.
@@ -21,20 +37,36 @@ type Forest []*Tree
 // number of attributes is used.
 func BuildForest(n int, samples []Sample, attrs []Attr,
 	nSamples, nAttrs int, g TreeGen) Forest {
+	return BuildOOBForest(n, samples, attrs, nSamples, nAttrs, g).Forest
+}
+
+// BuildOOBForest is like BuildForest, but it also
+// records the out-of-bag samples of each tree.
+func BuildOOBForest(n int, samples []Sample, attrs []Attr,
+	nSamples, nAttrs int, g TreeGen) *OOBForest {
 	if nAttrs == 0 {
 		nAttrs = int(math.Sqrt(float64(len(attrs))) + 0.5)
 	}
-	sampleCopy := make([]Sample, len(samples))
+	indices := make([]int, len(samples))
+	for i := range indices {
+		indices[i] = i
+	}
 	attrCopy := make([]Attr, len(attrs))
-
-	copy(sampleCopy, samples)
 	copy(attrCopy, attrs)
 
-	res := make(Forest, n)
+	res := &OOBForest{
+		Forest:   make(Forest, n),
+		OutOfBag: make([][]int, n),
+	}
+	treeSamples := make([]Sample, nSamples)
 	for i := 0; i < n; i++ {
-		randomizeSamples(sampleCopy, nSamples)
+		randomizeIndices(indices, nSamples)
 		randomizeAttrs(attrCopy, nAttrs)
-		res[i] = g(sampleCopy[:nSamples], attrCopy[:nAttrs])
+		for j, idx := range indices[:nSamples] {
+			treeSamples[j] = samples[idx]
+		}
+		res.Forest[i] = g(treeSamples, attrCopy[:nAttrs])
+		res.OutOfBag[i] = append([]int{}, indices[nSamples:]...)
 	}
 	return res
 }
@@ -42,21 +74,49 @@ func BuildForest(n int, samples []Sample, attrs []Attr,
 // Classify uses f to compute the class probabilities
 // of the given sample.
 func (f Forest) Classify(s AttrMap) map[Class]float64 {
-	res := map[Class]float64{}
-	for _, t := range f {
-		x := t.Classify(s)
-		for k, v := range x {
-			res[k] += v
+	return averageClassification(f, s)
+}
+
+// OOBError estimates the generalization error of the
+// forest using its out-of-bag samples.
+//
+// The samples must be the ones which were passed to
+// BuildOOBForest.
+// Each sample is classified using only the trees which
+// were not trained on it, and the fraction of these
+// classifications which are incorrect is returned.
+// Samples which every tree was trained on are ignored.
+// If no samples are out-of-bag, 0 is returned.
+func (f *OOBForest) OOBError(samples []Sample) float64 {
+	votes := make([]map[Class]float64, len(samples))
+	for i, t := range f.Forest {
+		for _, idx := range f.OutOfBag[i] {
+			if votes[idx] == nil {
+				votes[idx] = map[Class]float64{}
+			}
+			for class, prob := range t.Classify(samples[idx]) {
+				votes[idx][class] += prob
+			}
 		}
 	}
-	scaler := 1 / float64(len(f))
-	for k, v := range res {
-		res[k] = v * scaler
+
+	var numWrong, numTotal int
+	for i, v := range votes {
+		if v == nil {
+			continue
+		}
+		numTotal++
+		if class, _ := topClass(v); class != samples[i].Class() {
+			numWrong++
+		}
 	}
-	return res
+	if numTotal == 0 {
+		return 0
+	}
+	return float64(numWrong) / float64(numTotal)
 }
 
-func randomizeSamples(s []Sample, n int) {
+func randomizeIndices(s []int, n int) {
 	for i := 0; i < n; i++ {
 		idx := rand.Intn(len(s)-i) + i
 		s[i], s[idx] = s[idx], s[i]
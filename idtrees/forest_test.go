@@ -0,0 +1,137 @@
+package idtrees
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestForestOOBError(t *testing.T) {
+	rand.Seed(1337)
+	samples := forestTestSamples()
+	attrs := []Attr{0, 1, 2, 3}
+	train, test := samples[:500], samples[500:]
+
+	forest := BuildOOBForest(30, train, attrs, 300, 2, func(s []Sample, a []Attr) *Tree {
+		return LimitedID3(s, a, 1, 4)
+	})
+	for i, oob := range forest.OutOfBag {
+		if len(oob) != 200 {
+			t.Fatalf("tree %d has %d out-of-bag samples", i, len(oob))
+		}
+	}
+
+	oobError := forest.OOBError(train)
+	var numWrong int
+	for _, s := range test {
+		if class, _ := topClass(forest.Classify(s)); class != s.Class() {
+			numWrong++
+		}
+	}
+	testError := float64(numWrong) / float64(len(test))
+	if math.Abs(oobError-testError) > 0.08 {
+		t.Errorf("OOB error %f is far from test error %f", oobError, testError)
+	}
+}
+
+func TestForestSerialization(t *testing.T) {
+	rand.Seed(1337)
+	samples := forestTestSamples()
+	train, test := samples[:500], samples[500:]
+	forest := BuildOOBForest(10, train, []Attr{0, 1, 2, 3}, 300, 2,
+		func(s []Sample, a []Attr) *Tree {
+			return LimitedID3(s, a, 1, 4)
+		})
+
+	jsonData, err := json.Marshal(forest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jsonForest OOBForest
+	if err := json.Unmarshal(jsonData, &jsonForest); err != nil {
+		t.Fatal(err)
+	}
+
+	binaryData, err := forest.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var binaryForest OOBForest
+	if err := binaryForest.UnmarshalBinary(binaryData); err != nil {
+		t.Fatal(err)
+	}
+	if err := binaryForest.UnmarshalBinary(binaryData[:len(binaryData)-1]); err == nil {
+		t.Error("expected error for truncated data")
+	}
+
+	for name, decoded := range map[string]*OOBForest{"JSON": &jsonForest, "binary": &binaryForest} {
+		if len(decoded.Forest) != len(forest.Forest) {
+			t.Fatalf("%s: expected %d trees but got %d", name, len(forest.Forest),
+				len(decoded.Forest))
+		}
+		for i, tree := range forest.Forest {
+			if !treesEqual(tree, decoded.Forest[i]) {
+				t.Errorf("%s: tree %d differs", name, i)
+			}
+		}
+		if decoded.OOBError(train) != forest.OOBError(train) {
+			t.Errorf("%s: out-of-bag error differs", name)
+		}
+		for i, s := range test {
+			expected, actual := forest.Classify(s), decoded.Classify(s)
+			if !classificationsEqual(expected, actual) {
+				t.Errorf("%s: sample %d: expected %v but got %v", name, i, expected, actual)
+			}
+		}
+	}
+}
+
+func TestForestSlice(t *testing.T) {
+	rand.Seed(1337)
+	samples := forestTestSamples()
+	forest := BuildForest(5, samples, []Attr{0, 1, 2, 3}, 300, 2,
+		func(s []Sample, a []Attr) *Tree {
+			return LimitedID3(s, a, 1, 2)
+		})
+	if len(forest) != 5 {
+		t.Fatalf("expected 5 trees but got %d", len(forest))
+	}
+
+	data, err := forest.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Forest
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(forest) {
+		t.Fatalf("expected %d trees but got %d", len(forest), len(decoded))
+	}
+	for i, tree := range forest {
+		if !treesEqual(tree, decoded[i]) {
+			t.Errorf("tree %d differs", i)
+		}
+	}
+}
+
+func forestTestSamples() []Sample {
+	var samples []Sample
+	for i := 0; i < 800; i++ {
+		s := treeTestSample{}
+		var sum float64
+		for j := 0; j < 4; j++ {
+			x := rand.Float64()
+			s[j] = x
+			sum += x
+		}
+		class := sum > 2
+		if rand.Intn(10) == 0 {
+			class = !class
+		}
+		s["class"] = class
+		samples = append(samples, s)
+	}
+	return samples
+}
@@ -0,0 +1,181 @@
+package idtrees
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+)
+
+// RegisterGobTypes registers the concrete types of the
+// given values with encoding/gob, so that attributes,
+// values, and classes of those types can be gob encoded
+// as part of a Tree.
+//
+// The basic types (such as int, int64, float64, string,
+// and bool) are always registered, so the int64 and
+// float64 thresholds which ID3 produces need no extra
+// registration.
+// Custom types, such as a struct used as a class,
+// must be registered before encoding or decoding.
+func RegisterGobTypes(values ...interface{}) {
+	for _, v := range values {
+		gob.Register(v)
+	}
+}
+
+// gobNode is one node of a tree, stored in preorder.
+//
+// Leaf is set for classification leaves, while
+// Regression is set for regression and multi-output
+// leaves.
+// A leaf has no children, a NumSplit node is followed
+// by its LessEqual and Greater subtrees (or by one
+// subtree per branch, if Thresholds is set), and a
+// ValSplit node is followed by one subtree per entry in
+// Values.
+type gobNode struct {
+	Leaf            bool
+	Regression      bool
+	Classification  map[Class]float64
+	Classifications []map[Class]float64
+	Attr            Attr
+	Threshold       Val
+	Order           []Val
+	Thresholds      []Val
+	Values          []Val
+	Fallback        map[Class]float64
+	Surrogates      []Surrogate
+	MissingValue    Val
+	Gain            float64
+	Weight          float64
+	SampleCount     int
+	Value           float64
+}
+
+// GobEncode encodes the tree with encoding/gob.
+func (t *Tree) GobEncode() ([]byte, error) {
+	var nodes []gobNode
+	var addNodes func(t *Tree)
+	addNodes = func(t *Tree) {
+		node := gobNode{
+			Leaf:            t.Classification != nil,
+			Regression:      t.Classification == nil && t.leaf(),
+			Classification:  t.Classification,
+			Classifications: t.Classifications,
+			Attr:            t.Attr,
+			Gain:            t.Gain,
+			Weight:          t.Weight,
+			SampleCount:     t.SampleCount,
+			Value:           t.Value,
+			Surrogates:      t.Surrogates,
+			MissingValue:    t.MissingValue,
+		}
+		if t.NumSplit != nil {
+			node.Threshold = t.NumSplit.Threshold
+			node.Order = t.NumSplit.Order
+			node.Thresholds = t.NumSplit.Thresholds
+			nodes = append(nodes, node)
+			for _, child := range t.NumSplit.branches() {
+				addNodes(child)
+			}
+			return
+		}
+		node.Fallback = t.Fallback
+		var children []*Tree
+		for _, val := range t.SortedValSplitKeys() {
+			node.Values = append(node.Values, val)
+			children = append(children, t.ValSplit[val])
+		}
+		nodes = append(nodes, node)
+		for _, child := range children {
+			addNodes(child)
+		}
+	}
+	addNodes(t)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(nodes); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode decodes a tree which was encoded with
+// GobEncode.
+func (t *Tree) GobDecode(data []byte) error {
+	var nodes []gobNode
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&nodes); err != nil {
+		return err
+	}
+
+	var nextNode func() (*Tree, error)
+	nextNode = func() (*Tree, error) {
+		if len(nodes) == 0 {
+			return nil, errors.New("missing tree node")
+		}
+		node := nodes[0]
+		nodes = nodes[1:]
+		res := &Tree{Attr: node.Attr, Gain: node.Gain, Weight: node.Weight,
+			SampleCount: node.SampleCount, Value: node.Value, Surrogates: node.Surrogates,
+			MissingValue: node.MissingValue}
+		if node.Regression {
+			res.Classifications = node.Classifications
+		}
+		if node.Leaf {
+			res.Classification = node.Classification
+			if res.Classification == nil {
+				res.Classification = map[Class]float64{}
+			}
+		} else if len(node.Thresholds) > 0 {
+			res.NumSplit = &NumSplit{Thresholds: node.Thresholds}
+			for range node.Thresholds {
+				child, err := nextNode()
+				if err != nil {
+					return nil, err
+				}
+				res.NumSplit.Branches = append(res.NumSplit.Branches, child)
+			}
+			child, err := nextNode()
+			if err != nil {
+				return nil, err
+			}
+			res.NumSplit.Branches = append(res.NumSplit.Branches, child)
+		} else if node.Threshold != nil {
+			less, err := nextNode()
+			if err != nil {
+				return nil, err
+			}
+			greater, err := nextNode()
+			if err != nil {
+				return nil, err
+			}
+			res.NumSplit = &NumSplit{
+				Threshold: node.Threshold,
+				Order:     node.Order,
+				LessEqual: less,
+				Greater:   greater,
+			}
+		} else if !node.Regression {
+			res.ValSplit = ValSplit{}
+			res.Fallback = node.Fallback
+			for _, val := range node.Values {
+				child, err := nextNode()
+				if err != nil {
+					return nil, err
+				}
+				res.ValSplit[val] = child
+			}
+		}
+		return res, nil
+	}
+
+	res, err := nextNode()
+	if err != nil {
+		return err
+	}
+	if len(nodes) != 0 {
+		return errors.New("extra tree nodes")
+	}
+	*t = *res
+	return nil
+}
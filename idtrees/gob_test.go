@@ -0,0 +1,57 @@
+package idtrees
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+type gobTestClass struct {
+	Name string
+}
+
+func TestTreeGob(t *testing.T) {
+	RegisterGobTypes(gobTestClass{})
+
+	samples := []Sample{
+		treeTestSample{"age": int64(3), "height": 2.0, "color": "red",
+			"class": gobTestClass{"child"}},
+		treeTestSample{"age": int64(5), "height": 3.0, "color": "blue",
+			"class": gobTestClass{"child"}},
+		treeTestSample{"age": int64(30), "height": 5.5, "color": "red", "class": "adult"},
+		treeTestSample{"age": int64(32), "height": 5.0, "color": "blue", "class": "adult"},
+		treeTestSample{"age": int64(40), "height": 6.0, "color": "green", "class": "senior"},
+	}
+	tree := &Tree{
+		Attr: "kind",
+		ValSplit: ValSplit{
+			nil:   ID3(samples, []Attr{"age", "height", "color"}, 1),
+			"new": &Tree{Classification: map[Class]float64{}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(tree); err != nil {
+		t.Fatal(err)
+	}
+	var decoded *Tree
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !treesEqual(tree, decoded) {
+		t.Fatalf("expected %s but got %s", tree, decoded)
+	}
+	for _, s := range samples {
+		expected := tree.Classify(s)
+		actual := decoded.Classify(s)
+		if len(expected) != len(actual) {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+		for class, prob := range expected {
+			if actual[class] != prob {
+				t.Errorf("expected %v but got %v", expected, actual)
+			}
+		}
+	}
+}
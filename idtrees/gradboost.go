@@ -0,0 +1,81 @@
+package idtrees
+
+// gradientBoostDepth is the maximum depth of the
+// regression tree trained at each stage of GradientBoost.
+const gradientBoostDepth = 3
+
+// A BoostedRegressor is an ensemble of regression trees
+// which were trained with gradient boosting.
+type BoostedRegressor struct {
+	// Initial is the prediction before any trees are
+	// applied, i.e. the mean training target.
+	Initial float64
+
+	// LearningRate scales the prediction of every tree.
+	LearningRate float64
+
+	// Trees contains one regression tree per stage.
+	Trees []*Tree
+}
+
+// GradientBoost trains a BoostedRegressor with the given
+// number of stages, where each sample's Class is a
+// float64 target.
+//
+// Each stage fits a shallow regression tree to the
+// residuals of the ensemble so far, which are the
+// negative gradients of the squared error.
+// The tree's predictions are scaled by lr before being
+// added to the ensemble.
+func GradientBoost(samples []Sample, attrs []Attr, stages int, lr float64) *BoostedRegressor {
+	res := &BoostedRegressor{
+		Initial:      newVarianceCounter(samples).mean,
+		LearningRate: lr,
+	}
+
+	residuals := make([]*residualSample, len(samples))
+	stageSamples := make([]Sample, len(samples))
+	for i, s := range samples {
+		residuals[i] = &residualSample{
+			Sample:   s,
+			residual: s.Class().(float64) - res.Initial,
+		}
+		stageSamples[i] = residuals[i]
+	}
+
+	builder := &Builder{Regression: true, MaxDepth: gradientBoostDepth}
+	for stage := 0; stage < stages; stage++ {
+		tree := builder.Build(stageSamples, attrs)
+		res.Trees = append(res.Trees, tree)
+		for _, s := range residuals {
+			s.residual -= lr * tree.Predict(s)
+		}
+	}
+
+	return res
+}
+
+// Predict computes the ensemble's prediction for the
+// sample.
+func (b *BoostedRegressor) Predict(s AttrMap) float64 {
+	res := b.Initial
+	for _, tree := range b.Trees {
+		res += b.LearningRate * tree.Predict(s)
+	}
+	return res
+}
+
+// A residualSample replaces the target of a sample with
+// its current residual.
+type residualSample struct {
+	Sample
+	residual float64
+}
+
+func (r *residualSample) Class() Class {
+	return r.residual
+}
+
+func (r *residualSample) Weight() float64 {
+	return sampleWeight(r.Sample)
+}
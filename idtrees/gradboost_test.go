@@ -0,0 +1,37 @@
+package idtrees
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGradientBoost(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 200; i++ {
+		x := float64(i) / 20
+		samples = append(samples, treeTestSample{"x": x, "class": math.Sin(x) * x})
+	}
+	attrs := []Attr{"x"}
+
+	lastError := math.Inf(1)
+	for _, stages := range []int{1, 5, 20, 80} {
+		regressor := GradientBoost(samples, attrs, stages, 0.3)
+		if len(regressor.Trees) != stages {
+			t.Fatalf("expected %d trees but got %d", stages, len(regressor.Trees))
+		}
+		var sqError float64
+		for _, s := range samples {
+			diff := regressor.Predict(s) - s.Class().(float64)
+			sqError += diff * diff
+		}
+		sqError /= float64(len(samples))
+		if sqError >= lastError {
+			t.Errorf("%d stages: error %f did not decrease from %f", stages, sqError,
+				lastError)
+		}
+		lastError = sqError
+	}
+	if lastError > 0.05 {
+		t.Errorf("final error too large: %f", lastError)
+	}
+}
@@ -0,0 +1,182 @@
+package idtrees
+
+// maxNumBins is the largest number of bins which
+// Builder.NumBins can request, so that bin indices fit
+// in a uint16 along with missingBin.
+const maxNumBins = 1<<16 - 1
+
+// missingBin is the bin index of samples which are
+// missing a binned attribute.
+const missingBin = maxNumBins
+
+// attrBins stores the bins of a numerical attribute for
+// histogram splits.
+//
+// Bin k holds the samples whose values are greater than
+// Thresholds[k-1] and at most Thresholds[k].
+type attrBins struct {
+	Thresholds []Val
+
+	// Indices maps sample indices to bin indices, or to
+	// missingBin for samples which are missing the
+	// attribute.
+	Indices []uint16
+}
+
+// useBins checks if numerical attributes should be
+// binned for histogram splits.
+// Histograms count classes by their indices, so they
+// are only used for classification trees, and ExtraTrees
+// picks its own random thresholds instead.
+func (b *id3Builder) useBins() bool {
+	return b.NumBins > 1 && b.numClasses > 0 && !b.ExtraTrees
+}
+
+// binAttr bins a numerical attribute, given the known
+// samples sorted by the attribute.
+// The bin boundaries are the cutoffs between distinct
+// values which are nearest to evenly-spaced quantiles,
+// so samples with equal values share a bin.
+func (b *id3Builder) binAttr(sorted []Sample, attr Attr, numSamples int) *attrBins {
+	cutoffIdxs, cutoffs := numericCutoffs(sorted, attr)
+	numBins := b.NumBins
+	if numBins > maxNumBins {
+		numBins = maxNumBins
+	}
+	cutoffIdxs, cutoffs = quantileCutoffs(len(sorted), cutoffIdxs, cutoffs, numBins-1)
+
+	res := &attrBins{
+		Thresholds: cutoffs,
+		Indices:    make([]uint16, numSamples),
+	}
+	for i := range res.Indices {
+		res.Indices[i] = missingBin
+	}
+	var bin int
+	for i, s := range sorted {
+		if bin < len(cutoffIdxs) && i == cutoffIdxs[bin] {
+			bin++
+		}
+		res.Indices[sampleIndex(s)] = uint16(bin)
+	}
+	return res
+}
+
+// createHistogramSplit finds the best threshold split
+// for a binned attribute.
+// It also returns the samples which are missing the
+// attribute, which the split does not include.
+//
+// Rather than sorting the samples, it counts the class
+// weights in each bin and only tries splits between
+// bins, so the samples' values are only needed to place
+// the final threshold.
+func (b *id3Builder) createHistogramSplit(samples []Sample, attr Attr,
+	bins *attrBins) (*potentialSplit, []Sample) {
+	numBins := len(bins.Thresholds) + 1
+	numClasses := b.numClasses
+	hist := make([]float64, numBins*numClasses)
+	binCounts := make([]int, numBins)
+	var missing []Sample
+	for _, s := range samples {
+		indexed := unwrapIndexed(s)
+		bin := int(bins.Indices[indexed.index])
+		if bin == missingBin {
+			missing = append(missing, s)
+			continue
+		}
+		hist[bin*numClasses+indexed.classIndex] += sampleWeight(s)
+		binCounts[bin]++
+	}
+	numKnown := len(samples) - len(missing)
+	if numKnown == 0 {
+		return nil, missing
+	}
+
+	less := &indexedCounter{classWeights: make([]float64, numClasses)}
+	greater := &indexedCounter{classWeights: make([]float64, numClasses)}
+	for bin := 0; bin < numBins; bin++ {
+		for class, w := range hist[bin*numClasses : (bin+1)*numClasses] {
+			if w != 0 {
+				greater.updateWeight(class, w)
+			}
+		}
+	}
+
+	best := &potentialSplit{Attr: attr}
+	bestBin, nextBin := -1, -1
+	lastBin := -1
+	var lessCount int
+	countDivider := 1 / greater.TotalWeight()
+	for bin := 0; bin < numBins; bin++ {
+		if binCounts[bin] == 0 {
+			continue
+		}
+		if bestBin >= 0 && bestBin == lastBin {
+			// This is the first non-empty bin after the
+			// best split so far.
+			nextBin = bin
+		}
+		lastBin = bin
+		for class, w := range hist[bin*numClasses : (bin+1)*numClasses] {
+			if w != 0 {
+				less.updateWeight(class, w)
+				greater.updateWeight(class, -w)
+			}
+		}
+		lessCount += binCounts[bin]
+		if lessCount == numKnown {
+			break
+		}
+		if lessCount < b.MinSamplesLeaf || numKnown-lessCount < b.MinSamplesLeaf {
+			continue
+		}
+		if !b.heavyEnough(less.TotalWeight()) || !b.heavyEnough(greater.TotalWeight()) {
+			continue
+		}
+		lessE := b.impurity(less)
+		greaterE := b.impurity(greater)
+		entropy := countDivider * (less.TotalWeight()*lessE +
+			greater.TotalWeight()*greaterE)
+		if entropy < best.Entropy || bestBin < 0 {
+			bestBin = bin
+			best.Entropy = entropy
+			best.NumSplitEntropies[0] = lessE
+			best.NumSplitEntropies[1] = greaterE
+		}
+	}
+	if bestBin < 0 {
+		return nil, missing
+	}
+
+	// Like an exact split, the threshold is the midpoint
+	// of the closest values on either side in this node,
+	// which may be farther apart than at the root.
+	// These values are in the nearest non-empty bins.
+	var below, above Val
+	for _, s := range samples {
+		bin := int(bins.Indices[sampleIndex(s)])
+		if bin == missingBin {
+			continue
+		}
+		if bin > bestBin {
+			best.NumSplitSamples[1] = append(best.NumSplitSamples[1], s)
+			if bin == nextBin {
+				val := numericValue(s.Attr(attr))
+				if above == nil || numericGreater(above, val) {
+					above = val
+				}
+			}
+		} else {
+			best.NumSplitSamples[0] = append(best.NumSplitSamples[0], s)
+			if bin == bestBin {
+				val := numericValue(s.Attr(attr))
+				if below == nil || numericGreater(val, below) {
+					below = val
+				}
+			}
+		}
+	}
+	best.Threshold = numericThreshold(below, above)
+	return best, missing
+}
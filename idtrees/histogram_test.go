@@ -0,0 +1,125 @@
+package idtrees
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestID3NumBins(t *testing.T) {
+	attrs := []Attr{0, 1, 2, 3}
+
+	// With a bin for every distinct value, histogram
+	// splits try the same thresholds as exact splits.
+	// Their gains are summed in a different order, so they
+	// are compared with Equal's tolerance.
+	for seed := int64(0); seed < 10; seed++ {
+		rand.Seed(seed)
+		samples := presortTestSamples(500, 4)
+		for _, builder := range []Builder{{}, {Criterion: Gini}, {MaxLeafNodes: 20}} {
+			expected := builder.Build(samples, attrs)
+			builder.NumBins = len(samples)
+			actual := builder.Build(samples, attrs)
+			if !actual.Equal(expected) {
+				t.Errorf("seed %d, builder %+v: tree differs from exact splits", seed, builder)
+			}
+		}
+	}
+
+	rand.Seed(1337)
+	samples := presortTestSamples(500, 4)
+
+	builder := &Builder{NumBins: 8, MinSamplesLeaf: 5}
+	b := builder.newID3Builder(nil)
+	b.presort(samples, attrs)
+	for _, attr := range attrs {
+		bins := b.bins[attr]
+		if bins == nil || len(bins.Thresholds) != 7 {
+			t.Fatalf("attr %v: expected 8 bins", attr)
+		}
+		counts := make([]int, 8)
+		for _, idx := range bins.Indices {
+			counts[idx]++
+		}
+		for bin, count := range counts {
+			if count < 40 || count > 90 {
+				t.Errorf("attr %v: bin %d has %d samples", attr, bin, count)
+			}
+		}
+	}
+
+	tree := builder.Build(samples, attrs)
+	if tree.leaf() {
+		t.Fatal("expected a split")
+	}
+	var checkNode func(node *Tree, indices []int)
+	checkNode = func(node *Tree, indices []int) {
+		if node.leaf() {
+			if len(indices) < 5 {
+				t.Errorf("leaf has %d samples", len(indices))
+			}
+			return
+		}
+		// Each split must fall between two bins, and its
+		// threshold must be the midpoint of the closest real
+		// values on either side.
+		bins := b.bins[node.Attr]
+		var less, greater []int
+		var below, above Val
+		maxLessBin, minGreaterBin := -1, len(bins.Thresholds)+1
+		for _, idx := range indices {
+			val := samples[idx].Attr(node.Attr)
+			bin := int(bins.Indices[idx])
+			if numericGreater(val, node.NumSplit.Threshold) {
+				greater = append(greater, idx)
+				if above == nil || numericGreater(above, val) {
+					above = val
+				}
+				if bin < minGreaterBin {
+					minGreaterBin = bin
+				}
+			} else {
+				less = append(less, idx)
+				if below == nil || numericGreater(val, below) {
+					below = val
+				}
+				if bin > maxLessBin {
+					maxLessBin = bin
+				}
+			}
+		}
+		if maxLessBin >= minGreaterBin {
+			t.Errorf("split on %v does not fall between bins", node.Attr)
+		}
+		if below == nil || above == nil {
+			t.Errorf("split on %v has an empty branch", node.Attr)
+			return
+		} else if node.NumSplit.Threshold != numericThreshold(below, above) {
+			t.Errorf("attr %v: threshold %v is not between %v and %v", node.Attr,
+				node.NumSplit.Threshold, below, above)
+		}
+		checkNode(node.NumSplit.LessEqual, less)
+		checkNode(node.NumSplit.Greater, greater)
+	}
+	var indices []int
+	for i := range samples {
+		indices = append(indices, i)
+	}
+	checkNode(tree, indices)
+
+	// Missing values are still handled.
+	for i, s := range samples {
+		if i%10 == 0 {
+			delete(s.(treeTestSample), 0)
+		}
+	}
+	tree = (&Builder{NumBins: 8, MaxSurrogates: 1}).Build(samples, attrs)
+	for _, s := range samples {
+		if tree.ClassifyOne(s) == nil {
+			t.Fatal("sample was not classified")
+		}
+	}
+}
+
+func BenchmarkID3NumBins(b *testing.B) {
+	benchmarkNumeric(b, &Builder{NumBins: 32})
+}
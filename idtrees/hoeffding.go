@@ -0,0 +1,280 @@
+package idtrees
+
+import "math"
+
+const (
+	defaultHoeffdingDelta        = 1e-7
+	defaultHoeffdingGracePeriod  = 200
+	defaultHoeffdingTieThreshold = 0.05
+)
+
+// A HoeffdingTree grows a classification tree from a
+// stream of samples, as in the VFDT algorithm.
+//
+// Rather than rebuilding the tree as samples arrive, each
+// leaf accumulates statistics about the samples which
+// reach it, and it is split once the Hoeffding bound shows
+// that the best attribute is better than the second best
+// with high confidence.
+//
+// Only categorical attributes are supported, and the
+// resulting splits are ValSplits.
+type HoeffdingTree struct {
+	// Attrs are the categorical attributes which may be
+	// used for splits.
+	Attrs []Attr
+
+	// Delta is the probability that a split picks the
+	// wrong attribute.
+	// If it is 0, 1e-7 is used.
+	Delta float64
+
+	// GracePeriod is the number of samples which a leaf
+	// must receive between attempts to split it.
+	// If it is 0, 200 is used.
+	GracePeriod int
+
+	// TieThreshold is the Hoeffding bound below which the
+	// best attribute is used even if it is not clearly
+	// better than the second best, since the two are
+	// nearly tied.
+	// If it is 0, 0.05 is used.
+	TieThreshold float64
+
+	// Tree is the current tree, which is a single leaf
+	// until the first split.
+	// It should not be modified directly, but it may be
+	// used to classify samples between updates.
+	// Update modifies the tree in place, so classifying
+	// samples while Update is running is a data race;
+	// callers which do both from different Goroutines
+	// must synchronize them, e.g. with a sync.RWMutex.
+	//
+	// Before the first update, Tree may be set to a
+	// classification tree which was already trained, such
+	// as one from a Builder, so that the stream of samples
+	// refines it.
+	// Each of its leaves starts with the class weights
+	// given by its Classification and Weight, and its
+	// existing splits, including NumSplits, are kept.
+	Tree *Tree
+
+	stats map[*Tree]*hoeffdingStats
+}
+
+// hoeffdingStats stores the statistics of a leaf of a
+// HoeffdingTree.
+type hoeffdingStats struct {
+	classWeights map[Class]float64
+
+	// attrWeights maps attributes and their values to the
+	// class weights of the samples with those values.
+	attrWeights map[Attr]map[Val]map[Class]float64
+
+	// sinceCheck is the number of samples which reached
+	// the leaf since the last attempt to split it.
+	sinceCheck int
+}
+
+func newHoeffdingStats(classWeights map[Class]float64) *hoeffdingStats {
+	return &hoeffdingStats{
+		classWeights: classWeights,
+		attrWeights:  map[Attr]map[Val]map[Class]float64{},
+	}
+}
+
+// NewHoeffdingTree creates a HoeffdingTree which may
+// split on the given categorical attributes.
+func NewHoeffdingTree(attrs []Attr) *HoeffdingTree {
+	return &HoeffdingTree{Attrs: attrs}
+}
+
+// Update adds a sample to the statistics of the leaf
+// which it reaches, splitting the leaf if possible.
+//
+// If the sample has a missing value for one of the splits
+// along its path, it is ignored.
+// If the sample has a value which matches no branch of a
+// split, a new branch is added for the value.
+func (h *HoeffdingTree) Update(s Sample) {
+	if h.Tree == nil {
+		h.Tree = &Tree{Classification: map[Class]float64{}}
+	}
+	if h.stats == nil {
+		h.stats = map[*Tree]*hoeffdingStats{}
+	}
+
+	t := h.Tree
+	for !t.leaf() {
+		val := t.value(s)
+		if val == nil {
+			return
+		}
+		child := t.child(val)
+		if child == nil {
+			child = &Tree{Classification: map[Class]float64{}}
+			t.ValSplit[val] = child
+			h.stats[child] = newHoeffdingStats(map[Class]float64{})
+		}
+		t.Weight += sampleWeight(s)
+		t = child
+	}
+
+	stats := h.leafStats(t)
+	w := sampleWeight(s)
+	stats.classWeights[s.Class()] += w
+	for _, attr := range h.Attrs {
+		val := s.Attr(attr)
+		if val == nil {
+			continue
+		}
+		if stats.attrWeights[attr] == nil {
+			stats.attrWeights[attr] = map[Val]map[Class]float64{}
+		}
+		if stats.attrWeights[attr][val] == nil {
+			stats.attrWeights[attr][val] = map[Class]float64{}
+		}
+		stats.attrWeights[attr][val][s.Class()] += w
+	}
+	setHoeffdingLeaf(t, stats.classWeights)
+
+	stats.sinceCheck++
+	if stats.sinceCheck >= h.gracePeriod() {
+		stats.sinceCheck = 0
+		h.trySplit(t, stats)
+	}
+}
+
+// leafStats returns the statistics of a leaf, creating
+// them from the leaf's distribution if the leaf was not
+// created by Update.
+func (h *HoeffdingTree) leafStats(t *Tree) *hoeffdingStats {
+	if stats := h.stats[t]; stats != nil {
+		return stats
+	}
+	if t.Classification == nil {
+		panic("HoeffdingTree only supports classification trees")
+	}
+	classWeights := map[Class]float64{}
+	for class, prob := range t.Classification {
+		classWeights[class] = prob * t.Weight
+	}
+	stats := newHoeffdingStats(classWeights)
+	h.stats[t] = stats
+	return stats
+}
+
+// trySplit splits a leaf if the Hoeffding bound allows it.
+func (h *HoeffdingTree) trySplit(t *Tree, stats *hoeffdingStats) {
+	if len(stats.classWeights) < 2 || t.Weight <= 0 {
+		return
+	}
+	parentEntropy := distributionEntropy(stats.classWeights)
+
+	var bestAttr Attr
+	var bestGain, secondGain float64
+	for _, attr := range h.Attrs {
+		valWeights := stats.attrWeights[attr]
+		if len(valWeights) < 2 {
+			continue
+		}
+		var totalWeight, entropy float64
+		for _, weights := range valWeights {
+			for _, w := range weights {
+				totalWeight += w
+			}
+		}
+		for _, val := range sortedVals(valWeights) {
+			var weight float64
+			for _, w := range valWeights[val] {
+				weight += w
+			}
+			entropy += weight / totalWeight * distributionEntropy(valWeights[val])
+		}
+		gain := parentEntropy - entropy
+		if bestAttr == nil || gain > bestGain {
+			bestAttr, bestGain, secondGain = attr, gain, bestGain
+		} else if gain > secondGain {
+			secondGain = gain
+		}
+	}
+	if bestAttr == nil || bestGain <= 0 {
+		return
+	}
+
+	valueRange := math.Log(float64(len(stats.classWeights)))
+	bound := math.Sqrt(valueRange * valueRange * math.Log(1/h.delta()) / (2 * t.Weight))
+	if bestGain-secondGain <= bound && bound >= h.tieThreshold() {
+		return
+	}
+
+	delete(h.stats, t)
+	*t = Tree{Attr: bestAttr, ValSplit: ValSplit{}, Gain: bestGain, Weight: t.Weight}
+	for val, weights := range stats.attrWeights[bestAttr] {
+		child := &Tree{}
+		setHoeffdingLeaf(child, weights)
+		t.ValSplit[val] = child
+		h.stats[child] = newHoeffdingStats(weights)
+	}
+}
+
+func (h *HoeffdingTree) delta() float64 {
+	if h.Delta == 0 {
+		return defaultHoeffdingDelta
+	}
+	return h.Delta
+}
+
+func (h *HoeffdingTree) gracePeriod() int {
+	if h.GracePeriod == 0 {
+		return defaultHoeffdingGracePeriod
+	}
+	return h.GracePeriod
+}
+
+func (h *HoeffdingTree) tieThreshold() float64 {
+	if h.TieThreshold == 0 {
+		return defaultHoeffdingTieThreshold
+	}
+	return h.TieThreshold
+}
+
+// setHoeffdingLeaf sets the classification and weight of
+// a leaf from its class weights.
+func setHoeffdingLeaf(t *Tree, classWeights map[Class]float64) {
+	t.Classification = map[Class]float64{}
+	t.Weight = 0
+	for _, w := range classWeights {
+		t.Weight += w
+	}
+	if t.Weight <= 0 {
+		return
+	}
+	for class, w := range classWeights {
+		if w > 0 {
+			t.Classification[class] = w / t.Weight
+		}
+	}
+}
+
+// distributionEntropy computes the entropy of a class
+// distribution, given the weight of each class.
+func distributionEntropy(classWeights map[Class]float64) float64 {
+	counter := &entropyCounter{classWeights: map[Class]float64{}}
+	for class, w := range classWeights {
+		counter.addClass(class)
+		counter.updateWeight(class, w)
+	}
+	return counter.exactEntropy()
+}
+
+// sortedVals returns the keys of a map from values, sorted
+// by their string representations.
+func sortedVals(m map[Val]map[Class]float64) []Val {
+	res := make([]Val, 0, len(m))
+	for val := range m {
+		res = append(res, val)
+	}
+	sortVals(res)
+	return res
+}
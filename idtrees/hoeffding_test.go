@@ -0,0 +1,85 @@
+package idtrees
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestHoeffdingTree(t *testing.T) {
+	rng := rand.New(rand.NewSource(1337))
+	colors := []string{"red", "green", "blue"}
+	shapes := []string{"circle", "square"}
+	h := NewHoeffdingTree([]Attr{"shape", "color"})
+	for i := 0; i < 5000; i++ {
+		color := colors[rng.Intn(len(colors))]
+		h.Update(treeTestSample{
+			"color": color,
+			"shape": shapes[rng.Intn(len(shapes))],
+			"class": color == "red",
+		})
+	}
+
+	if h.Tree.Attr != "color" || len(h.Tree.ValSplit) != 3 {
+		t.Fatalf("unexpected tree: %s", h.Tree)
+	}
+	if h.Tree.Weight != 5000 {
+		t.Errorf("expected weight 5000 but got %f", h.Tree.Weight)
+	}
+	for _, color := range colors {
+		for _, shape := range shapes {
+			s := treeTestSample{"color": color, "shape": shape}
+			if class := h.Tree.ClassifyOne(s); class != (color == "red") {
+				t.Errorf("color %s, shape %s: got %v", color, shape, class)
+			}
+		}
+	}
+	numNodes := h.Tree.NumNodes()
+	for i := 0; i < 1000; i++ {
+		h.Update(treeTestSample{"color": "red", "shape": "circle", "class": true})
+	}
+	if h.Tree.NumNodes() != numNodes {
+		t.Errorf("pure leaf was split: %s", h.Tree)
+	}
+}
+
+func TestHoeffdingTreeTrained(t *testing.T) {
+	rng := rand.New(rand.NewSource(1337))
+	colors := []string{"red", "green", "blue"}
+	sample := func(redClass bool) treeTestSample {
+		color := colors[rng.Intn(len(colors))]
+		x := rng.Float64()
+		return treeTestSample{
+			"color": color,
+			"x":     x,
+			"class": x > 0.5 && (color == "red") == redClass,
+		}
+	}
+	var samples []Sample
+	for i := 0; i < 500; i++ {
+		samples = append(samples, sample(true))
+	}
+	trained := (&Builder{MaxDepth: 1}).Build(samples, []Attr{"x"})
+	if trained.NumSplit == nil {
+		t.Fatalf("expected a numerical split: %s", trained)
+	}
+
+	h := NewHoeffdingTree([]Attr{"color"})
+	h.GracePeriod = 50
+	h.Tree = trained
+	for i := 0; i < 5000; i++ {
+		h.Update(sample(false))
+	}
+	if h.Tree.NumSplit == nil || h.Tree.Weight != 5500 {
+		t.Fatalf("unexpected root: %s", h.Tree)
+	}
+	greater := h.Tree.NumSplit.Greater
+	if greater.Attr != "color" || len(greater.ValSplit) != 3 {
+		t.Fatalf("expected a color split above the threshold: %s", h.Tree)
+	}
+	for _, color := range colors {
+		s := treeTestSample{"color": color, "x": 0.9}
+		if class := h.Tree.ClassifyOne(s); class != (color != "red") {
+			t.Errorf("color %s: got %v", color, class)
+		}
+	}
+}
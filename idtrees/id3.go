@@ -1,39 +1,852 @@
 package idtrees
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
+	"math/rand"
 	"runtime"
 	"sort"
 	"sync"
 )
 
+// A Criterion is an impurity measure used to decide
+// which split is best at a node.
+type Criterion int
+
+const (
+	// Entropy measures impurity as the Shannon entropy
+	// of the class distribution.
+	Entropy Criterion = iota
+
+	// Gini measures impurity as the Gini impurity of
+	// the class distribution, as done in CART.
+	// It is cheaper to compute than Entropy.
+	Gini
+)
+
+// An AttrType declares how an attribute is split.
+type AttrType int
+
+const (
+	// InferAttr infers the type of an attribute from its
+	// values, as described in AttrMap.
+	InferAttr AttrType = iota
+
+	// NumericAttr splits an attribute with thresholds.
+	// Its values may be of any of the numeric types
+	// described in AttrMap, and they need not all have
+	// the same type.
+	// If any value is a float, the thresholds are float64
+	// values.
+	NumericAttr
+
+	// CategoricalAttr splits an attribute with a branch
+	// per value, even if its values are numbers.
+	CategoricalAttr
+)
+
+// A Builder generates Trees using the ID3 algorithm.
+//
+// Samples which implement WeightedSample contribute to
+// impurities and leaf probabilities in proportion to
+// their weights.
+//
+// The zero value of a Builder generates the same trees
+// as ID3 with maxGos set to 0.
+type Builder struct {
+	// MaxGos specifies the maximum number of Goroutines
+	// to use during tree generation.
+	// If MaxGos is 0, then GOMAXPROCS is used.
+	MaxGos int
+
+	// MaxDepth, if non-zero, is the maximum depth of
+	// the generated tree, as defined by LimitedID3.
+	MaxDepth int
+
+	// MinSamplesLeaf, if non-zero, is the minimum
+	// number of training samples which may reach any
+	// leaf.
+	// Splits which would produce smaller branches are
+	// not considered.
+	MinSamplesLeaf int
+
+	// MinWeightFractionLeaf, if non-zero, is the minimum
+	// fraction of the total weight of the training
+	// samples which may reach any leaf.
+	// It is like MinSamplesLeaf, but it counts the weights
+	// of the samples rather than the samples themselves.
+	// Splits which would produce lighter branches are not
+	// considered.
+	MinWeightFractionLeaf float64
+
+	// MinGain is the minimum decrease in impurity that
+	// a split must achieve to be used.
+	// Nodes for which no split achieves this gain are
+	// turned into leaves.
+	MinGain float64
+
+	// MinImpurityDecrease, if non-zero, is the minimum
+	// weighted decrease in impurity that a split must
+	// achieve to be used, as in scikit-learn.
+	// The decrease of a split is its gain scaled by the
+	// fraction of the total training weight which reaches
+	// the node, so splits deep in the tree, which affect
+	// few samples, need larger gains than splits near the
+	// root.
+	MinImpurityDecrease float64
+
+	// Criterion is the impurity measure used to pick
+	// splits.
+	Criterion Criterion
+
+	// SplitCriterion, if non-nil, is a custom impurity
+	// measure which is used instead of Criterion.
+	// In this case, LogBase is ignored.
+	SplitCriterion SplitCriterion
+
+	// LogBase is the base of the logarithm used to
+	// compute entropy.
+	// For example, a LogBase of 2 measures entropy in
+	// bits.
+	// If LogBase is 0, the natural logarithm is used,
+	// measuring entropy in nats.
+	LogBase float64
+
+	// Regression, if true, makes the Builder generate
+	// regression trees.
+	// In this case, every sample's Class must be a
+	// float64 target, splits minimize the weighted
+	// variance of the targets, and leaves store the mean
+	// target in Tree.Value.
+	// The Criterion, SplitCriterion, and LogBase fields
+	// are ignored.
+	Regression bool
+
+	// MaxLeafNodes, if non-zero, is the maximum number
+	// of leaves in the generated tree.
+	// In this case, the tree is grown best-first, as
+	// described in ID3BestFirst.
+	MaxLeafNodes int
+
+	// OrderedAttrs maps ordered categorical attributes to
+	// their values, listed from smallest to largest.
+	// These attributes are split with binary thresholds,
+	// like numerical attributes, rather than with a
+	// branch per value.
+	// Every non-nil value of such an attribute must
+	// appear in its ordering.
+	OrderedAttrs map[Attr][]Val
+
+	// GainRatio, if true, makes the Builder choose splits
+	// by their gain ratio, as done in C4.5.
+	// The gain ratio of a split is its decrease in
+	// impurity divided by the entropy of the fractions
+	// of samples sent down each branch.
+	// This counters the bias of plain information gain
+	// towards attributes with many distinct values.
+	GainRatio bool
+
+	// NoReuseCategoricalAttrs, if true, prevents an
+	// attribute from being used by more than one
+	// categorical split along any path, as in classic
+	// ID3.
+	// Once a node splits on a categorical attribute, the
+	// attribute is no longer considered in the subtrees
+	// below it.
+	// Numerical and ordered attributes may always be
+	// reused.
+	NoReuseCategoricalAttrs bool
+
+	// ChiSquareThreshold, if non-zero, is the largest
+	// p-value with which a categorical split may be
+	// used, as in CHAID.
+	// Before a categorical split is considered, a
+	// chi-square test of independence is run between the
+	// attribute's values and the classes.
+	// If the p-value exceeds ChiSquareThreshold, the
+	// association is not significant and the split is
+	// discarded.
+	// This is ignored for regression trees.
+	ChiSquareThreshold float64
+
+	// MaxSurrogates is the maximum number of surrogate
+	// splits to store for each split node, as in CART.
+	// A surrogate split uses a different attribute to
+	// mimic a node's split, and it routes samples which
+	// are missing the node's attribute at prediction
+	// time.
+	// If MaxSurrogates is 0, no surrogates are stored.
+	MaxSurrogates int
+
+	// MaxThresholds, if non-zero, limits the number of
+	// thresholds which are tried for each numerical split.
+	// Rather than trying a cutoff between every pair of
+	// distinct values, the split only tries the cutoffs
+	// nearest to MaxThresholds evenly-spaced quantiles of
+	// the samples.
+	// This speeds up training on continuous attributes,
+	// at the cost of possibly missing the best threshold.
+	MaxThresholds int
+
+	// NumBins, if greater than 1, enables histogram
+	// splits, as in LightGBM.
+	// Each numerical attribute is binned once, at the
+	// root, into at most NumBins bins of roughly equal
+	// size, and splits throughout the tree are found by
+	// counting the classes in each bin instead of sorting
+	// the samples by their values.
+	// Only thresholds between bins are tried, and they are
+	// midpoints between real values, as with other
+	// numerical splits.
+	// Values above 65535 are treated as 65535.
+	//
+	// NumBins applies to classification trees, and it is
+	// ignored for regression, multi-output, and
+	// ExtraTrees trees.
+	NumBins int
+
+	// NumericBranches, if greater than 2, allows splits on
+	// integer and floating-point attributes to have up to
+	// NumericBranches branches, each of which covers a
+	// range of values.
+	// The thresholds are chosen greedily: starting from
+	// the best binary split, the range whose best binary
+	// split reduces the impurity the most is split again,
+	// until there are NumericBranches ranges or no split
+	// reduces the impurity.
+	//
+	// Multi-way splits have no surrogates, and they are
+	// not used for histogram splits (see NumBins),
+	// ExtraTrees, or attributes with MonotoneConstraints.
+	NumericBranches int
+
+	// MissingValues maps attributes to sentinel values,
+	// such as -1 or "NA", which indicate missing values.
+	// During training, samples with a sentinel value are
+	// handled as if the value were nil.
+	// The sentinels are also stored in the tree, in the
+	// MissingValue fields of its nodes and surrogates, so
+	// that they are treated as missing when classifying.
+	// A sentinel only matches values of the same type.
+	MissingValues map[Attr]Val
+
+	// ClassWeights, if non-nil, scales the weight of each
+	// sample by the weight of its class.
+	// Classes which are not in the map have a weight of 1.
+	// The scaled weights are used for impurities, leaf
+	// probabilities, and node weights alike.
+	ClassWeights map[Class]float64
+
+	// BalancedClassWeights, if true, weights each class
+	// inversely to its frequency in the training samples,
+	// so that every class has the same total weight.
+	// As in scikit-learn's "balanced" mode, the weight of
+	// a class is the total weight of the samples divided
+	// by the number of classes times the total weight of
+	// the class.
+	// It overrides ClassWeights.
+	//
+	// ClassWeights and BalancedClassWeights are ignored
+	// for regression and multi-output trees.
+	BalancedClassWeights bool
+
+	// OnNode, if non-nil, is called every time a node of
+	// the tree is created, with the depth of the node (0
+	// for the root) and the number of samples at it.
+	// It may be used to report progress while building
+	// large trees.
+	//
+	// OnNode is always called from the Goroutine which is
+	// building the tree, never concurrently.
+	OnNode func(depth int, numSamples int)
+
+	// MonotoneConstraints, if non-nil, forces the
+	// predictions of a regression tree to be monotonic in
+	// some numerical attributes.
+	// A constraint of 1 means that predictions never
+	// decrease as the attribute increases, -1 means that
+	// they never increase, and 0 means no constraint.
+	//
+	// Splits whose branch means go the wrong way are not
+	// considered, and leaf targets are clamped so that
+	// leaves deeper in the tree cannot break the
+	// constraints either.
+	// MonotoneConstraints is ignored for classification.
+	MonotoneConstraints map[Attr]int
+
+	// ExtraTrees, if true, builds extremely randomized
+	// trees: rather than searching every threshold of a
+	// numerical attribute, each node tries one threshold
+	// per attribute, drawn uniformly between the smallest
+	// and largest values at the node.
+	// The best of these random splits is used.
+	// Ordered and categorical attributes are split as
+	// usual.
+	ExtraTrees bool
+
+	// MaxFeatures, if non-zero, is the number of
+	// attributes to consider at each node.
+	// A new random subset of the attributes is drawn for
+	// every node, which speeds up training on wide data
+	// and acts as a regularizer.
+	MaxFeatures int
+
+	// Rand is the source of randomness for ExtraTrees and
+	// MaxFeatures.
+	// If it is nil, the global source from math/rand is
+	// used.
+	// The random numbers are drawn in a fixed order, so
+	// a seeded source gives the same tree for any MaxGos.
+	Rand *rand.Rand
+
+	// MinCategoryCount, if non-zero, is the minimum number
+	// of samples at a node which must share a value of a
+	// categorical attribute for the value to get its own
+	// branch.
+	// Rarer values are grouped into a single branch keyed
+	// by OtherValue, which is also taken by values that
+	// were never seen during training.
+	MinCategoryCount int
+
+	// Alpha, if non-zero, is a pseudo-count which is added
+	// to the weight of every class at each leaf before
+	// the leaf's probabilities are computed (Laplace
+	// smoothing).
+	// The classes are all the classes of the training
+	// samples, so leaves with few samples never predict
+	// probabilities of exactly 0 or 1.
+	// Alpha is ignored for regression and multi-output
+	// trees.
+	Alpha float64
+
+	// CategoricalAttrs lists numerical attributes which
+	// should be split with a branch per value, like
+	// non-numerical attributes, rather than with a
+	// threshold.
+	// This is useful for codes and identifiers, such as
+	// zip codes, which are stored as numbers but have no
+	// meaningful order.
+	CategoricalAttrs map[Attr]bool
+
+	// AttrTypes, if non-nil, declares the types of some or
+	// all of the attributes, so that they need not be
+	// inferred from the values of the samples.
+	// Inference uses the first sample with a known value
+	// at each node, so it fails if the samples mix
+	// integers and floats, or numbers and other values.
+	//
+	// A declared type takes precedence over
+	// CategoricalAttrs, but not over OrderedAttrs.
+	// Building a tree panics if any value of a NumericAttr
+	// is not a number; MissingValues can be used to skip
+	// values like "NA".
+	AttrTypes map[Attr]AttrType
+
+	// LeafSamples, if true, makes every leaf record the
+	// indices of the training samples which reached it in
+	// its SampleIndices field.
+	// This is useful for auditing the training data, but
+	// it uses memory proportional to the number of
+	// samples.
+	LeafSamples bool
+
+	// BinaryCategorical, if true, splits categorical
+	// attributes into two groups of values rather than
+	// into a branch per value.
+	// The values are sorted by their mean target for
+	// regression trees, or by the fraction of their
+	// samples in the node's most common class otherwise,
+	// and the split is the best threshold in this order,
+	// stored as a NumSplit with an Order.
+	// This finds the best grouping for regression and
+	// for two classes (Breiman et al., 1984), and is a
+	// greedy approximation for more classes.
+	//
+	// MinCategoryCount does not apply to these splits,
+	// and BinaryCategorical is ignored for multi-output
+	// trees.
+	BinaryCategorical bool
+}
+
+// OtherValue is the key of the ValSplit branch which
+// holds rare values when Builder.MinCategoryCount is
+// used.
+// Values which match no other branch of such a split
+// take this branch.
+const OtherValue = "__other__"
+
+// Build generates a Tree for the samples using the
+// given attributes.
+func (b *Builder) Build(samples []Sample, attrs []Attr) *Tree {
+	return b.build(nil, samples, attrs, b.maxDepth())
+}
+
+// BuildContext is like Build, but it stops early if the
+// context is done before the tree is complete, in which
+// case ctx.Err() is returned.
+//
+// Unlike Build, it returns ErrNoSamples or
+// ErrNoAttributes rather than a lone leaf if there is
+// nothing to train on.
+func (b *Builder) BuildContext(ctx context.Context, samples []Sample,
+	attrs []Attr) (*Tree, error) {
+	if err := checkInputs(samples, attrs); err != nil {
+		return nil, err
+	}
+	tree := b.build(ctx, samples, attrs, b.maxDepth())
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// checkInputs returns an error if a tree cannot be
+// trained on the samples and attributes.
+func checkInputs(samples []Sample, attrs []Attr) error {
+	if len(samples) == 0 {
+		return ErrNoSamples
+	} else if len(attrs) == 0 {
+		return ErrNoAttributes
+	}
+	return nil
+}
+
+func (b *Builder) maxDepth() int {
+	if b.MaxDepth == 0 {
+		return -1
+	}
+	return b.MaxDepth
+}
+
+func (b *Builder) build(ctx context.Context, samples []Sample, attrs []Attr,
+	maxDepth int) *Tree {
+	return b.newID3Builder(ctx).build(samples, attrs, maxDepth)
+}
+
+func (b *Builder) newID3Builder(ctx context.Context) *id3Builder {
+	s := &id3Builder{Builder: *b, ctx: ctx, entropyScale: 1}
+	if s.MaxGos == 0 {
+		s.MaxGos = runtime.GOMAXPROCS(0)
+	}
+	if s.LogBase != 0 {
+		s.entropyScale = 1 / math.Log(s.LogBase)
+	}
+	s.sem = make(chan struct{}, s.MaxGos)
+	return s
+}
+
+func (s *id3Builder) build(samples []Sample, attrs []Attr, maxDepth int) *Tree {
+	s.sparseAttrs = sparseSampleAttrs(samples)
+	samples = s.classWeighted(samples)
+	if len(s.MissingValues) > 0 {
+		wrapped := make([]Sample, len(samples))
+		for i, sample := range samples {
+			wrapped[i] = &sentinelSample{Sample: sample, sentinels: s.MissingValues}
+		}
+		samples = wrapped
+	}
+	tree := s.grow(s.typedSamples(samples), attrs, maxDepth)
+	if len(s.MissingValues) > 0 {
+		setMissingValues(tree, s.MissingValues)
+	}
+	return tree
+}
+
+func (s *id3Builder) grow(samples []Sample, attrs []Attr, maxDepth int) *Tree {
+	counter := s.newCounter(samples)
+	baseImpurity := s.impurity(counter)
+	s.totalWeight = counter.TotalWeight()
+	if s.Alpha != 0 && !s.Regression && s.numOutputs == 0 {
+		s.classes = newEntropyCounter(samples).classes
+	}
+	root := s.presort(samples, attrs)
+	if s.MaxLeafNodes > 0 {
+		return s.bestFirst(root, attrs, maxDepth, baseImpurity)
+	}
+	return s.id3(root, attrs, maxDepth, baseImpurity)
+}
+
+// These errors are returned when there is nothing to
+// train a tree on.
+var (
+	ErrNoSamples    = errors.New("no training samples")
+	ErrNoAttributes = errors.New("no attributes to split on")
+)
+
 // ID3 generates a Tree using the ID3 algorithm.
 //
 // The maxGos argument specifies the maximum number
 // of Goroutines to use during tree generation.
 // If maxGos is 0, then GOMAXPROCS is used.
+//
+// If there are no samples, the result is a leaf with an
+// empty classification.
+// If there are no attributes, the result is a single
+// leaf for all the samples.
+// Use CheckedID3 to get an error in these cases instead.
 func ID3(samples []Sample, attrs []Attr, maxGos int) *Tree {
 	return LimitedID3(samples, attrs, maxGos, -1)
 }
 
+// CheckedID3 is like ID3, but it returns ErrNoSamples or
+// ErrNoAttributes if there is nothing to train on.
+func CheckedID3(samples []Sample, attrs []Attr, maxGos int) (*Tree, error) {
+	if err := checkInputs(samples, attrs); err != nil {
+		return nil, err
+	}
+	return ID3(samples, attrs, maxGos), nil
+}
+
 // LimitedID3 is like ID3, but it will never produce a
 // tree deeper than maxDepth.
 // The depth of the tree is counted as the number of
 // branches needed to get to a leaf.
 // Thus, a tree with no branches has depth 0.
 func LimitedID3(samples []Sample, attrs []Attr, maxGos, maxDepth int) *Tree {
-	if maxGos == 0 {
-		maxGos = runtime.GOMAXPROCS(0)
+	b := &Builder{MaxGos: maxGos}
+	return b.build(nil, samples, attrs, maxDepth)
+}
+
+// ID3Context is like ID3, but it stops early and returns
+// ctx.Err() if the context is done before the tree is
+// complete.
+func ID3Context(ctx context.Context, samples []Sample, attrs []Attr,
+	maxGos int) (*Tree, error) {
+	b := &Builder{MaxGos: maxGos}
+	return b.BuildContext(ctx, samples, attrs)
+}
+
+// ID3WithBudget is like ID3Context, but rather than
+// returning an error when the context is done, it stops
+// expanding nodes and returns the tree built so far, in
+// which every unexpanded node is a leaf.
+//
+// The tree is grown best-first, as with
+// Builder.MaxLeafNodes, so a tree which is cut short
+// contains the splits with the largest gains.
+// If the context is never done, the result is the same
+// as the tree from ID3.
+func ID3WithBudget(ctx context.Context, samples []Sample, attrs []Attr,
+	maxGos int) *Tree {
+	b := &Builder{MaxGos: maxGos, MaxLeafNodes: math.MaxInt32}
+	return b.build(ctx, samples, attrs, -1)
+}
+
+// id3Builder stores the state used while generating a
+// tree with a Builder.
+type id3Builder struct {
+	Builder
+
+	// ctx may be nil if the build cannot be cancelled.
+	ctx context.Context
+
+	// sem holds one token per running Goroutine, limiting
+	// the total number of Goroutines to MaxGos even when
+	// work is parallelized within a single attribute.
+	// It may be nil, in which case no nested parallelism
+	// is used.
+	sem chan struct{}
+
+	entropyScale float64
+
+	// scratch maps sample indices to samples while
+	// partitioning presorted samples.
+	scratch []Sample
+
+	// numClasses is the number of distinct classes, if
+	// presort has assigned each sample a class index.
+	// Otherwise, it is 0.
+	numClasses int
+
+	// numOutputs is the number of outputs of a
+	// multi-output tree, or 0 for other trees.
+	numOutputs int
+
+	// totalWeight is the total weight of the training
+	// samples, which is used for MinImpurityDecrease and
+	// MinWeightFractionLeaf.
+	totalWeight float64
+
+	// classes lists the classes of the training samples,
+	// which are smoothed by Alpha.
+	classes []Class
+
+	// sparseAttrs maps sample indices to the attributes of
+	// SparseSamples, or is nil if some of the training
+	// samples are not SparseSamples.
+	sparseAttrs [][]Attr
+
+	// bins maps numerical attributes to their bins when
+	// NumBins is used.
+	// Binned attributes are not presorted.
+	bins map[Attr]*attrBins
+}
+
+// acquire blocks until a Goroutine token is available.
+func (b *id3Builder) acquire() {
+	if b.sem != nil {
+		b.sem <- struct{}{}
+	}
+}
+
+// tryAcquire takes a Goroutine token if one is available
+// without blocking, and reports whether it did.
+func (b *id3Builder) tryAcquire() bool {
+	if b.sem == nil {
+		return false
+	}
+	select {
+	case b.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release returns a token taken by acquire or tryAcquire.
+func (b *id3Builder) release() {
+	if b.sem != nil {
+		<-b.sem
+	}
+}
+
+// cancelled returns true if the build has been cancelled,
+// in which case all remaining nodes become leaves.
+func (b *id3Builder) cancelled() bool {
+	if b.ctx == nil {
+		return false
+	}
+	select {
+	case <-b.ctx.Done():
+		return true
+	default:
+		return false
 	}
-	baseEntropy := newEntropyCounter(samples).Entropy()
-	return id3(samples, attrs, maxGos, maxDepth, baseEntropy)
 }
 
-func id3(samples []Sample, attrs []Attr, maxGos, maxDepth int, entropy float64) *Tree {
-	if entropy == 0 || maxDepth == 0 {
-		return createLeaf(samples)
+func (b *id3Builder) id3(node *nodeSamples, attrs []Attr, maxDepth int,
+	entropy float64) *Tree {
+	b.onNode(node)
+	if !b.canSplit(node.Samples, maxDepth, entropy) {
+		return b.createLeaf(node)
 	}
 
+	bestSplit := b.bestSplit(node, attrs, entropy)
+	if bestSplit == nil {
+		return b.createLeaf(node)
+	}
+
+	if bestSplit.Thresholds != nil {
+		res := &Tree{
+			Attr:        bestSplit.Attr,
+			NumSplit:    &NumSplit{Thresholds: bestSplit.Thresholds},
+			Gain:        entropy - bestSplit.Entropy,
+			SampleCount: len(node.Samples),
+		}
+		for i, samples := range bestSplit.MultiSplitSamples {
+			tree := b.id3(b.partition(node, samples), attrs, maxDepth-1,
+				bestSplit.MultiSplitEntropies[i])
+			res.NumSplit.Branches = append(res.NumSplit.Branches, tree)
+			res.Weight += tree.Weight
+		}
+		return res
+	}
+
+	if bestSplit.Threshold != nil {
+		lessNode, greaterNode := b.partitionNumeric(node, bestSplit)
+		less := b.id3(lessNode, attrs, maxDepth-1, bestSplit.NumSplitEntropies[0])
+		greater := b.id3(greaterNode, attrs, maxDepth-1, bestSplit.NumSplitEntropies[1])
+		return &Tree{
+			Attr: bestSplit.Attr,
+			NumSplit: &NumSplit{
+				Threshold: bestSplit.Threshold,
+				Order:     bestSplit.Order,
+				LessEqual: less,
+				Greater:   greater,
+			},
+			Gain:        entropy - bestSplit.Entropy,
+			Weight:      less.Weight + greater.Weight,
+			SampleCount: len(node.Samples),
+			Surrogates:  b.surrogates(node, attrs, bestSplit),
+		}
+	}
+
+	res := &Tree{
+		Attr:        bestSplit.Attr,
+		ValSplit:    ValSplit{},
+		Gain:        entropy - bestSplit.Entropy,
+		SampleCount: len(node.Samples),
+		Surrogates:  b.surrogates(node, attrs, bestSplit),
+	}
+	childAttrs := b.childAttrs(attrs, bestSplit)
+
+	// Branches are built in a fixed order, so that the
+	// random draws of their nodes do not depend on the
+	// order of map iteration.
+	for _, val := range sortedSplitVals(bestSplit.ValSplitSamples) {
+		samples := bestSplit.ValSplitSamples[val]
+		tree := b.id3(b.partition(node, samples), childAttrs, maxDepth-1,
+			bestSplit.ValSplitEntropies[val])
+		res.ValSplit[val] = tree
+		res.Weight += tree.Weight
+	}
+	b.setFallback(res)
+	return res
+}
+
+// onNode calls OnNode for a new node.
+func (b *id3Builder) onNode(node *nodeSamples) {
+	if b.OnNode != nil {
+		b.OnNode(node.Depth, len(node.Samples))
+	}
+}
+
+// childAttrs returns the attributes to consider in the
+// branches of a categorical split.
+func (b *id3Builder) childAttrs(attrs []Attr, split *potentialSplit) []Attr {
+	if !b.NoReuseCategoricalAttrs {
+		return attrs
+	}
+	res := make([]Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		if attr != split.Attr {
+			res = append(res, attr)
+		}
+	}
+	return res
+}
+
+// canSplit returns false if a node must be a leaf
+// without considering any splits.
+func (b *id3Builder) canSplit(samples []Sample, maxDepth int, entropy float64) bool {
+	return entropy != 0 && maxDepth != 0 && len(samples) >= 2*b.MinSamplesLeaf &&
+		!pure(samples) && !b.cancelled()
+}
+
+// pure returns true if all the samples have the same
+// class.
+// Pure nodes are never split, even if rounding errors
+// give them a tiny positive impurity.
+func pure(samples []Sample) bool {
+	for _, s := range samples[1:] {
+		if s.Class() != samples[0].Class() {
+			return false
+		}
+	}
+	return true
+}
+
+// bestSplit finds the best split of the samples, or
+// returns nil if no split is good enough to use.
+func (b *id3Builder) bestSplit(node *nodeSamples, attrs []Attr,
+	entropy float64) *potentialSplit {
+	attrs = b.nodeAttrs(b.presentAttrs(node.Samples, attrs))
+	node.Counter = b.newCounter(node.Samples)
+	if b.ExtraTrees {
+		node.RandomCuts = make(map[Attr]float64, len(attrs))
+		for _, attr := range attrs {
+			node.RandomCuts[attr] = randFloat64(b.Rand)
+		}
+	}
+
+	var bestSplit *potentialSplit
+	if b.MaxGos == 1 {
+		bestSplit = b.sequentialBestSplit(node, attrs, entropy)
+	} else {
+		bestSplit = b.parallelBestSplit(node, attrs, entropy)
+	}
+	if bestSplit == nil || bestSplit.Entropy >= entropy ||
+		entropy-bestSplit.Entropy < b.MinGain || bestSplit.numBranches() < 2 ||
+		!b.enoughDecrease(node, entropy-bestSplit.Entropy) {
+		return nil
+	}
+	return bestSplit
+}
+
+// sparseSampleAttrs lists the attributes of every sample
+// if they are all SparseSamples, or returns nil
+// otherwise.
+func sparseSampleAttrs(samples []Sample) [][]Attr {
+	res := make([][]Attr, len(samples))
+	for i, s := range samples {
+		sparse, ok := s.(SparseSample)
+		if !ok {
+			return nil
+		}
+		res[i] = sparse.Attrs()
+	}
+	return res
+}
+
+// presentAttrs filters the attributes down to the ones
+// which some of the samples have, if the training samples
+// are SparseSamples.
+// The samples must have been indexed by presort.
+func (b *id3Builder) presentAttrs(samples []Sample, attrs []Attr) []Attr {
+	if b.sparseAttrs == nil {
+		return attrs
+	}
+	present := map[Attr]bool{}
+	for _, s := range samples {
+		for _, attr := range b.sparseAttrs[sampleIndex(s)] {
+			present[attr] = true
+		}
+	}
+	res := make([]Attr, 0, len(present))
+	for _, attr := range attrs {
+		if present[attr] {
+			res = append(res, attr)
+		}
+	}
+	return res
+}
+
+// nodeAttrs picks the attributes to consider at a node,
+// which are all of the attributes unless MaxFeatures is
+// set.
+func (b *id3Builder) nodeAttrs(attrs []Attr) []Attr {
+	if b.MaxFeatures <= 0 || b.MaxFeatures >= len(attrs) {
+		return attrs
+	}
+	res := make([]Attr, len(attrs))
+	copy(res, attrs)
+	for i := 0; i < b.MaxFeatures; i++ {
+		idx := randIntn(b.Rand, len(res)-i) + i
+		res[i], res[idx] = res[idx], res[i]
+	}
+	return res[:b.MaxFeatures]
+}
+
+// sequentialBestSplit finds the best potential split on
+// the calling Goroutine, without any channels or extra
+// Goroutines.
+// It is used when MaxGos is 1, and it produces the same
+// splits as parallelBestSplit.
+func (b *id3Builder) sequentialBestSplit(node *nodeSamples, attrs []Attr,
+	entropy float64) *potentialSplit {
+	var bestSplit *potentialSplit
+	for _, attr := range attrs {
+		if b.cancelled() {
+			break
+		}
+		split := b.createPotentialSplit(node, attr)
+		if split == nil {
+			continue
+		}
+		split.Score = b.splitScore(split, entropy)
+		if bestSplit == nil || split.betterThan(bestSplit) {
+			bestSplit = split
+		}
+	}
+	return bestSplit
+}
+
+// parallelBestSplit finds the best potential split,
+// considering attributes on up to MaxGos Goroutines.
+func (b *id3Builder) parallelBestSplit(node *nodeSamples, attrs []Attr,
+	entropy float64) *potentialSplit {
 	attrChan := make(chan Attr, len(attrs))
 	for _, a := range attrs {
 		attrChan <- a
@@ -42,14 +855,27 @@ func id3(samples []Sample, attrs []Attr, maxGos, maxDepth int, entropy float64)
 
 	splitChan := make(chan *potentialSplit)
 
+	// Tokens are taken before starting each worker, so
+	// that the number of live Goroutines never exceeds the
+	// limit, no matter how many nodes are being split.
+	numWorkers := b.MaxGos
+	if len(attrs) < numWorkers {
+		numWorkers = len(attrs)
+	}
 	var wg sync.WaitGroup
-	for i := 0; i < maxGos; i++ {
+	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
+		b.acquire()
 		go func() {
 			defer wg.Done()
+			defer b.release()
 			for attr := range attrChan {
-				split := createPotentialSplit(samples, attr)
+				if b.cancelled() {
+					return
+				}
+				split := b.createPotentialSplit(node, attr)
 				if split != nil {
+					split.Score = b.splitScore(split, entropy)
 					splitChan <- split
 				}
 			}
@@ -62,51 +888,97 @@ func id3(samples []Sample, attrs []Attr, maxGos, maxDepth int, entropy float64)
 
 	var bestSplit *potentialSplit
 	for split := range splitChan {
-		if bestSplit == nil || split.Entropy < bestSplit.Entropy {
+		if bestSplit == nil || split.betterThan(bestSplit) {
 			bestSplit = split
 		}
 	}
+	return bestSplit
+}
 
-	if bestSplit == nil || bestSplit.Entropy >= entropy ||
-		bestSplit.numBranches() < 2 {
-		return createLeaf(samples)
+// enoughDecrease checks if the gain of a split at a node
+// satisfies MinImpurityDecrease.
+func (b *id3Builder) enoughDecrease(node *nodeSamples, gain float64) bool {
+	if b.MinImpurityDecrease == 0 {
+		return true
+	}
+	if b.totalWeight <= 0 {
+		return false
 	}
+	fraction := node.Counter.TotalWeight() / b.totalWeight
+	return fraction*gain >= b.MinImpurityDecrease
+}
 
-	if bestSplit.Threshold != nil {
-		less := id3(bestSplit.NumSplitSamples[0], attrs, maxGos, maxDepth-1,
-			bestSplit.NumSplitEntropies[0])
-		greater := id3(bestSplit.NumSplitSamples[1], attrs, maxGos, maxDepth-1,
-			bestSplit.NumSplitEntropies[1])
-		return &Tree{
-			Attr: bestSplit.Attr,
-			NumSplit: &NumSplit{
-				Threshold: bestSplit.Threshold,
-				LessEqual: less,
-				Greater:   greater,
-			},
+func (b *id3Builder) createLeaf(node *nodeSamples) *Tree {
+	var leaf *Tree
+	if b.Regression {
+		leaf = createRegressionLeaf(node.Samples)
+		if len(b.MonotoneConstraints) > 0 {
+			leaf.Value = math.Max(node.Lower, math.Min(node.Upper, leaf.Value))
+		}
+	} else if b.numOutputs > 0 {
+		leaf = createMultiLeaf(node.Samples, b.numOutputs)
+	} else if b.classes != nil {
+		leaf = createSmoothedLeaf(node.Samples, b.classes, b.Alpha)
+	} else {
+		leaf = createLeaf(node.Samples)
+	}
+	leaf.SampleCount = len(node.Samples)
+	if b.LeafSamples {
+		leaf.SampleIndices = make([]int, len(node.Samples))
+		for i, s := range node.Samples {
+			leaf.SampleIndices[i] = sampleIndex(s)
 		}
+		sort.Ints(leaf.SampleIndices)
 	}
+	return leaf
+}
+
+// setFallback sets the Fallback of a ValSplit node whose
+// branches have been built.
+// Regression and multi-output trees have no Fallback.
+func (b *id3Builder) setFallback(t *Tree) {
+	if !b.Regression && b.numOutputs == 0 {
+		t.Fallback = mergedClassification(t)
+	}
+}
 
+// createLeaf creates a leaf whose classification is the
+// weighted class distribution of the samples.
+//
+// If there are no samples, or their total weight is not
+// positive, the classification is empty rather than NaN.
+// Classify treats such leaves as unreachable.
+func createLeaf(samples []Sample) *Tree {
+	counter := newEntropyCounter(samples)
 	res := &Tree{
-		Attr:     bestSplit.Attr,
-		ValSplit: ValSplit{},
+		Classification: map[Class]float64{},
+		Weight:         counter.totalWeight,
 	}
-	for class, samples := range bestSplit.ValSplitSamples {
-		tree := id3(samples, attrs, maxGos, maxDepth-1, bestSplit.ValSplitEntropies[class])
-		res.ValSplit[class] = tree
+	if counter.totalWeight <= 0 {
+		return res
+	}
+	totalScaler := 1 / counter.totalWeight
+	for class, weight := range counter.classWeights {
+		if weight > 0 {
+			res.Classification[class] = weight * totalScaler
+		}
 	}
 	return res
 }
 
-func createLeaf(samples []Sample) *Tree {
-	counts := map[Class]int{}
-	for _, s := range samples {
-		counts[s.Class()]++
+// createSmoothedLeaf is like createLeaf, but it adds a
+// pseudo-count of alpha to the weight of every class.
+// A leaf with no samples predicts a uniform distribution.
+func createSmoothedLeaf(samples []Sample, classes []Class, alpha float64) *Tree {
+	counter := newEntropyCounter(samples)
+	res := &Tree{
+		Classification: map[Class]float64{},
+		Weight:         counter.totalWeight,
 	}
-	res := &Tree{Classification: map[Class]float64{}}
-	totalScaler := 1 / float64(len(samples))
-	for class, count := range counts {
-		res.Classification[class] = float64(count) * totalScaler
+	totalScaler := 1 / (math.Max(0, counter.totalWeight) + alpha*float64(len(classes)))
+	for _, class := range classes {
+		weight := math.Max(0, counter.classWeights[class])
+		res.Classification[class] = (weight + alpha) * totalScaler
 	}
 	return res
 }
@@ -115,19 +987,105 @@ type potentialSplit struct {
 	Attr    Attr
 	Entropy float64
 
+	// Score is used to compare splits of the same node.
+	// Lower scores are better.
+	Score float64
+
 	ValSplitEntropies map[Val]float64
 	ValSplitSamples   map[Val][]Sample
 
 	Threshold         Val
+	Order             []Val
 	NumSplitEntropies [2]float64
 	NumSplitSamples   [2][]Sample
+
+	// Thresholds, MultiSplitEntropies, and
+	// MultiSplitSamples are used instead of Threshold and
+	// the NumSplit fields for multi-way splits.
+	Thresholds          []Val
+	MultiSplitEntropies []float64
+	MultiSplitSamples   [][]Sample
+}
+
+// scoreTolerance is the relative difference below which
+// split scores are tied.
+// Incrementally maintained entropies depend on the order
+// of additions and removals, so splits with the same
+// class counts may have scores a few ulps apart.
+const scoreTolerance = 1e-12
+
+// betterThan returns true if p has a lower score than s.
+// Ties, including scores within scoreTolerance, are
+// broken in favor of the attribute with the
+// lexicographically smaller string representation, so
+// that the chosen split does not depend on the order in
+// which goroutines finish.
+func (p *potentialSplit) betterThan(s *potentialSplit) bool {
+	scale := math.Max(1, math.Max(math.Abs(p.Score), math.Abs(s.Score)))
+	if math.Abs(p.Score-s.Score) > scoreTolerance*scale {
+		return p.Score < s.Score
+	}
+	return fmt.Sprintf("%v", p.Attr) < fmt.Sprintf("%v", s.Attr)
+}
+
+// splitScore computes the score of a split of a node
+// with the given impurity.
+// Without GainRatio, this is the impurity of the split.
+// With GainRatio, it is the negative gain ratio.
+func (b *id3Builder) splitScore(split *potentialSplit, entropy float64) float64 {
+	if !b.GainRatio {
+		return split.Entropy
+	}
+	splitInfo := b.splitInfo(split)
+	if splitInfo == 0 {
+		// A split with a single partition gains nothing.
+		return 0
+	}
+	return -(entropy - split.Entropy) / splitInfo
+}
+
+// splitInfo computes the intrinsic information of a
+// split, i.e. the entropy of the weights of its branches.
+func (b *id3Builder) splitInfo(split *potentialSplit) float64 {
+	var weights []float64
+	if split.Thresholds != nil {
+		for _, s := range split.MultiSplitSamples {
+			weights = append(weights, b.newCounter(s).TotalWeight())
+		}
+	} else if split.Threshold != nil {
+		for _, s := range split.NumSplitSamples {
+			weights = append(weights, b.newCounter(s).TotalWeight())
+		}
+	} else {
+		for _, s := range split.ValSplitSamples {
+			weights = append(weights, b.newCounter(s).TotalWeight())
+		}
+	}
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	var info float64
+	for _, w := range weights {
+		if w > 0 {
+			p := w / total
+			info -= p * math.Log(p)
+		}
+	}
+	return info * b.entropyScale
 }
 
 // numBranches returns the number of non-empty branches
 // resulting from the split.
 func (p *potentialSplit) numBranches() int {
 	var count int
-	if p.Threshold != nil {
+	if p.Thresholds != nil {
+		for _, split := range p.MultiSplitSamples {
+			if len(split) > 0 {
+				count++
+			}
+		}
+	} else if p.Threshold != nil {
 		if len(p.NumSplitSamples[0]) > 0 {
 			count++
 		}
@@ -144,19 +1102,110 @@ func (p *potentialSplit) numBranches() int {
 	return count
 }
 
-func createPotentialSplit(samples []Sample, attr Attr) *potentialSplit {
-	if len(samples) == 0 {
+func (b *id3Builder) createPotentialSplit(node *nodeSamples, attr Attr) *potentialSplit {
+	if len(node.Samples) == 0 {
 		panic("cannot split 0 samples")
 	}
 
-	val1 := samples[0].Attr(attr)
-	switch val1.(type) {
-	case int64:
-		return createIntSplit(copySampleSlice(samples), attr)
-	case float64:
-		return createFloatSplit(copySampleSlice(samples), attr)
+	if bins := b.bins[attr]; bins != nil {
+		res, missing := b.createHistogramSplit(node.Samples, attr, bins)
+		if res != nil && len(missing) > 0 {
+			b.distributeMissing(res, missing)
+		}
+		return res
 	}
 
+	known, missing := splitMissing(node.Samples, attr)
+	if len(known) == 0 {
+		return nil
+	}
+
+	// The counts for the whole node give the initial
+	// counts of every threshold search, unless some of
+	// the samples are missing the attribute.
+	var total splitCounter
+	if len(missing) == 0 {
+		total = node.Counter
+	}
+
+	var res *potentialSplit
+	if order, ok := b.OrderedAttrs[attr]; ok {
+		res = b.createOrderedSplit(copySampleSlice(known), attr, order, total)
+	} else if b.categorical(attr) {
+		res = b.createCategoricalSplit(known, attr, total)
+	} else {
+		switch val := known[0].Attr(attr); val.(type) {
+		case int64, int, int8, int16, int32, uint, uint8, uint16, uint32, uint64,
+			float64, float32:
+			sorted := node.sorted(known, attr)
+			if cut, ok := node.RandomCuts[attr]; ok {
+				res = b.createRandomSplit(sorted, attr, cut, total)
+			} else if b.NumericBranches > 2 && b.MonotoneConstraints[attr] == 0 {
+				res = b.createMultiwaySplit(sorted, attr, total)
+			} else if _, ok := numericValue(val).(int64); ok {
+				res = b.createIntSplit(sorted, attr, total)
+			} else {
+				res = b.createFloatSplit(sorted, attr, total)
+			}
+		default:
+			res = b.createCategoricalSplit(known, attr, total)
+		}
+	}
+
+	if res != nil && len(missing) > 0 {
+		b.distributeMissing(res, missing)
+	}
+	return res
+}
+
+// createCategoricalSplit finds the best split of the
+// samples by a categorical attribute.
+func (b *id3Builder) createCategoricalSplit(samples []Sample, attr Attr,
+	total splitCounter) *potentialSplit {
+	if !b.BinaryCategorical || b.numOutputs > 0 {
+		return b.createValSplit(samples, attr)
+	}
+	order := b.categoryOrder(samples, attr)
+	if len(order) < 2 {
+		return nil
+	}
+	return b.createOrderedSplit(copySampleSlice(samples), attr, order, total)
+}
+
+// categoryOrder sorts the values of a categorical
+// attribute for BinaryCategorical.
+func (b *id3Builder) categoryOrder(samples []Sample, attr Attr) []Val {
+	var target Class
+	if !b.Regression {
+		target, _ = topClass(newEntropyCounter(samples).classWeights)
+	}
+	scores := map[Val]float64{}
+	weights := map[Val]float64{}
+	for _, s := range samples {
+		val := s.Attr(attr)
+		w := sampleWeight(s)
+		weights[val] += w
+		if b.Regression {
+			scores[val] += w * s.Class().(float64)
+		} else if s.Class() == target {
+			scores[val] += w
+		}
+	}
+	order := make([]Val, 0, len(weights))
+	for val, w := range weights {
+		if w > 0 {
+			scores[val] /= w
+		}
+		order = append(order, val)
+	}
+	sortVals(order)
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] < scores[order[j]]
+	})
+	return order
+}
+
+func (b *id3Builder) createValSplit(samples []Sample, attr Attr) *potentialSplit {
 	res := &potentialSplit{
 		Attr:              attr,
 		ValSplitEntropies: map[Val]float64{},
@@ -167,66 +1216,336 @@ func createPotentialSplit(samples []Sample, attr Attr) *potentialSplit {
 		v := s.Attr(attr)
 		res.ValSplitSamples[v] = append(res.ValSplitSamples[v], s)
 	}
+	if b.MinCategoryCount > 0 {
+		mergeRareVals(res.ValSplitSamples, b.MinCategoryCount)
+	}
+
+	for _, s := range res.ValSplitSamples {
+		if len(s) < b.MinSamplesLeaf || !b.heavyEnough(totalSampleWeight(s)) {
+			return nil
+		}
+	}
+
+	if b.ChiSquareThreshold != 0 && !b.Regression {
+		var branches [][]Sample
+		for _, s := range res.ValSplitSamples {
+			branches = append(branches, s)
+		}
+		if chiSquareIndependence(branches) > b.ChiSquareThreshold {
+			return nil
+		}
+	}
+
+	buckets := make([]*valBucket, 0, len(res.ValSplitSamples))
+	for _, attrVal := range sortedSplitVals(res.ValSplitSamples) {
+		buckets = append(buckets, &valBucket{val: attrVal,
+			samples: res.ValSplitSamples[attrVal]})
+	}
+	b.computeBuckets(buckets)
 
-	totalDivider := 1 / float64(len(samples))
-	for attrVal, s := range res.ValSplitSamples {
-		e := newEntropyCounter(s).Entropy()
-		res.ValSplitEntropies[attrVal] = e
-		res.Entropy += float64(len(s)) * totalDivider * e
+	var totalWeight float64
+	for _, bucket := range buckets {
+		res.ValSplitEntropies[bucket.val] = bucket.impurity
+		res.Entropy += bucket.weight * bucket.impurity
+		totalWeight += bucket.weight
 	}
+	res.Entropy /= totalWeight
 
 	return res
 }
 
-func createIntSplit(samples []Sample, attr Attr) *potentialSplit {
-	sorter := &intSorter{
-		sampleSorter: sampleSorter{
-			Attr:    attr,
-			Samples: samples,
-		},
+// mergeRareVals moves the samples of every value with
+// fewer than minCount samples into the OtherValue branch.
+func mergeRareVals(branches map[Val][]Sample, minCount int) {
+	var other []Sample
+	for _, val := range sortedSplitVals(branches) {
+		if samples := branches[val]; len(samples) < minCount {
+			other = append(other, samples...)
+			delete(branches, val)
+		}
 	}
-	sort.Sort(sorter)
+	if len(other) > 0 {
+		branches[OtherValue] = append(branches[OtherValue], other...)
+	}
+}
+
+// sortedSplitVals returns the values of a categorical
+// split sorted by their string representations.
+// Iterating over branches in this order keeps impurity
+// sums from depending on map iteration order.
+func sortedSplitVals(m map[Val][]Sample) []Val {
+	res := make([]Val, 0, len(m))
+	for val := range m {
+		res = append(res, val)
+	}
+	sortVals(res)
+	return res
+}
 
-	lastValue := sorter.Samples[0].Attr(attr).(int64)
+func sortVals(vals []Val) {
+	names := make(map[Val]string, len(vals))
+	for _, val := range vals {
+		names[val] = fmt.Sprintf("%v", val)
+	}
+	sort.SliceStable(vals, func(i, j int) bool {
+		return names[vals[i]] < names[vals[j]]
+	})
+}
+
+// A valBucket is one branch of a categorical split.
+type valBucket struct {
+	val     Val
+	samples []Sample
+
+	impurity float64
+	weight   float64
+}
+
+// computeBuckets computes the impurity and weight of
+// every bucket.
+//
+// The buckets are divided into contiguous chunks, and
+// chunks are processed on separate Goroutines whenever
+// a Goroutine token is free.
+// Otherwise, they are processed on the calling Goroutine.
+func (b *id3Builder) computeBuckets(buckets []*valBucket) {
+	numChunks := b.MaxGos
+	if numChunks > len(buckets) {
+		numChunks = len(buckets)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < numChunks; i++ {
+		chunk := buckets[i*len(buckets)/numChunks : (i+1)*len(buckets)/numChunks]
+		if i < numChunks-1 && b.tryAcquire() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer b.release()
+				b.computeChunk(chunk)
+			}()
+		} else {
+			b.computeChunk(chunk)
+		}
+	}
+	wg.Wait()
+}
+
+func (b *id3Builder) computeChunk(buckets []*valBucket) {
+	for _, bucket := range buckets {
+		counter := b.newCounter(bucket.samples)
+		bucket.impurity = b.impurity(counter)
+		bucket.weight = counter.TotalWeight()
+	}
+}
+
+// distributeMissing adds samples with a missing value
+// for the split attribute to every branch of the split.
+// Each sample's weight is scaled by the fraction of the
+// known samples' weight in the branch.
+//
+// The impurities of the split are updated accordingly.
+func (b *id3Builder) distributeMissing(split *potentialSplit, missing []Sample) {
+	if split.Thresholds != nil {
+		split.MultiSplitSamples, split.MultiSplitEntropies, split.Entropy =
+			b.addMissing(split.MultiSplitSamples, missing)
+		return
+	}
+	if split.Threshold != nil {
+		branches, entropies, entropy := b.addMissing(split.NumSplitSamples[:], missing)
+		copy(split.NumSplitSamples[:], branches)
+		copy(split.NumSplitEntropies[:], entropies)
+		split.Entropy = entropy
+		return
+	}
+
+	vals := sortedSplitVals(split.ValSplitSamples)
+	branches := make([][]Sample, len(vals))
+	for i, val := range vals {
+		branches[i] = split.ValSplitSamples[val]
+	}
+	branches, entropies, entropy := b.addMissing(branches, missing)
+	for i, val := range vals {
+		split.ValSplitSamples[val] = branches[i]
+		split.ValSplitEntropies[val] = entropies[i]
+	}
+	split.Entropy = entropy
+}
+
+// addMissing adds proportionally weighted missing samples
+// to each branch, returning the new branches, their
+// impurities, and the overall impurity of the split.
+func (b *id3Builder) addMissing(branches [][]Sample, missing []Sample) ([][]Sample,
+	[]float64, float64) {
+	branchWeights := make([]float64, len(branches))
+	var knownWeight float64
+	for i, branch := range branches {
+		branchWeights[i] = b.newCounter(branch).TotalWeight()
+		knownWeight += branchWeights[i]
+	}
+
+	newBranches := make([][]Sample, len(branches))
+	entropies := make([]float64, len(branches))
+	var entropy, totalWeight float64
+	for i, branch := range branches {
+		fraction := branchWeights[i] / knownWeight
+		newBranch := copySampleSlice(branch)
+		for _, s := range missing {
+			newBranch = append(newBranch, &scaledSample{Sample: s, scale: fraction})
+		}
+		counter := b.newCounter(newBranch)
+		newBranches[i] = newBranch
+		entropies[i] = b.impurity(counter)
+		entropy += counter.TotalWeight() * entropies[i]
+		totalWeight += counter.TotalWeight()
+	}
+	return newBranches, entropies, entropy / totalWeight
+}
+
+// createIntSplit finds the best threshold split for an
+// integer attribute, given the samples sorted by that
+// attribute.
+func (b *id3Builder) createIntSplit(samples []Sample, attr Attr,
+	total splitCounter) *potentialSplit {
+	sorter := sampleSorter{Attr: attr, Samples: samples}
+	cutoffIdxs, cutoffs := intCutoffs(samples, attr)
+	return b.createNumericSplit(sorter, cutoffIdxs, cutoffs, total)
+}
+
+// createFloatSplit finds the best threshold split for a
+// floating-point attribute, given the samples sorted by
+// that attribute.
+func (b *id3Builder) createFloatSplit(samples []Sample, attr Attr,
+	total splitCounter) *potentialSplit {
+	sorter := sampleSorter{Attr: attr, Samples: samples}
+	cutoffIdxs, cutoffs := floatCutoffs(samples, attr)
+	return b.createNumericSplit(sorter, cutoffIdxs, cutoffs, total)
+}
+
+// numericCutoffs finds every threshold between distinct
+// values of a numerical attribute, given the samples
+// sorted by the attribute.
+// Each threshold is paired with the index of the first
+// sample which is greater than it.
+func numericCutoffs(samples []Sample, attr Attr) ([]int, []Val) {
+	if _, ok := numericValue(samples[0].Attr(attr)).(int64); ok {
+		return intCutoffs(samples, attr)
+	}
+	return floatCutoffs(samples, attr)
+}
+
+func intCutoffs(samples []Sample, attr Attr) ([]int, []Val) {
+	lastValue := intValue(samples[0].Attr(attr))
 	var cutoffIdxs []int
 	var cutoffs []Val
-	for i := 1; i < len(sorter.Samples); i++ {
-		val := sorter.Samples[i].Attr(attr).(int64)
+	for i := 1; i < len(samples); i++ {
+		val := intValue(samples[i].Attr(attr))
 		if val > lastValue {
 			cutoffIdxs = append(cutoffIdxs, i)
-			cutoffs = append(cutoffs, lastValue+(val-lastValue)/2)
+			cutoffs = append(cutoffs, intMidpoint(lastValue, val))
 			lastValue = val
 		}
 	}
+	return cutoffIdxs, cutoffs
+}
+
+func floatCutoffs(samples []Sample, attr Attr) ([]int, []Val) {
+	lastValue := floatValue(samples[0].Attr(attr))
+	var cutoffIdxs []int
+	var cutoffs []Val
+	for i := 1; i < len(samples); i++ {
+		val := floatValue(samples[i].Attr(attr))
+		if val > lastValue {
+			cutoffIdxs = append(cutoffIdxs, i)
+			cutoffs = append(cutoffs, floatMidpoint(lastValue, val))
+			lastValue = val
+		}
+	}
+	return cutoffIdxs, cutoffs
+}
+
+// createRandomSplit creates a split on a numerical
+// attribute for ExtraTrees, given the samples sorted by
+// that attribute and a random number in [0, 1) which
+// picks the threshold.
+func (b *id3Builder) createRandomSplit(samples []Sample, attr Attr, cut float64,
+	total splitCounter) *potentialSplit {
+	sorter := sampleSorter{Attr: attr, Samples: samples}
+	first, last := samples[0].Attr(attr), samples[len(samples)-1].Attr(attr)
+
+	var threshold Val
+	if _, ok := numericValue(first).(int64); ok {
+		low, high := intValue(first), intValue(last)
+		if low == high {
+			return nil
+		}
+		threshold = low + int64(cut*float64(high-low))
+	} else {
+		low, high := floatValue(first), floatValue(last)
+		if low == high {
+			return nil
+		}
+		threshold = low + cut*(high-low)
+	}
 
-	return createNumericSplit(sorter.sampleSorter, cutoffIdxs, cutoffs)
+	cutoffIdx := sort.Search(len(samples), func(i int) bool {
+		return numericGreater(samples[i].Attr(attr), threshold)
+	})
+	if cutoffIdx == len(samples) {
+		return nil
+	}
+	return b.createNumericSplit(sorter, []int{cutoffIdx}, []Val{threshold}, total)
 }
 
-func createFloatSplit(samples []Sample, attr Attr) *potentialSplit {
-	sorter := &floatSorter{
+func (b *id3Builder) createOrderedSplit(samples []Sample, attr Attr,
+	order []Val, total splitCounter) *potentialSplit {
+	sorter := &orderedSorter{
 		sampleSorter: sampleSorter{
 			Attr:    attr,
 			Samples: samples,
 		},
+		indices: map[Val]int{},
+	}
+	for i, val := range order {
+		sorter.indices[val] = i
+	}
+	for _, s := range samples {
+		if _, ok := sorter.indices[s.Attr(attr)]; !ok {
+			panic(fmt.Sprintf("value %v of attribute %v is not in its ordering",
+				s.Attr(attr), attr))
+		}
 	}
 	sort.Sort(sorter)
 
-	lastValue := sorter.Samples[0].Attr(attr).(float64)
+	lastIdx := sorter.indices[sorter.Samples[0].Attr(attr)]
 	var cutoffIdxs []int
 	var cutoffs []Val
 	for i := 1; i < len(sorter.Samples); i++ {
-		val := sorter.Samples[i].Attr(attr).(float64)
-		if val > lastValue {
+		idx := sorter.indices[sorter.Samples[i].Attr(attr)]
+		if idx > lastIdx {
 			cutoffIdxs = append(cutoffIdxs, i)
-			cutoffs = append(cutoffs, lastValue+(val-lastValue)/2)
-			lastValue = val
+			cutoffs = append(cutoffs, order[lastIdx])
+			lastIdx = idx
 		}
 	}
 
-	return createNumericSplit(sorter.sampleSorter, cutoffIdxs, cutoffs)
+	res := b.createNumericSplit(sorter.sampleSorter, cutoffIdxs, cutoffs, total)
+	if res != nil {
+		res.Order = order
+	}
+	return res
 }
 
-func createNumericSplit(s sampleSorter, cutoffIdxs []int, cutoffs []Val) *potentialSplit {
+// createNumericSplit finds the best of the given
+// thresholds for the sorted samples.
+//
+// If total is non-nil, it must count all of the samples.
+// It is cloned rather than counting the samples again.
+func (b *id3Builder) createNumericSplit(s sampleSorter, cutoffIdxs []int, cutoffs []Val,
+	total splitCounter) *potentialSplit {
+	if b.MaxThresholds > 0 {
+		cutoffIdxs, cutoffs = quantileCutoffs(len(s.Samples), cutoffIdxs, cutoffs,
+			b.MaxThresholds)
+	}
 	if len(cutoffIdxs) == 0 {
 		return nil
 	}
@@ -235,10 +1554,19 @@ func createNumericSplit(s sampleSorter, cutoffIdxs []int, cutoffs []Val) *potent
 		Attr: s.Attr,
 	}
 
-	lessEntropy := newEntropyCounter(s.Samples[:cutoffIdxs[0]])
-	greaterEntropy := newEntropyCounter(s.Samples[cutoffIdxs[0]:])
+	lessEntropy := b.newCounter(s.Samples[:cutoffIdxs[0]])
+	var greaterEntropy splitCounter
+	if total != nil {
+		greaterEntropy = total.clone()
+		for _, sample := range s.Samples[:cutoffIdxs[0]] {
+			greaterEntropy.Remove(sample)
+		}
+	} else {
+		greaterEntropy = b.newCounter(s.Samples[cutoffIdxs[0]:])
+	}
 
-	countDivider := 1 / float64(len(s.Samples))
+	var found bool
+	countDivider := 1 / (lessEntropy.TotalWeight() + greaterEntropy.TotalWeight())
 	for i, cutoffIdx := range cutoffIdxs {
 		if i != 0 {
 			lastIdx := cutoffIdxs[i-1]
@@ -247,11 +1575,22 @@ func createNumericSplit(s sampleSorter, cutoffIdxs []int, cutoffs []Val) *potent
 				greaterEntropy.Remove(s.Samples[j])
 			}
 		}
-		lessE := lessEntropy.Entropy()
-		greaterE := greaterEntropy.Entropy()
-		entropy := countDivider * (float64(lessEntropy.totalCount)*lessE +
-			float64(greaterEntropy.totalCount)*greaterE)
-		if entropy < best.Entropy || i == 0 {
+		if cutoffIdx < b.MinSamplesLeaf || len(s.Samples)-cutoffIdx < b.MinSamplesLeaf {
+			continue
+		}
+		if !b.heavyEnough(lessEntropy.TotalWeight()) ||
+			!b.heavyEnough(greaterEntropy.TotalWeight()) {
+			continue
+		}
+		if !b.monotone(s.Attr, lessEntropy, greaterEntropy) {
+			continue
+		}
+		lessE := b.impurity(lessEntropy)
+		greaterE := b.impurity(greaterEntropy)
+		entropy := countDivider * (lessEntropy.TotalWeight()*lessE +
+			greaterEntropy.TotalWeight()*greaterE)
+		if entropy < best.Entropy || !found {
+			found = true
 			best.Entropy = entropy
 			best.NumSplitEntropies[0] = lessE
 			best.NumSplitEntropies[1] = greaterE
@@ -261,46 +1600,322 @@ func createNumericSplit(s sampleSorter, cutoffIdxs []int, cutoffs []Val) *potent
 		}
 	}
 
+	if !found {
+		return nil
+	}
 	return best
 }
 
+// heavyEnough checks if a branch with the given total
+// weight satisfies MinWeightFractionLeaf.
+func (b *id3Builder) heavyEnough(weight float64) bool {
+	return weight >= b.MinWeightFractionLeaf*b.totalWeight
+}
+
+// totalSampleWeight sums the weights of the samples.
+func totalSampleWeight(samples []Sample) float64 {
+	var res float64
+	for _, s := range samples {
+		res += sampleWeight(s)
+	}
+	return res
+}
+
+// quantileCutoffs picks at most n of the cutoffs, taking
+// the first cutoff at or after each of n evenly-spaced
+// quantiles of the sorted samples.
+// The chosen cutoffs are a subset of the original ones,
+// so they still lie between actual values.
+func quantileCutoffs(numSamples int, cutoffIdxs []int, cutoffs []Val,
+	n int) ([]int, []Val) {
+	if len(cutoffIdxs) <= n {
+		return cutoffIdxs, cutoffs
+	}
+	var resIdxs []int
+	var res []Val
+	var j int
+	for i := 1; i <= n; i++ {
+		target := i * numSamples / (n + 1)
+		for j < len(cutoffIdxs)-1 && cutoffIdxs[j] < target {
+			j++
+		}
+		if len(resIdxs) > 0 && resIdxs[len(resIdxs)-1] == cutoffIdxs[j] {
+			continue
+		}
+		resIdxs = append(resIdxs, cutoffIdxs[j])
+		res = append(res, cutoffs[j])
+	}
+	return resIdxs, res
+}
+
+// A splitCounter accumulates statistics about a set of
+// samples which are used to compute impurities.
+type splitCounter interface {
+	Add(s Sample)
+	Remove(s Sample)
+	TotalWeight() float64
+
+	// clone creates an independent copy of the counter.
+	clone() splitCounter
+}
+
+func (b *id3Builder) newCounter(s []Sample) splitCounter {
+	if b.Regression {
+		return newVarianceCounter(s)
+	} else if b.numOutputs > 0 {
+		return newMultiCounter(s, b.numOutputs)
+	} else if b.numClasses > 0 {
+		return newIndexedCounter(s, b.numClasses)
+	}
+	return newEntropyCounter(s)
+}
+
+// A classCounter is a splitCounter for classification.
+type classCounter interface {
+	splitCounter
+	Entropy() float64
+	Gini() float64
+	Impurity(c SplitCriterion) float64
+}
+
 type entropyCounter struct {
-	classCounts map[Class]int
-	totalCount  int
+	classWeights map[Class]float64
+	totalWeight  float64
+
+	// weightLogSum is the sum of w*log(w) over the class
+	// weights, which is updated incrementally.
+	weightLogSum float64
+
+	// numPositive is the number of classes with positive
+	// weights.
+	numPositive int
+
+	// classes lists the keys of classWeights, sorted by
+	// their string representations in classNames.
+	// Impurities are summed in this order so that they do
+	// not depend on map iteration order.
+	classes    []Class
+	classNames []string
 }
 
 func newEntropyCounter(s []Sample) *entropyCounter {
 	res := &entropyCounter{
-		classCounts: map[Class]int{},
-		totalCount:  len(s),
+		classWeights: map[Class]float64{},
 	}
 	for _, sample := range s {
-		res.classCounts[sample.Class()]++
+		res.Add(sample)
 	}
 	return res
 }
 
+// impurity computes the impurity of the counted
+// samples according to the builder's criterion.
+func (b *id3Builder) impurity(c splitCounter) float64 {
+	if b.Regression {
+		return c.(*varianceCounter).Variance()
+	}
+	e := c.(classCounter)
+	if b.SplitCriterion != nil {
+		return e.Impurity(b.SplitCriterion)
+	}
+	switch b.Criterion {
+	case Entropy:
+		return e.Entropy() * b.entropyScale
+	case Gini:
+		return e.Gini()
+	default:
+		panic("unknown criterion")
+	}
+}
+
+// Entropy computes the entropy of the class distribution
+// in constant time, using the incrementally maintained
+// weightLogSum.
 func (e *entropyCounter) Entropy() float64 {
+	return incrementalEntropy(e.totalWeight, e.weightLogSum, e.numPositive)
+}
+
+// exactEntropy computes the entropy of the class
+// distribution from scratch.
+func (e *entropyCounter) exactEntropy() float64 {
 	var entropy float64
-	countScaler := 1 / float64(e.totalCount)
-	for _, count := range e.classCounts {
-		if count == 0 {
+	weightScaler := 1 / e.totalWeight
+	for _, class := range e.classes {
+		weight := e.classWeights[class]
+		if weight <= 0 {
 			continue
 		}
-		probability := float64(count) * countScaler
+		probability := weight * weightScaler
 		entropy -= probability * math.Log(probability)
 	}
 	return entropy
 }
 
+func (e *entropyCounter) Gini() float64 {
+	impurity := 1.0
+	weightScaler := 1 / e.totalWeight
+	for _, class := range e.classes {
+		probability := e.classWeights[class] * weightScaler
+		impurity -= probability * probability
+	}
+	return impurity
+}
+
+func (e *entropyCounter) TotalWeight() float64 {
+	return e.totalWeight
+}
+
+func (e *entropyCounter) clone() splitCounter {
+	res := *e
+	res.classWeights = make(map[Class]float64, len(e.classWeights))
+	for class, weight := range e.classWeights {
+		res.classWeights[class] = weight
+	}
+	res.classes = append([]Class{}, e.classes...)
+	res.classNames = append([]string{}, e.classNames...)
+	return &res
+}
+
 func (e *entropyCounter) Add(s Sample) {
-	e.classCounts[s.Class()]++
-	e.totalCount++
+	w := sampleWeight(s)
+	class := s.Class()
+	if _, ok := e.classWeights[class]; !ok {
+		e.addClass(class)
+	}
+	e.updateWeight(class, w)
+}
+
+func (e *entropyCounter) updateWeight(class Class, delta float64) {
+	old := e.classWeights[class]
+	updated := updatedWeight(old, delta)
+	e.classWeights[class] = updated
+	e.weightLogSum += xlogx(updated) - xlogx(old)
+	e.numPositive += positiveDelta(old, updated)
+	e.totalWeight += delta
+}
+
+func (e *entropyCounter) addClass(class Class) {
+	name := fmt.Sprintf("%v", class)
+	idx := sort.SearchStrings(e.classNames, name)
+	e.classNames = append(e.classNames, "")
+	copy(e.classNames[idx+1:], e.classNames[idx:])
+	e.classNames[idx] = name
+	e.classes = append(e.classes, nil)
+	copy(e.classes[idx+1:], e.classes[idx:])
+	e.classes[idx] = class
 }
 
 func (e *entropyCounter) Remove(s Sample) {
-	e.classCounts[s.Class()]--
-	e.totalCount--
+	e.updateWeight(s.Class(), -sampleWeight(s))
+}
+
+// incrementalEntropy computes the entropy of a
+// distribution with the given total weight and sum of
+// w*log(w) over its weights, using the identity
+// H = log(W) - sum(w*log(w))/W.
+//
+// Distributions with at most one positive weight have
+// an entropy of exactly 0, regardless of rounding error,
+// since updatedWeight rounds weights which were removed
+// to 0.
+func incrementalEntropy(totalWeight, weightLogSum float64, numPositive int) float64 {
+	if totalWeight <= 0 || numPositive < 2 {
+		return 0
+	}
+	return math.Max(0, logWeight(totalWeight)-weightLogSum/totalWeight)
+}
+
+// weightSnapTolerance is the relative size below which
+// an updated class weight is rounded to 0.
+const weightSnapTolerance = 1e-9
+
+// updatedWeight computes old+delta, but it returns
+// exactly 0 if the result is only rounding error, such as
+// when the last sample of a class with fractional weights
+// is removed.
+func updatedWeight(old, delta float64) float64 {
+	updated := old + delta
+	if math.Abs(updated) <= weightSnapTolerance*math.Max(math.Abs(old), math.Abs(delta)) {
+		return 0
+	}
+	return updated
+}
+
+// positiveDelta returns the change in the number of
+// positive weights when a weight changes from old to
+// updated.
+func positiveDelta(old, updated float64) int {
+	if old <= 0 && updated > 0 {
+		return 1
+	} else if old > 0 && updated <= 0 {
+		return -1
+	}
+	return 0
+}
+
+// xlogx computes x*log(x), treating non-positive values
+// as 0.
+func xlogx(x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	return x * logWeight(x)
+}
+
+// logTableSize is the number of entries in logTable.
+const logTableSize = 1 << 12
+
+// logTable caches the logarithms of small integers,
+// since unweighted samples always have integer class
+// weights.
+var logTable = func() []float64 {
+	res := make([]float64, logTableSize)
+	for i := 1; i < logTableSize; i++ {
+		res[i] = math.Log(float64(i))
+	}
+	return res
+}()
+
+// logWeight computes log(x) for a positive weight, using
+// logTable when x is a small integer.
+// The result is the same as math.Log(x).
+func logWeight(x float64) float64 {
+	if x < logTableSize {
+		if i := int(x); float64(i) == x && i > 0 {
+			return logTable[i]
+		}
+	}
+	return math.Log(x)
+}
+
+// splitMissing separates the samples which have a value
+// for an attribute from the ones which do not.
+// A nil value indicates a missing value.
+func splitMissing(samples []Sample, attr Attr) (known, missing []Sample) {
+	for i, s := range samples {
+		if s.Attr(attr) == nil {
+			if known == nil {
+				known = append([]Sample{}, samples[:i]...)
+			}
+			missing = append(missing, s)
+		} else if known != nil {
+			known = append(known, s)
+		}
+	}
+	if missing == nil {
+		return samples, nil
+	}
+	return known, missing
+}
+
+// A scaledSample scales the weight of another sample.
+type scaledSample struct {
+	Sample
+	scale float64
+}
+
+func (s *scaledSample) Weight() float64 {
+	return sampleWeight(s.Sample) * s.scale
 }
 
 func copySampleSlice(s []Sample) []Sample {
@@ -327,8 +1942,8 @@ type intSorter struct {
 }
 
 func (i *intSorter) Less(k, j int) bool {
-	kVal := i.Samples[k].Attr(i.Attr).(int64)
-	jVal := i.Samples[j].Attr(i.Attr).(int64)
+	kVal := intValue(i.Samples[k].Attr(i.Attr))
+	jVal := intValue(i.Samples[j].Attr(i.Attr))
 	return kVal < jVal
 }
 
@@ -337,7 +1952,188 @@ type floatSorter struct {
 }
 
 func (f *floatSorter) Less(k, j int) bool {
-	kVal := f.Samples[k].Attr(f.Attr).(float64)
-	jVal := f.Samples[j].Attr(f.Attr).(float64)
+	kVal := floatValue(f.Samples[k].Attr(f.Attr))
+	jVal := floatValue(f.Samples[j].Attr(f.Attr))
 	return kVal < jVal
 }
+
+type orderedSorter struct {
+	sampleSorter
+	indices map[Val]int
+}
+
+func (o *orderedSorter) Less(k, j int) bool {
+	return o.indices[o.Samples[k].Attr(o.Attr)] < o.indices[o.Samples[j].Attr(o.Attr)]
+}
+
+// intValue converts an integer attribute value of any
+// signed or unsigned type to an int64.
+func intValue(v Val) int64 {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	default:
+		return v.(int64)
+	}
+}
+
+// floatValue converts a float64 or float32 attribute
+// value to a float64.
+func floatValue(v Val) float64 {
+	if f, ok := v.(float32); ok {
+		return float64(f)
+	}
+	return v.(float64)
+}
+
+// anyFloatValue converts a value of any numeric type to
+// a float64.
+func anyFloatValue(v Val) float64 {
+	switch v.(type) {
+	case float64, float32:
+		return floatValue(v)
+	}
+	return float64(intValue(v))
+}
+
+// classWeighted scales the weights of the samples
+// according to ClassWeights or BalancedClassWeights.
+func (b *id3Builder) classWeighted(samples []Sample) []Sample {
+	if b.Regression || b.numOutputs > 0 {
+		return samples
+	}
+	weights := b.ClassWeights
+	if b.BalancedClassWeights {
+		counter := newEntropyCounter(samples)
+		weights = map[Class]float64{}
+		for class, weight := range counter.classWeights {
+			if weight > 0 {
+				weights[class] = counter.totalWeight /
+					(float64(len(counter.classWeights)) * weight)
+			}
+		}
+	}
+	if weights == nil {
+		return samples
+	}
+	res := make([]Sample, len(samples))
+	for i, sample := range samples {
+		if scale, ok := weights[sample.Class()]; ok {
+			res[i] = &scaledSample{Sample: sample, scale: scale}
+		} else {
+			res[i] = sample
+		}
+	}
+	return res
+}
+
+// A sentinelSample replaces the sentinel values of
+// another sample's attributes with nil.
+type sentinelSample struct {
+	Sample
+	sentinels map[Attr]Val
+}
+
+func (s *sentinelSample) Attr(attr Attr) Val {
+	return missingValue(s.Sample.Attr(attr), s.sentinels[attr])
+}
+
+func (s *sentinelSample) Weight() float64 {
+	return sampleWeight(s.Sample)
+}
+
+// typedSamples wraps the samples so that every value of
+// an attribute declared as a NumericAttr is an int64, or
+// a float64 if any of the attribute's values is a float.
+func (b *id3Builder) typedSamples(samples []Sample) []Sample {
+	floatAttrs := map[Attr]bool{}
+	for attr, attrType := range b.AttrTypes {
+		if attrType == NumericAttr {
+			floatAttrs[attr] = false
+		}
+	}
+	if len(floatAttrs) == 0 {
+		return samples
+	}
+	for _, s := range samples {
+		for attr := range floatAttrs {
+			switch val := s.Attr(attr); val.(type) {
+			case nil, int64, int, int8, int16, int32, uint, uint8, uint16, uint32, uint64:
+			case float64, float32:
+				floatAttrs[attr] = true
+			default:
+				panic(fmt.Sprintf("value %v of numerical attribute %v is not a number",
+					val, attr))
+			}
+		}
+	}
+	res := make([]Sample, len(samples))
+	for i, s := range samples {
+		res[i] = &typedSample{Sample: s, floatAttrs: floatAttrs}
+	}
+	return res
+}
+
+// categorical returns true if a numerical attribute
+// should be split by value.
+func (b *id3Builder) categorical(attr Attr) bool {
+	if attrType, ok := b.AttrTypes[attr]; ok && attrType != InferAttr {
+		return attrType == CategoricalAttr
+	}
+	return b.CategoricalAttrs[attr]
+}
+
+// A typedSample converts the values of numerical
+// attributes to int64 or float64, as determined by
+// typedSamples.
+type typedSample struct {
+	Sample
+	floatAttrs map[Attr]bool
+}
+
+func (t *typedSample) Attr(attr Attr) Val {
+	val := t.Sample.Attr(attr)
+	isFloat, ok := t.floatAttrs[attr]
+	if !ok || val == nil {
+		return val
+	}
+	if isFloat {
+		return anyFloatValue(val)
+	}
+	return intValue(val)
+}
+
+func (t *typedSample) Weight() float64 {
+	return sampleWeight(t.Sample)
+}
+
+// setMissingValues stores the sentinels for the splits
+// and surrogates of a tree.
+func setMissingValues(t *Tree, sentinels map[Attr]Val) {
+	t.visit(func(node *Tree) {
+		if node.leaf() {
+			return
+		}
+		node.MissingValue = sentinels[node.Attr]
+		for i := range node.Surrogates {
+			surrogate := &node.Surrogates[i]
+			surrogate.MissingValue = sentinels[surrogate.Attr]
+		}
+	})
+}
@@ -1,8 +1,15 @@
 package idtrees
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -166,6 +173,29 @@ func TestID3(t *testing.T) {
 	}
 }
 
+func TestBuilderZeroValue(t *testing.T) {
+	rand.Seed(42)
+	var samples []Sample
+	for i := 0; i < 200; i++ {
+		s := treeTestSample{
+			"x":     rand.Float64(),
+			"n":     int64(rand.Intn(20)),
+			"color": []string{"red", "green", "blue"}[rand.Intn(3)],
+			"class": rand.Intn(3),
+		}
+		if rand.Intn(10) == 0 {
+			s["x"] = nil
+		}
+		samples = append(samples, s)
+	}
+	attrs := []Attr{"x", "n", "color"}
+
+	var b Builder
+	if !treesEqual(b.Build(samples, attrs), ID3(samples, attrs, 0)) {
+		t.Error("zero Builder differs from ID3")
+	}
+}
+
 func TestID3NoReusing(t *testing.T) {
 	rand.Seed(123)
 
@@ -191,3 +221,1697 @@ func TestID3NoReusing(t *testing.T) {
 		t.Error("got caught in long loop")
 	}
 }
+
+func TestID3ConstantAttrs(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 10; i++ {
+		samples = append(samples, treeTestSample{"x": 3.5, "y": int64(7),
+			"class": i % 2})
+	}
+	tree := ID3(samples, []Attr{"x", "y"}, 2)
+	if !tree.leaf() {
+		t.Fatal("expected a leaf")
+	}
+	for _, class := range []Class{0, 1} {
+		if p := tree.Classification[class]; math.Abs(p-0.5) > 1e-8 {
+			t.Errorf("class %v has probability %f", class, p)
+		}
+	}
+}
+
+func TestCreateLeafEmpty(t *testing.T) {
+	zeroWeight := []Sample{weightedTestSample{treeTestSample{"class": 1}, 0}}
+	for _, samples := range [][]Sample{nil, zeroWeight} {
+		leaf := createLeaf(samples)
+		if leaf.Classification == nil {
+			t.Fatal("expected a non-nil classification")
+		}
+		for class, p := range leaf.Classification {
+			if math.IsNaN(p) || math.IsInf(p, 0) {
+				t.Errorf("class %v has probability %f", class, p)
+			}
+		}
+	}
+}
+
+func TestCreateLeafWeighted(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 9; i++ {
+		samples = append(samples, treeTestSample{"class": "majority"})
+	}
+	samples = append(samples, weightedTestSample{treeTestSample{"class": "minority"}, 21})
+
+	// The leaf probabilities must follow the weights
+	// rather than the number of samples.
+	leaf := ID3(samples, nil, 1)
+	if leaf.Weight != 30 {
+		t.Errorf("expected weight 30 but got %f", leaf.Weight)
+	}
+	expected := map[Class]float64{"majority": 0.3, "minority": 0.7}
+	for class, prob := range expected {
+		if math.Abs(leaf.Classification[class]-prob) > 1e-8 {
+			t.Errorf("class %v: expected %f but got %f", class, prob,
+				leaf.Classification[class])
+		}
+	}
+}
+
+func TestID3TiedAttrs(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 40; i++ {
+		c := i % 2
+		samples = append(samples, treeTestSample{"a": c, "b": c, "c": c,
+			"d": float64(c), "class": c})
+	}
+	attrs := []Attr{"d", "c", "b", "a"}
+	expected := ID3(samples, attrs, 4)
+	if expected.Attr != "a" {
+		t.Errorf("expected split on a but got %v", expected.Attr)
+	}
+	for i := 0; i < 50; i++ {
+		if !treesEqual(ID3(samples, attrs, 4), expected) {
+			t.Fatal("tree changed between runs")
+		}
+	}
+}
+
+func TestID3OrderedAttrs(t *testing.T) {
+	order := []Val{"low", "medium", "high", "extreme"}
+	var samples []Sample
+	for i := 0; i < 40; i++ {
+		level := order[i%len(order)]
+		class := "safe"
+		if level == "high" || level == "extreme" {
+			class = "danger"
+		}
+		samples = append(samples, treeTestSample{"level": level, "class": class})
+	}
+	b := &Builder{OrderedAttrs: map[Attr][]Val{"level": order}}
+	tree := b.Build(samples, []Attr{"level"})
+
+	if tree.NumSplit == nil {
+		t.Fatal("expected a numerical split")
+	}
+	if tree.NumSplit.Threshold != "medium" {
+		t.Errorf("expected threshold medium but got %v", tree.NumSplit.Threshold)
+	}
+	for _, level := range order {
+		expected := "safe"
+		if level == "high" || level == "extreme" {
+			expected = "danger"
+		}
+		actual := tree.ClassifyOne(treeTestSample{"level": level})
+		if actual != expected {
+			t.Errorf("level %v: expected %v but got %v", level, expected, actual)
+		}
+	}
+	if c := tree.Classify(treeTestSample{"level": "unknown"}); c["safe"] != 0.5 {
+		t.Errorf("unexpected classification for unknown level: %v", c)
+	}
+	if pruned := Prune(tree, samples); !treesEqual(tree, pruned) {
+		t.Errorf("pruning changed the tree: %s", pruned)
+	}
+}
+
+func TestID3GainRatio(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 32; i++ {
+		class := i % 2
+		good := class == 1
+		if i < 4 {
+			good = !good
+		}
+		samples = append(samples, treeTestSample{"id": fmt.Sprintf("id%d", i),
+			"good": good, "class": class})
+	}
+	attrs := []Attr{"id", "good"}
+
+	if tree := LimitedID3(samples, attrs, 0, 1); tree.Attr != "id" {
+		t.Errorf("expected information gain to prefer id but got %v", tree.Attr)
+	}
+	b := &Builder{GainRatio: true, MaxDepth: 1}
+	if tree := b.Build(samples, attrs); tree.Attr != "good" {
+		t.Errorf("expected gain ratio to prefer good but got %v", tree.Attr)
+	}
+}
+
+func TestID3NarrowNumericTypes(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 20; i++ {
+		class := "small"
+		if i >= 10 {
+			class = "big"
+		}
+		samples = append(samples, treeTestSample{"f": float32(i) / 2,
+			"n": int32(i), "class": class})
+	}
+	for _, attr := range []Attr{"f", "n"} {
+		tree := ID3(samples, []Attr{attr}, 0)
+		if tree.NumSplit == nil {
+			t.Fatalf("attribute %v: expected a numerical split", attr)
+		}
+		for _, s := range samples {
+			if class := tree.ClassifyOne(s); class != s.Class() {
+				t.Errorf("attribute %v: expected %v but got %v", attr, s.Class(), class)
+			}
+		}
+	}
+	tree := ID3(samples, []Attr{"f"}, 0)
+	if _, ok := tree.NumSplit.Threshold.(float64); !ok {
+		t.Errorf("threshold has type %T", tree.NumSplit.Threshold)
+	}
+}
+
+func TestID3NoReuseCategoricalAttrs(t *testing.T) {
+	rand.Seed(1337)
+	var samples []Sample
+	for i := 0; i < 300; i++ {
+		s := treeTestSample{
+			"color": []string{"red", "green", "blue"}[rand.Intn(3)],
+			"shape": []string{"round", "square"}[rand.Intn(2)],
+			"size":  rand.Float64(),
+			"class": rand.Intn(3),
+		}
+		if i%5 == 0 {
+			s["color"] = nil
+		}
+		samples = append(samples, s)
+	}
+	attrs := []Attr{"color", "shape", "size"}
+
+	var checkPaths func(t *testing.T, tree *Tree, used map[Attr]bool)
+	checkPaths = func(t *testing.T, tree *Tree, used map[Attr]bool) {
+		if tree.ValSplit != nil {
+			if used[tree.Attr] {
+				t.Fatalf("attribute %v split on twice", tree.Attr)
+			}
+			used[tree.Attr] = true
+			defer delete(used, tree.Attr)
+		}
+		for _, child := range tree.children() {
+			checkPaths(t, child, used)
+		}
+	}
+	for _, b := range []*Builder{
+		{NoReuseCategoricalAttrs: true},
+		{NoReuseCategoricalAttrs: true, MaxLeafNodes: 30},
+	} {
+		tree := b.Build(samples, attrs)
+		if tree.ValSplit == nil && tree.NumSplit == nil {
+			t.Fatal("expected a split")
+		}
+		checkPaths(t, tree, map[Attr]bool{})
+	}
+}
+
+func TestID3PureNode(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 10; i++ {
+		samples = append(samples, treeTestSample{"x": float64(i), "class": "a"})
+	}
+	b := &id3Builder{Builder: Builder{MaxGos: 1}, entropyScale: 1}
+	// Simulate rounding error in the node's impurity.
+	tree := b.id3(&nodeSamples{Samples: samples}, []Attr{"x"}, -1, 1e-16)
+	if !tree.leaf() {
+		t.Fatal("expected a leaf for a pure node")
+	}
+	if tree.Classification["a"] != 1 {
+		t.Errorf("unexpected classification: %v", tree.Classification)
+	}
+}
+
+func TestID3Gini(t *testing.T) {
+	samples := []Sample{
+		treeTestSample{"drinks": false, "height": 2.0, "class": "child"},
+		treeTestSample{"drinks": false, "height": 3.0, "class": "child"},
+		treeTestSample{"drinks": false, "height": 2.3, "class": "child"},
+		treeTestSample{"drinks": true, "height": 5.5, "class": "adult"},
+		treeTestSample{"drinks": false, "height": 4.3, "class": "teenager"},
+		treeTestSample{"drinks": false, "height": 5.5, "class": "teenager"},
+		treeTestSample{"drinks": true, "height": 6.0, "class": "adult"},
+	}
+	attrs := []Attr{"height", "drinks"}
+	expected := ID3(samples, attrs, 1)
+	for _, criterion := range []Criterion{Entropy, Gini} {
+		test := &treeTest{
+			Samples:  samples,
+			Attrs:    attrs,
+			Expected: expected,
+			Builder:  &Builder{Criterion: criterion},
+		}
+		test.Run(t, fmt.Sprintf("criterion %d", criterion))
+	}
+
+	counter := newEntropyCounter(samples)
+	if g := counter.Gini(); math.Abs(g-(1-(9.0+4+4)/49)) > 1e-8 {
+		t.Errorf("unexpected Gini impurity: %f", g)
+	}
+}
+
+func TestID3LogBase(t *testing.T) {
+	samples := []Sample{
+		treeTestSample{"x": int64(1), "class": "a"},
+		treeTestSample{"x": int64(2), "class": "b"},
+		treeTestSample{"x": int64(3), "class": "c"},
+		treeTestSample{"x": int64(4), "class": "d"},
+	}
+	b := &id3Builder{Builder: Builder{LogBase: 2}, entropyScale: 1 / math.Log(2)}
+	if e := b.impurity(newEntropyCounter(samples)); math.Abs(e-2) > 1e-8 {
+		t.Errorf("expected 2 bits but got %f", e)
+	}
+	test := &treeTest{
+		Samples:  samples,
+		Attrs:    []Attr{"x"},
+		Expected: ID3(samples, []Attr{"x"}, 1),
+		Builder:  &Builder{LogBase: 2},
+	}
+	test.Run(t, "log base 2")
+}
+
+func TestID3MaxDepth(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 20; i++ {
+		samples = append(samples, treeTestSample{"x": int64(i), "class": i % 3})
+	}
+	tree := (&Builder{MaxDepth: 1}).Build(samples, []Attr{"x"})
+	if tree.NumSplit == nil {
+		t.Fatal("expected a split at the root")
+	}
+	for _, child := range []*Tree{tree.NumSplit.LessEqual, tree.NumSplit.Greater} {
+		if child.Classification == nil {
+			t.Fatal("expected children to be leaves")
+		}
+		var sum float64
+		for _, p := range child.Classification {
+			sum += p
+		}
+		if math.Abs(sum-1) > 1e-8 {
+			t.Errorf("leaf probabilities sum to %f", sum)
+		}
+	}
+}
+
+func TestID3MinSamplesLeaf(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 20; i++ {
+		class := "small"
+		if i >= 10 || i == 3 {
+			class = "big"
+		}
+		color := "red"
+		if i%7 == 0 {
+			color = "blue"
+		}
+		samples = append(samples, treeTestSample{"x": int64(i), "color": color,
+			"class": class})
+	}
+	attrs := []Attr{"x", "color"}
+
+	var foundTiny bool
+	for _, count := range leafCounts(ID3(samples, attrs, 1), samples) {
+		if count < 5 {
+			foundTiny = true
+		}
+	}
+	if !foundTiny {
+		t.Fatal("expected unconstrained tree to have tiny leaves")
+	}
+
+	tree := (&Builder{MinSamplesLeaf: 5}).Build(samples, attrs)
+	for _, count := range leafCounts(tree, samples) {
+		if count < 5 {
+			t.Errorf("leaf has %d samples:\n%s", count, tree)
+		}
+	}
+}
+
+func TestID3MinGain(t *testing.T) {
+	rand.Seed(1337)
+	var samples []Sample
+	for i := 0; i < 200; i++ {
+		x := rand.Float64()
+		class := x > 0.5
+		if rand.Intn(5) == 0 {
+			class = !class
+		}
+		samples = append(samples, treeTestSample{"x": x, "class": class})
+	}
+	attrs := []Attr{"x"}
+
+	lastCount := ID3(samples, attrs, 1).NumNodes()
+	for _, minGain := range []float64{0.3, 0.5, 1} {
+		count := (&Builder{MinGain: minGain}).Build(samples, attrs).NumNodes()
+		if count >= lastCount && lastCount > 1 {
+			t.Errorf("min gain %f: expected fewer than %d nodes but got %d",
+				minGain, lastCount, count)
+		}
+		lastCount = count
+	}
+	if lastCount != 1 {
+		t.Errorf("expected a single leaf but got %d nodes", lastCount)
+	}
+}
+
+func TestRegressionTree(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 20; i++ {
+		samples = append(samples, treeTestSample{"x": float64(i), "class": float64(i)})
+	}
+	tree := RegressionTree(samples, []Attr{"x"}, 0)
+	for _, s := range samples {
+		if p := tree.Predict(s); math.Abs(p-s.Class().(float64)) > 1e-8 {
+			t.Errorf("sample %v: predicted %f", s, p)
+		}
+	}
+
+	stump := (&Builder{Regression: true, MaxDepth: 1}).Build(samples, []Attr{"x"})
+	if stump.NumSplit == nil || stump.NumSplit.Threshold.(float64) != 9.5 {
+		t.Fatalf("unexpected stump: %s", stump)
+	}
+	if v := stump.NumSplit.LessEqual.Value; math.Abs(v-4.5) > 1e-8 {
+		t.Errorf("expected mean 4.5 but got %f", v)
+	}
+	if v := stump.NumSplit.Greater.Value; math.Abs(v-14.5) > 1e-8 {
+		t.Errorf("expected mean 14.5 but got %f", v)
+	}
+}
+
+func TestVarianceCounter(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 10; i++ {
+		samples = append(samples, treeTestSample{"class": float64(i * i)})
+	}
+	counter := newVarianceCounter(samples[:3])
+	for _, s := range samples[3:] {
+		counter.Add(s)
+	}
+	for _, s := range samples[:5] {
+		counter.Remove(s)
+	}
+	expected := newVarianceCounter(samples[5:])
+	if math.Abs(counter.mean-expected.mean) > 1e-8 ||
+		math.Abs(counter.Variance()-expected.Variance()) > 1e-8 {
+		t.Errorf("expected mean %f var %f but got mean %f var %f", expected.mean,
+			expected.Variance(), counter.mean, counter.Variance())
+	}
+}
+
+func TestEntropyCounterIncremental(t *testing.T) {
+	rand.Seed(1337)
+	var samples []Sample
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, weightedTestSample{
+			treeTestSample: treeTestSample{"class": rand.Intn(5)},
+			weight:         rand.Float64(),
+		})
+	}
+	indexed := (&id3Builder{}).presort(samples, nil).Samples
+
+	mapCounter := newEntropyCounter(samples[:10])
+	sliceCounter := newIndexedCounter(indexed[:10], 5)
+	check := func() {
+		for _, c := range []interface {
+			Entropy() float64
+			exactEntropy() float64
+		}{mapCounter, sliceCounter} {
+			if math.Abs(c.Entropy()-c.exactEntropy()) > 1e-8 {
+				t.Fatalf("incremental entropy %f but exact entropy %f", c.Entropy(),
+					c.exactEntropy())
+			}
+		}
+	}
+	for i := 10; i < len(samples); i++ {
+		mapCounter.Add(samples[i])
+		sliceCounter.Add(indexed[i])
+		check()
+	}
+	for i := 0; i < len(samples)-1; i++ {
+		mapCounter.Remove(samples[i])
+		sliceCounter.Remove(indexed[i])
+		check()
+	}
+	if e := mapCounter.Entropy(); e != 0 {
+		t.Errorf("expected zero entropy for one sample but got %f", e)
+	}
+}
+
+func TestEntropyCounterRemoveClass(t *testing.T) {
+	// 0.1+0.2+0.3 minus each of them in another order
+	// leaves a rounding error rather than 0.
+	samples := []Sample{weightedTestSample{treeTestSample{"class": "b"}, 1}}
+	for _, w := range []float64{0.1, 0.2, 0.3} {
+		samples = append(samples, weightedTestSample{treeTestSample{"class": "a"}, w})
+	}
+	indexed := (&id3Builder{}).presort(samples, nil).Samples
+	mapCounter := newEntropyCounter(samples)
+	sliceCounter := newIndexedCounter(indexed, 2)
+	for _, i := range []int{1, 3, 2} {
+		mapCounter.Remove(samples[i])
+		sliceCounter.Remove(indexed[i])
+	}
+	if e := mapCounter.Entropy(); e != 0 || mapCounter.numPositive != 1 {
+		t.Errorf("expected zero entropy but got %v with %d classes", e, mapCounter.numPositive)
+	}
+	if e := sliceCounter.Entropy(); e != 0 || sliceCounter.numPositive != 1 {
+		t.Errorf("expected zero entropy but got %v with %d classes", e, sliceCounter.numPositive)
+	}
+}
+
+func TestPotentialSplitBetterThan(t *testing.T) {
+	a := &potentialSplit{Attr: "a", Score: 0.5}
+	b := &potentialSplit{Attr: "b", Score: 0.5 - 1e-16}
+	if !a.betterThan(b) || b.betterThan(a) {
+		t.Error("nearly equal scores should be tied")
+	}
+	b.Score = 0.4
+	if a.betterThan(b) || !b.betterThan(a) {
+		t.Error("lower score should be better")
+	}
+}
+
+func TestLogWeight(t *testing.T) {
+	for _, x := range []float64{1, 2, 3, 17.5, 100, logTableSize - 1, logTableSize,
+		logTableSize + 0.5, 1e6, 1e-3} {
+		if actual, expected := logWeight(x), math.Log(x); actual != expected {
+			t.Errorf("log(%v): expected %v but got %v", x, expected, actual)
+		}
+	}
+	for i := 1; i < logTableSize; i++ {
+		x := float64(i)
+		if actual, expected := xlogx(x), x*math.Log(x); actual != expected {
+			t.Fatalf("xlogx(%v): expected %v but got %v", x, expected, actual)
+		}
+	}
+}
+
+func BenchmarkEntropyCounter(b *testing.B) {
+	rand.Seed(1337)
+	samples := make([]Sample, 1000)
+	for i := range samples {
+		samples[i] = treeTestSample{"class": rand.Intn(5)}
+	}
+	indexed := (&id3Builder{}).presort(samples, nil).Samples
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		counter := newIndexedCounter(nil, 5)
+		var entropy float64
+		for _, s := range indexed {
+			counter.Add(s)
+			entropy += counter.Entropy()
+		}
+	}
+}
+
+func TestID3MissingValues(t *testing.T) {
+	samples := []Sample{
+		treeTestSample{"age": int64(3), "color": "red", "class": "child"},
+		treeTestSample{"age": nil, "color": "red", "class": "child"},
+		treeTestSample{"age": int64(4), "color": nil, "class": "child"},
+		treeTestSample{"age": int64(30), "color": "blue", "class": "adult"},
+		treeTestSample{"age": int64(32), "color": nil, "class": "adult"},
+		treeTestSample{"age": nil, "color": "blue", "class": "adult"},
+		treeTestSample{"age": int64(35), "color": "blue", "class": "adult"},
+	}
+	for _, attrs := range [][]Attr{{"age"}, {"color"}, {"age", "color"}} {
+		tree := ID3(samples, attrs, 1)
+		if tree.leaf() {
+			t.Errorf("attrs %v: expected a split", attrs)
+		}
+		if math.Abs(tree.Weight-float64(len(samples))) > 1e-8 {
+			t.Errorf("attrs %v: root weight %f", attrs, tree.Weight)
+		}
+		for _, s := range samples {
+			if s.Attr(attrs[0]) != nil && tree.ClassifyOne(s) != s.Class() {
+				t.Errorf("attrs %v: sample %v misclassified", attrs, s)
+			}
+		}
+	}
+
+	tree := ID3(samples, []Attr{"age"}, 1)
+	dist := tree.Classify(treeTestSample{"age": nil})
+	if math.Abs(dist["child"]-3.0/7) > 1e-8 || math.Abs(dist["adult"]-4.0/7) > 1e-8 {
+		t.Errorf("unexpected distribution for missing value: %v", dist)
+	}
+}
+
+type weightedTestSample struct {
+	treeTestSample
+	weight float64
+}
+
+func (w weightedTestSample) Weight() float64 {
+	return w.weight
+}
+
+func TestID3Weighted(t *testing.T) {
+	base := []treeTestSample{
+		{"x": 1.0, "color": "red", "class": "a"},
+		{"x": 2.0, "color": "red", "class": "b"},
+		{"x": 3.0, "color": "blue", "class": "a"},
+		{"x": 4.0, "color": "blue", "class": "b"},
+		{"x": 5.0, "color": "green", "class": "b"},
+		{"x": 6.0, "color": "red", "class": "a"},
+	}
+	repeats := []int{3, 1, 2, 1, 2, 4}
+
+	var duplicated, weighted []Sample
+	for i, s := range base {
+		for j := 0; j < repeats[i]; j++ {
+			duplicated = append(duplicated, s)
+		}
+		weighted = append(weighted, weightedTestSample{s, float64(repeats[i])})
+	}
+
+	attrs := []Attr{"x", "color"}
+	expected := ID3(duplicated, attrs, 1)
+	actual := ID3(weighted, attrs, 1)
+	if !treesEqual(expected, actual) {
+		t.Errorf("expected %s but got %s", expected, actual)
+	}
+	if actual.Weight != expected.Weight {
+		t.Errorf("expected weight %f but got %f", expected.Weight, actual.Weight)
+	}
+}
+
+func TestID3Context(t *testing.T) {
+	rand.Seed(1337)
+	var samples []Sample
+	var attrs []Attr
+	for i := 0; i < 20; i++ {
+		attrs = append(attrs, i)
+	}
+	for i := 0; i < 20000; i++ {
+		s := treeTestSample{"class": rand.Intn(5)}
+		for _, attr := range attrs {
+			s[attr] = rand.Float64()
+		}
+		samples = append(samples, s)
+	}
+
+	startGos := runtime.NumGoroutine()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	start := time.Now()
+	tree, err := ID3Context(ctx, samples, attrs, 4)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected deadline error but got %v", err)
+	}
+	if tree != nil {
+		t.Error("expected nil tree")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*2 {
+		t.Errorf("cancellation took %v", elapsed)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	if n := runtime.NumGoroutine(); n > startGos {
+		t.Errorf("goroutines leaked: %d -> %d", startGos, n)
+	}
+
+	small := samples[:50]
+	tree, err = ID3Context(context.Background(), small, attrs, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !treesEqual(tree, ID3(small, attrs, 4)) {
+		t.Error("unexpected tree from uncancelled context")
+	}
+}
+
+func TestCheckedID3(t *testing.T) {
+	samples := []Sample{
+		treeTestSample{"x": 1.0, "class": "a"},
+		treeTestSample{"x": 2.0, "class": "b"},
+	}
+	attrs := []Attr{"x"}
+	if _, err := CheckedID3(nil, attrs, 1); err != ErrNoSamples {
+		t.Errorf("expected ErrNoSamples but got %v", err)
+	}
+	if _, err := CheckedID3(samples, nil, 1); err != ErrNoAttributes {
+		t.Errorf("expected ErrNoAttributes but got %v", err)
+	}
+	if _, err := CheckedID3(nil, nil, 1); err != ErrNoSamples {
+		t.Errorf("expected ErrNoSamples but got %v", err)
+	}
+	if _, err := (&Builder{}).BuildContext(context.Background(), samples,
+		[]Attr{}); err != ErrNoAttributes {
+		t.Errorf("expected ErrNoAttributes but got %v", err)
+	}
+
+	tree, err := CheckedID3(samples, attrs, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !treesEqual(tree, ID3(samples, attrs, 1)) {
+		t.Error("unexpected tree for valid inputs")
+	}
+	if leaf := ID3(nil, attrs, 1); !leaf.leaf() || len(leaf.Classification) != 0 {
+		t.Errorf("expected an empty leaf but got %s", leaf)
+	}
+}
+
+func TestID3WithBudget(t *testing.T) {
+	rand.Seed(1337)
+	var samples []Sample
+	var attrs []Attr
+	for i := 0; i < 10; i++ {
+		attrs = append(attrs, i)
+	}
+	for i := 0; i < 20000; i++ {
+		s := treeTestSample{}
+		var sum float64
+		for _, attr := range attrs {
+			s[attr] = rand.Float64()
+			sum += s[attr].(float64)
+		}
+		s["class"] = int(sum) + rand.Intn(2)
+		samples = append(samples, s)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	start := time.Now()
+	tree := ID3WithBudget(ctx, samples, attrs, 4)
+	if elapsed := time.Since(start); elapsed > time.Second*2 {
+		t.Errorf("cancellation took %v", elapsed)
+	}
+	if tree == nil {
+		t.Fatal("expected a tree")
+	}
+	tree.visit(func(node *Tree) {
+		if node.leaf() && len(node.Classification) == 0 {
+			t.Fatal("tree has an empty leaf")
+		}
+	})
+	for _, s := range samples[:100] {
+		if tree.ClassifyOne(s) == nil {
+			t.Fatal("sample could not be classified")
+		}
+	}
+
+	small := samples[:300]
+	if !treesEqual(ID3WithBudget(context.Background(), small, attrs, 4), ID3(small, attrs, 4)) {
+		t.Error("unexpected tree from uncancelled context")
+	}
+}
+
+func BenchmarkID3WideCategorical(b *testing.B) {
+	rand.Seed(1337)
+	var samples []Sample
+	for i := 0; i < 100000; i++ {
+		samples = append(samples, treeTestSample{"category": fmt.Sprint(rand.Intn(2000)),
+			"class": rand.Intn(10)})
+	}
+	attrs := []Attr{"category"}
+	for _, maxGos := range []int{1, 0} {
+		b.Run(fmt.Sprintf("maxGos=%d", maxGos), func(b *testing.B) {
+			builder := &Builder{MaxGos: maxGos, MaxDepth: 1}
+			for i := 0; i < b.N; i++ {
+				builder.Build(samples, attrs)
+			}
+		})
+	}
+}
+
+func TestID3MaxThresholds(t *testing.T) {
+	rng := rand.New(rand.NewSource(1337))
+	var samples []Sample
+	values := map[float64]bool{}
+	for i := 0; i < 500; i++ {
+		x := float64(rng.Intn(1000)) / 10
+		values[x] = true
+		samples = append(samples, treeTestSample{"x": x, "class": int(x / 25)})
+	}
+	var sorted []float64
+	for x := range values {
+		sorted = append(sorted, x)
+	}
+	sort.Float64s(sorted)
+	midpoints := map[float64]bool{}
+	for i := 1; i < len(sorted); i++ {
+		midpoints[sorted[i-1]+(sorted[i]-sorted[i-1])/2] = true
+	}
+
+	b := &Builder{MaxThresholds: 8}
+	tree := b.Build(samples, []Attr{"x"})
+	tree.visit(func(node *Tree) {
+		if node.NumSplit == nil {
+			return
+		}
+		threshold := node.NumSplit.Threshold.(float64)
+		if !midpoints[threshold] {
+			t.Errorf("threshold %f is not between adjacent values", threshold)
+		}
+	})
+	if errs := treeErrors(tree, samples); errs > len(samples)/10 {
+		t.Errorf("too many training errors: %d", errs)
+	}
+
+	idxs, cutoffs := quantileCutoffs(100, []int{10, 20, 30, 40, 50, 60, 70, 80, 90},
+		[]Val{1, 2, 3, 4, 5, 6, 7, 8, 9}, 3)
+	if len(idxs) != 3 || idxs[0] != 30 || idxs[1] != 50 || idxs[2] != 80 {
+		t.Errorf("unexpected cutoff indices: %v", idxs)
+	}
+	if len(cutoffs) != 3 || cutoffs[0] != 3 || cutoffs[1] != 5 || cutoffs[2] != 8 {
+		t.Errorf("unexpected cutoffs: %v", cutoffs)
+	}
+}
+
+// goroutineSample records the largest number of live
+// Goroutines seen while its attributes are read.
+type goroutineSample struct {
+	treeTestSample
+	peak *int64
+}
+
+func (g goroutineSample) Attr(attr Attr) Val {
+	n := int64(runtime.NumGoroutine())
+	for {
+		old := atomic.LoadInt64(g.peak)
+		if n <= old || atomic.CompareAndSwapInt64(g.peak, old, n) {
+			break
+		}
+	}
+	return g.treeTestSample.Attr(attr)
+}
+
+func TestID3GoroutineLimit(t *testing.T) {
+	var peak int64
+	var samples []Sample
+	var attrs []Attr
+	for i := 0; i < 20; i++ {
+		attrs = append(attrs, fmt.Sprintf("attr%d", i))
+	}
+	for i := 0; i < 300; i++ {
+		s := treeTestSample{"class": i % 7}
+		for j, attr := range attrs {
+			// Categorical attributes with many values make
+			// the tree deep and spread the work across
+			// buckets.
+			s[attr] = (i*(j+3) + i/(j+1)) % 11
+		}
+		samples = append(samples, goroutineSample{s, &peak})
+	}
+
+	const maxGos = 3
+	base := runtime.NumGoroutine()
+	tree := ID3(samples, attrs, maxGos)
+	if tree.Depth() < 3 {
+		t.Fatalf("tree is too shallow: depth %d", tree.Depth())
+	}
+	// One extra Goroutine collects the results of the
+	// workers.
+	if extra := int(peak) - base; extra > maxGos+1 {
+		t.Errorf("expected at most %d extra Goroutines but saw %d", maxGos+1, extra)
+	}
+}
+
+func TestID3Sequential(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(500, 4)
+	for _, s := range samples {
+		s.(treeTestSample)["color"] = []string{"red", "green", "blue"}[rand.Intn(3)]
+	}
+	attrs := []Attr{0, 1, 2, 3, "color"}
+	for _, builder := range []Builder{{}, {GainRatio: true}, {MaxLeafNodes: 20}} {
+		builder.MaxGos = 4
+		expected := builder.Build(samples, attrs)
+		builder.MaxGos = 1
+		if actual := builder.Build(samples, attrs); !treesEqual(actual, expected) {
+			t.Errorf("sequential tree differs:\n%s\nexpected:\n%s", actual, expected)
+		}
+	}
+
+	var peak int64
+	wrapped := make([]Sample, len(samples))
+	for i, s := range samples {
+		wrapped[i] = goroutineSample{s.(treeTestSample), &peak}
+	}
+	base := runtime.NumGoroutine()
+	ID3(wrapped, attrs, 1)
+	if extra := int(peak) - base; extra > 0 {
+		t.Errorf("expected no extra Goroutines but saw %d", extra)
+	}
+}
+
+func TestID3MissingValueSentinels(t *testing.T) {
+	rng := rand.New(rand.NewSource(1337))
+	var withNil, withSentinels []Sample
+	for i := 0; i < 200; i++ {
+		x := int64(rng.Intn(100))
+		color := []string{"red", "green", "blue"}[rng.Intn(3)]
+		class := x > 40 || color == "red"
+		s := treeTestSample{"x": x, "color": color, "y": x + int64(rng.Intn(20)),
+			"class": class}
+		sentinel := treeTestSample{"x": x, "color": color, "y": s["y"], "class": class}
+		switch rng.Intn(5) {
+		case 0:
+			s["x"] = nil
+			sentinel["x"] = int64(-1)
+		case 1:
+			s["color"] = nil
+			sentinel["color"] = "NA"
+		}
+		withNil = append(withNil, s)
+		withSentinels = append(withSentinels, sentinel)
+	}
+	attrs := []Attr{"x", "color", "y"}
+
+	expected := (&Builder{MaxSurrogates: 1}).Build(withNil, attrs)
+	b := &Builder{
+		MaxSurrogates: 1,
+		MissingValues: map[Attr]Val{"x": int64(-1), "color": "NA"},
+	}
+	actual := b.Build(withSentinels, attrs)
+	if expected.String() != actual.String() {
+		t.Fatalf("expected %s but got %s", expected, actual)
+	}
+	var numSentinels int
+	actual.visit(func(node *Tree) {
+		if node.MissingValue != nil {
+			numSentinels++
+		}
+	})
+	if numSentinels == 0 {
+		t.Error("sentinels were not stored in the tree")
+	}
+	for i, s := range withSentinels {
+		if !classificationsEqual(expected.Classify(withNil[i]), actual.Classify(s)) {
+			t.Errorf("sample %d: expected %v but got %v", i, expected.Classify(withNil[i]),
+				actual.Classify(s))
+		}
+	}
+
+	data, err := json.Marshal(actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded *Tree
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !treesEqual(actual, decoded) {
+		t.Error("tree changed after JSON round trip")
+	}
+}
+
+func TestID3BalancedClassWeights(t *testing.T) {
+	rand.Seed(1337)
+	// The minority class only appears near the top of the
+	// range, where it is still outnumbered by the majority.
+	makeSamples := func() []Sample {
+		var res []Sample
+		for i := 0; i < 950; i++ {
+			res = append(res, treeTestSample{"x": rand.Float64(), "class": "common"})
+		}
+		for i := 0; i < 50; i++ {
+			res = append(res, treeTestSample{"x": 0.9 + rand.Float64()/10, "class": "rare"})
+		}
+		return res
+	}
+	train, test := makeSamples(), makeSamples()
+	attrs := []Attr{"x"}
+
+	unweighted := (&Builder{MaxDepth: 2}).Build(train, attrs)
+	balanced := (&Builder{MaxDepth: 2, BalancedClassWeights: true}).Build(train, attrs)
+	unweightedRecall := NewConfusionMatrix(unweighted, test).Recall("rare")
+	balancedRecall := NewConfusionMatrix(balanced, test).Recall("rare")
+	if balancedRecall <= unweightedRecall || balancedRecall < 0.9 {
+		t.Errorf("recall went from %f to %f", unweightedRecall, balancedRecall)
+	}
+	if math.Abs(balanced.Weight-float64(len(train))) > 1e-8 {
+		t.Errorf("expected root weight %d but got %f", len(train), balanced.Weight)
+	}
+
+	explicit := (&Builder{
+		MaxDepth:     2,
+		ClassWeights: map[Class]float64{"common": 1000.0 / 1900, "rare": 10},
+	}).Build(train, attrs)
+	if !classificationsEqual(explicit.Classify(test[len(test)-1]),
+		balanced.Classify(test[len(test)-1])) {
+		t.Error("explicit weights do not match balanced weights")
+	}
+}
+
+func TestID3OnNode(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(500, 4)
+	attrs := []Attr{0, 1, 2, 3}
+	for _, builder := range []Builder{{}, {MaxDepth: 3}, {MaxLeafNodes: 10}} {
+		var numNodes, maxDepth, rootSamples int
+		builder.OnNode = func(depth, numSamples int) {
+			numNodes++
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+			if depth == 0 {
+				rootSamples += numSamples
+			}
+		}
+		tree := builder.Build(samples, attrs)
+		if numNodes != tree.NumNodes() {
+			t.Errorf("expected %d calls but got %d", tree.NumNodes(), numNodes)
+		}
+		if maxDepth != tree.Depth() {
+			t.Errorf("expected max depth %d but got %d", tree.Depth(), maxDepth)
+		}
+		if rootSamples != len(samples) {
+			t.Errorf("expected %d root samples but got %d", len(samples), rootSamples)
+		}
+	}
+}
+
+func TestID3SampleCount(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(500, 4)
+	for _, s := range samples {
+		s.(treeTestSample)["color"] = []string{"red", "green", "blue"}[rand.Intn(3)]
+	}
+	attrs := []Attr{0, 1, 2, 3, "color"}
+	for _, builder := range []Builder{{}, {MaxLeafNodes: 10}} {
+		tree := builder.Build(samples, attrs)
+		if tree.SampleCount != len(samples) {
+			t.Errorf("expected root count %d but got %d", len(samples), tree.SampleCount)
+		}
+		tree.visit(func(node *Tree) {
+			if node.leaf() {
+				return
+			}
+			var sum int
+			for _, child := range node.children() {
+				sum += child.SampleCount
+			}
+			if sum != node.SampleCount {
+				t.Errorf("children have %d samples but parent has %d", sum, node.SampleCount)
+			}
+		})
+
+		data, err := tree.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Tree
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if !tree.Equal(&decoded) {
+			t.Error("sample counts changed after binary round trip")
+		}
+	}
+}
+
+func TestID3LeafSamples(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(500, 4)
+	for _, s := range samples {
+		s.(treeTestSample)["color"] = []string{"red", "green", "blue"}[rand.Intn(3)]
+	}
+	attrs := []Attr{0, 1, 2, 3, "color"}
+	ID3(samples, attrs, 1).visit(func(node *Tree) {
+		if node.SampleIndices != nil {
+			t.Fatal("sample indices without LeafSamples")
+		}
+	})
+	for _, builder := range []Builder{{LeafSamples: true}, {LeafSamples: true, MaxLeafNodes: 10}} {
+		tree := builder.Build(samples, attrs)
+		seen := make([]bool, len(samples))
+		tree.visit(func(node *Tree) {
+			if !node.leaf() {
+				return
+			}
+			if len(node.SampleIndices) != node.SampleCount {
+				t.Errorf("leaf has %d indices but %d samples", len(node.SampleIndices),
+					node.SampleCount)
+			}
+			for _, idx := range node.SampleIndices {
+				if seen[idx] {
+					t.Errorf("sample %d is in multiple leaves", idx)
+				}
+				seen[idx] = true
+				leaf := tree
+				for !leaf.leaf() {
+					leaf = leaf.route(samples[idx])
+				}
+				if leaf != node {
+					t.Errorf("sample %d does not reach its leaf", idx)
+				}
+			}
+		})
+		for idx, ok := range seen {
+			if !ok {
+				t.Errorf("sample %d is in no leaf", idx)
+			}
+		}
+	}
+}
+
+func TestID3Gain(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 10; i++ {
+		samples = append(samples, treeTestSample{"x": int64(i), "class": i < 5})
+	}
+	attrs := []Attr{"x"}
+	for _, test := range []struct {
+		Builder Builder
+		Gain    float64
+	}{
+		{Builder{}, math.Log(2)},
+		{Builder{MaxLeafNodes: 5}, math.Log(2)},
+		{Builder{Criterion: Gini}, 0.5},
+	} {
+		tree := test.Builder.Build(samples, attrs)
+		if tree.NumSplit == nil || !tree.NumSplit.LessEqual.leaf() ||
+			!tree.NumSplit.Greater.leaf() {
+			t.Fatalf("expected a single split:\n%s", tree)
+		}
+		if math.Abs(tree.Gain-test.Gain) > 1e-8 {
+			t.Errorf("expected gain %f but got %f", test.Gain, tree.Gain)
+		}
+	}
+
+	rand.Seed(1337)
+	tree := ID3(presortTestSamples(300, 4), []Attr{0, 1, 2, 3}, 1)
+	tree.visit(func(node *Tree) {
+		if !node.leaf() && node.Gain <= 0 {
+			t.Errorf("split has gain %f", node.Gain)
+		}
+	})
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Tree
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !tree.Equal(&decoded) {
+		t.Error("gains changed after binary round trip")
+	}
+}
+
+func TestID3AdjacentThresholds(t *testing.T) {
+	pairs := [][2]Val{
+		{int64(3), int64(4)},
+		{int64(-4), int64(-3)},
+		{int64(math.MinInt64), int64(math.MaxInt64)},
+		{1.0, math.Nextafter(1, 2)},
+		{-math.MaxFloat64, math.MaxFloat64},
+	}
+	for _, pair := range pairs {
+		var samples []Sample
+		for i := 0; i < 10; i++ {
+			samples = append(samples, treeTestSample{"x": pair[i%2], "class": i%2 == 1})
+		}
+		tree := ID3(samples, []Attr{"x"}, 1)
+		if tree.NumSplit == nil {
+			t.Fatalf("values %v: expected a split", pair)
+		}
+		for _, s := range samples {
+			if tree.ClassifyOne(s) != s.Class() {
+				t.Errorf("values %v: threshold %v misroutes %v", pair,
+					tree.NumSplit.Threshold, s.Attr("x"))
+			}
+		}
+	}
+}
+
+func TestID3SparseSamples(t *testing.T) {
+	rand.Seed(1337)
+	var attrs []Attr
+	for i := 0; i < 1000; i++ {
+		attrs = append(attrs, fmt.Sprintf("a%d", i))
+	}
+	present := map[Attr]bool{"a3": true, "a7": true}
+	for _, attr := range attrs[10:15] {
+		present[attr] = true
+	}
+	absentQueries := 0
+	var samples []Sample
+	for i := 0; i < 200; i++ {
+		s := &sparseTestSample{
+			vals:          map[Attr]Val{},
+			present:       present,
+			absentQueries: &absentQueries,
+		}
+		x := rand.Float64()
+		s.vals["a3"] = x
+		s.vals[attrs[10+rand.Intn(5)]] = rand.Float64()
+		if rand.Intn(2) == 0 {
+			s.vals["a7"] = "flag"
+		}
+		s.class = x > 0.5
+		samples = append(samples, s)
+	}
+	tree := ID3(samples, attrs, 1)
+	if absentQueries != 0 {
+		t.Errorf("absent attributes were queried %d times", absentQueries)
+	}
+	for _, s := range samples {
+		if tree.ClassifyOne(s) != s.Class() {
+			t.Errorf("misclassified %v", s)
+		}
+	}
+}
+
+type sparseTestSample struct {
+	vals  map[Attr]Val
+	class Class
+
+	// absentQueries counts the calls to Attr for attributes
+	// which are not in present.
+	present       map[Attr]bool
+	absentQueries *int
+}
+
+func (s *sparseTestSample) Attr(attr Attr) Val {
+	if !s.present[attr] {
+		*s.absentQueries++
+	}
+	return s.vals[attr]
+}
+
+func (s *sparseTestSample) Class() Class {
+	return s.class
+}
+
+func (s *sparseTestSample) Attrs() []Attr {
+	var res []Attr
+	for attr := range s.vals {
+		res = append(res, attr)
+	}
+	return res
+}
+
+func TestID3BoolAttrs(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 20; i++ {
+		samples = append(samples, treeTestSample{
+			"flag":  i%2 == 0,
+			"x":     float64(i % 5),
+			"class": i%2 == 0 && i%5 != 0,
+		})
+	}
+	tree := ID3(samples, []Attr{"flag", "x"}, 1)
+	if tree.Attr != "flag" || tree.NumSplit != nil || len(tree.ValSplit) != 2 ||
+		tree.ValSplit[false] == nil || tree.ValSplit[true] == nil {
+		t.Fatalf("expected a two-branch split on flag:\n%s", tree)
+	}
+	if tree.ValSplit[false].Attr != nil || tree.ValSplit[true].Attr != "x" {
+		t.Fatalf("unexpected tree:\n%s", tree)
+	}
+	expected := "|--- flag == false\n|   |--- class=false p=1.00\n|--- flag == true\n"
+	if s := tree.String(); !strings.HasPrefix(s, expected) {
+		t.Errorf("unexpected string:\n%s", s)
+	}
+
+	for _, s := range samples {
+		if class := tree.ClassifyOne(s); class != s.Class() {
+			t.Errorf("sample %v: expected %v but got %v", s, s.Class(), class)
+		}
+	}
+	actual := tree.Classify(treeTestSample{"x": 3.0})
+	if math.Abs(actual[false]-0.6) > 1e-8 || math.Abs(actual[true]-0.4) > 1e-8 {
+		t.Errorf("unexpected classification for missing flag: %v", actual)
+	}
+}
+
+func TestID3MinWeightFractionLeaf(t *testing.T) {
+	var samples []Sample
+	var totalWeight float64
+	for i := 0; i < 20; i++ {
+		weight := 1.0
+		if i < 3 {
+			weight = 0.05
+		}
+		color := "red"
+		if i%2 == 0 {
+			color = "blue"
+		}
+		samples = append(samples, weightedTestSample{
+			treeTestSample: treeTestSample{"x": int64(i), "color": color, "class": i < 3 || i >= 15},
+			weight:         weight,
+		})
+		totalWeight += weight
+	}
+	attrs := []Attr{"x", "color"}
+
+	minWeight := func(tree *Tree) float64 {
+		res := math.Inf(1)
+		tree.visit(func(node *Tree) {
+			if node.leaf() {
+				res = math.Min(res, node.Weight)
+			}
+		})
+		return res
+	}
+	counted := (&Builder{MinSamplesLeaf: 3}).Build(samples, attrs)
+	if w := minWeight(counted); w >= 0.1*totalWeight {
+		t.Fatalf("expected a light leaf with MinSamplesLeaf:\n%s", counted)
+	}
+	tree := (&Builder{MinSamplesLeaf: 3, MinWeightFractionLeaf: 0.1}).Build(samples, attrs)
+	if tree.leaf() {
+		t.Fatal("expected a split")
+	}
+	if w := minWeight(tree); w < 0.1*totalWeight {
+		t.Errorf("leaf has weight %f of %f:\n%s", w, totalWeight, tree)
+	}
+}
+
+func TestID3MinImpurityDecrease(t *testing.T) {
+	// Both splits have a gain of one bit, but the split on
+	// b only affects half of the samples.
+	var samples []Sample
+	for i := 0; i < 40; i++ {
+		s := treeTestSample{"a": i%2 == 0, "b": i%4 < 2, "class": "x"}
+		if s["a"].(bool) {
+			s["class"] = map[bool]string{false: "y", true: "z"}[s["b"].(bool)]
+		}
+		samples = append(samples, s)
+	}
+	attrs := []Attr{"a", "b"}
+
+	withGain := (&Builder{MinGain: math.Log(2) - 1e-8}).Build(samples, attrs)
+	if withGain.Depth() != 2 {
+		t.Errorf("expected depth 2 with MinGain:\n%s", withGain)
+	}
+
+	tree := (&Builder{MinImpurityDecrease: 0.5}).Build(samples, attrs)
+	if tree.Attr != "a" || tree.Depth() != 1 {
+		t.Errorf("expected a single split on a:\n%s", tree)
+	}
+	tree = (&Builder{MinImpurityDecrease: 0.3}).Build(samples, attrs)
+	if tree.Depth() != 2 {
+		t.Errorf("expected depth 2:\n%s", tree)
+	}
+	tree = (&Builder{MinImpurityDecrease: 0.7}).Build(samples, attrs)
+	if !tree.leaf() {
+		t.Errorf("expected a leaf:\n%s", tree)
+	}
+}
+
+func TestRegressionMonotoneConstraints(t *testing.T) {
+	rand.Seed(1337)
+	var samples []Sample
+	for i := 0; i < 300; i++ {
+		x, z := rand.Float64(), rand.Float64()
+		y := x + z + math.Sin(x*20)/2 + rand.NormFloat64()*0.2
+		samples = append(samples, treeTestSample{"x": x, "z": z, "class": y})
+	}
+	attrs := []Attr{"x", "z"}
+
+	monotone := func(tree *Tree, dir float64) bool {
+		for _, z := range []float64{0.1, 0.5, 0.9} {
+			last := tree.Predict(treeTestSample{"x": 0.0, "z": z})
+			for x := 0.0; x <= 1; x += 0.001 {
+				pred := tree.Predict(treeTestSample{"x": x, "z": z})
+				if (pred-last)*dir < 0 {
+					return false
+				}
+				last = pred
+			}
+		}
+		return true
+	}
+
+	if monotone((&Builder{Regression: true}).Build(samples, attrs), 1) {
+		t.Fatal("unconstrained tree should not be monotone")
+	}
+	for _, dir := range []int{1, -1} {
+		for _, builder := range []Builder{{}, {MaxLeafNodes: 30}} {
+			builder.Regression = true
+			builder.MonotoneConstraints = map[Attr]int{"x": dir}
+			tree := builder.Build(samples, attrs)
+			if !monotone(tree, float64(dir)) {
+				t.Errorf("direction %d, MaxLeafNodes %d: tree is not monotone", dir,
+					builder.MaxLeafNodes)
+			}
+			if dir > 0 && tree.NumLeaves() < 10 {
+				t.Errorf("direction %d: expected more leaves, got %d", dir, tree.NumLeaves())
+			}
+		}
+	}
+}
+
+// groupedTestSamples adds a categorical "group"
+// attribute to presortTestSamples, which tells the high
+// classes from the low ones, so that trees split on it
+// above their numeric splits.
+func groupedTestSamples(samples []Sample) []Sample {
+	res := make([]Sample, len(samples))
+	for i, s := range samples {
+		grouped := treeTestSample{}
+		for attr, val := range s.(treeTestSample) {
+			grouped[attr] = val
+		}
+		high := s.Class().(string) >= "2"
+		grouped["group"] = fmt.Sprintf("%v-%d", high, i%3)
+		res[i] = grouped
+	}
+	return res
+}
+
+// hasValSplitAbove checks if a categorical split has
+// more than one internal node among its branches.
+func hasValSplitAbove(t *Tree) bool {
+	var res bool
+	t.visit(func(node *Tree) {
+		var internal int
+		for _, child := range node.ValSplit {
+			if !child.leaf() {
+				internal++
+			}
+		}
+		if internal > 1 {
+			res = true
+		}
+	})
+	return res
+}
+
+func TestID3ExtraTrees(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(500, 4)
+	attrs := []Attr{0, 1, 2, 3}
+	build := func(seed int64, maxGos int) *Tree {
+		b := &Builder{
+			MaxGos:     maxGos,
+			MaxDepth:   6,
+			ExtraTrees: true,
+			Rand:       rand.New(rand.NewSource(seed)),
+		}
+		return b.Build(samples, attrs)
+	}
+
+	expected := build(1337, 1)
+	for _, maxGos := range []int{1, 4} {
+		if actual := build(1337, maxGos); !treesEqual(actual, expected) {
+			t.Errorf("MaxGos %d: tree differs with the same seed", maxGos)
+		}
+	}
+	if treesEqual(build(1338, 1), expected) {
+		t.Error("tree did not change with the seed")
+	}
+
+	exact := (&Builder{MaxDepth: 6}).Build(samples, attrs)
+	if treesEqual(exact, expected) {
+		t.Error("random thresholds gave the exact tree")
+	}
+	var numCorrect int
+	for _, s := range samples {
+		if expected.ClassifyOne(s) == s.Class() {
+			numCorrect++
+		}
+	}
+	if accuracy := float64(numCorrect) / float64(len(samples)); accuracy < 0.7 {
+		t.Errorf("training accuracy is too low: %f", accuracy)
+	}
+
+	// Random thresholds below a categorical split must be
+	// drawn in the same order on every build.
+	samples = groupedTestSamples(samples)
+	attrs = append(attrs, "group")
+	expected = build(1337, 1)
+	if !hasValSplitAbove(expected) {
+		t.Fatalf("expected random splits below a categorical split:\n%s", expected)
+	}
+	for i := 0; i < 5; i++ {
+		if actual := build(1337, 1); !treesEqual(actual, expected) {
+			t.Fatal("tree with a categorical split differs with the same seed")
+		}
+	}
+}
+
+func TestID3CategoricalAttrs(t *testing.T) {
+	codes := []int64{10001, 20002, 30003, 40004}
+	var samples []Sample
+	for i := 0; i < 40; i++ {
+		code := codes[i%len(codes)]
+		samples = append(samples, treeTestSample{
+			"zip":   code,
+			"class": code == 10001 || code == 30003,
+		})
+	}
+	attrs := []Attr{"zip"}
+	if tree := ID3(samples, attrs, 1); tree.NumSplit == nil {
+		t.Fatalf("expected a numerical split without the option:\n%s", tree)
+	}
+
+	b := &Builder{CategoricalAttrs: map[Attr]bool{"zip": true}}
+	tree := b.Build(samples, attrs)
+	if tree.Attr != "zip" || tree.NumSplit != nil || len(tree.ValSplit) != len(codes) {
+		t.Fatalf("expected a split with a branch per code:\n%s", tree)
+	}
+	for _, s := range samples {
+		if tree.ClassifyOne(s) != s.Class() {
+			t.Errorf("misclassified %v", s)
+		}
+	}
+}
+
+func TestID3AttrTypes(t *testing.T) {
+	var samples []Sample
+	colors := []string{"red", "green", "blue"}
+	for i := 0; i < 100; i++ {
+		var x, color Val = float64(i) + 0.5, colors[i%3]
+		if i == 0 {
+			// The first sample has atypical types, which
+			// would be used for inference.
+			x, color = int64(0), int64(7)
+		}
+		samples = append(samples, treeTestSample{"x": x, "color": color,
+			"class": i >= 37})
+	}
+
+	b := &Builder{AttrTypes: map[Attr]AttrType{"x": NumericAttr}, MaxDepth: 1}
+	tree := b.Build(samples, []Attr{"x"})
+	if tree.NumSplit == nil || tree.NumSplit.Threshold != 37.0 {
+		t.Fatalf("expected a split at 37.0:\n%s", tree)
+	}
+	for _, s := range append(samples, treeTestSample{"x": int64(40)}) {
+		expected := anyFloatValue(s.Attr("x")) >= 37
+		if tree.ClassifyOne(s) != expected {
+			t.Errorf("misclassified %v", s)
+		}
+	}
+
+	for i, s := range samples {
+		s.(treeTestSample)["class"] = i%3 == 0
+	}
+	b = &Builder{AttrTypes: map[Attr]AttrType{"color": CategoricalAttr}}
+	tree = b.Build(samples, []Attr{"color"})
+	if tree.ValSplit == nil || len(tree.ValSplit) != 4 {
+		t.Fatalf("expected a branch per color:\n%s", tree)
+	}
+	for _, s := range samples {
+		if tree.ClassifyOne(s) != s.Class() {
+			t.Errorf("misclassified %v", s)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a non-numerical value")
+		}
+	}()
+	b = &Builder{AttrTypes: map[Attr]AttrType{"color": NumericAttr}}
+	b.Build(samples, []Attr{"color"})
+}
+
+func TestID3BinaryCategorical(t *testing.T) {
+	colors := []string{"red", "orange", "yellow", "green", "blue", "purple"}
+	positive := map[string]bool{"red": true, "yellow": true, "blue": true}
+	var samples []Sample
+	for i := 0; i < 60; i++ {
+		color := colors[i%len(colors)]
+		samples = append(samples, treeTestSample{"color": color, "class": positive[color]})
+	}
+	attrs := []Attr{"color"}
+	if tree := ID3(samples, attrs, 1); len(tree.ValSplit) != len(colors) {
+		t.Fatalf("expected a branch per color without the option:\n%s", tree)
+	}
+
+	b := &Builder{BinaryCategorical: true, MaxDepth: 1}
+	tree := b.Build(samples, attrs)
+	if tree.NumSplit == nil || len(tree.NumSplit.Order) != len(colors) {
+		t.Fatalf("expected a two-way split:\n%s", tree)
+	}
+	for _, child := range []*Tree{tree.NumSplit.LessEqual, tree.NumSplit.Greater} {
+		if !child.leaf() || len(child.Classification) != 1 {
+			t.Errorf("expected a pure leaf but got %s", child)
+		}
+	}
+	for _, s := range samples {
+		if tree.ClassifyOne(s) != s.Class() {
+			t.Errorf("misclassified %v", s)
+		}
+	}
+	unseen := tree.Classify(treeTestSample{"color": "black"})
+	if math.Abs(unseen[true]-0.5) > 1e-8 || math.Abs(unseen[false]-0.5) > 1e-8 {
+		t.Errorf("unexpected classification for unseen color: %v", unseen)
+	}
+}
+
+func TestID3MinCategoryCount(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 300; i++ {
+		city := fmt.Sprintf("town%d", i)
+		if i%3 != 0 {
+			city = []string{"paris", "tokyo"}[i%2]
+		}
+		samples = append(samples, treeTestSample{
+			"city":  city,
+			"class": city == "paris" || (i%3 == 0 && i%2 == 0),
+		})
+	}
+	attrs := []Attr{"city"}
+
+	full := ID3(samples, attrs, 1)
+	if len(full.ValSplit) != 102 {
+		t.Fatalf("expected 102 branches but got %d", len(full.ValSplit))
+	}
+
+	tree := (&Builder{MinCategoryCount: 5}).Build(samples, attrs)
+	if len(tree.ValSplit) != 3 || tree.ValSplit[OtherValue] == nil {
+		t.Fatalf("expected paris, tokyo, and other branches:\n%s", tree)
+	}
+	if tree.ValSplit[OtherValue].Weight != 100 {
+		t.Errorf("expected 100 samples in other branch but got %f",
+			tree.ValSplit[OtherValue].Weight)
+	}
+	if tree.ClassifyOne(treeTestSample{"city": "paris"}) != true {
+		t.Error("bad classification for paris")
+	}
+	if tree.ClassifyOne(treeTestSample{"city": "tokyo"}) != false {
+		t.Error("bad classification for tokyo")
+	}
+	unseen := tree.Classify(treeTestSample{"city": "lima"})
+	if !classificationsEqual(unseen, tree.ValSplit[OtherValue].Classification) {
+		t.Errorf("unseen value did not take the other branch: %v", unseen)
+	}
+}
+
+func TestID3IntegerTypes(t *testing.T) {
+	convert := []func(int) Val{
+		func(x int) Val { return x },
+		func(x int) Val { return int8(x) },
+		func(x int) Val { return int16(x) },
+		func(x int) Val { return int32(x) },
+		func(x int) Val { return uint(x) },
+		func(x int) Val { return uint8(x) },
+		func(x int) Val { return uint16(x) },
+		func(x int) Val { return uint32(x) },
+		func(x int) Val { return uint64(x) },
+	}
+	for _, f := range convert {
+		var samples []Sample
+		for i := 0; i < 100; i++ {
+			samples = append(samples, treeTestSample{"x": f(i), "class": i >= 37})
+		}
+		tree := ID3(samples, []Attr{"x"}, 1)
+		name := fmt.Sprintf("%T", f(0))
+		if tree.NumSplit == nil {
+			t.Errorf("%s: expected a NumSplit:\n%s", name, tree)
+			continue
+		}
+		if tree.NumSplit.Threshold != int64(36) {
+			t.Errorf("%s: unexpected threshold %#v", name, tree.NumSplit.Threshold)
+		}
+		for _, s := range samples {
+			if tree.ClassifyOne(s) != s.Class() {
+				t.Errorf("%s: misclassified %v", name, s)
+			}
+		}
+	}
+}
+
+func TestID3MaxFeatures(t *testing.T) {
+	b := (&Builder{MaxFeatures: 3, Rand: rand.New(rand.NewSource(1337))}).newID3Builder(nil)
+	attrs := []Attr{0, 1, 2, 3, 4, 5, 6, 7}
+	seen := map[Attr]bool{}
+	for i := 0; i < 20; i++ {
+		subset := b.nodeAttrs(attrs)
+		if len(subset) != 3 {
+			t.Fatalf("expected 3 attributes but got %v", subset)
+		}
+		distinct := map[Attr]bool{}
+		for _, attr := range subset {
+			distinct[attr] = true
+			seen[attr] = true
+		}
+		if len(distinct) != 3 {
+			t.Fatalf("repeated attributes: %v", subset)
+		}
+	}
+	if len(seen) != len(attrs) {
+		t.Errorf("only saw attributes %v", seen)
+	}
+	for i, attr := range attrs {
+		if attr != i {
+			t.Fatal("attributes were modified")
+		}
+	}
+
+	rand.Seed(1337)
+	samples := presortTestSamples(500, 8)
+	maxFeatures := 2
+	build := func(seed int64, maxGos int) *Tree {
+		builder := &Builder{
+			MaxGos:      maxGos,
+			MaxFeatures: maxFeatures,
+			Rand:        rand.New(rand.NewSource(seed)),
+		}
+		return builder.Build(samples, attrs)
+	}
+	expected := build(1337, 1)
+	if actual := build(1337, 4); !treesEqual(actual, expected) {
+		t.Error("tree differs with the same seed")
+	}
+	if treesEqual(build(1338, 1), expected) {
+		t.Error("tree did not change with the seed")
+	}
+
+	// Attribute subsets below a categorical split must be
+	// drawn in the same order on every build.
+	samples = groupedTestSamples(samples)
+	attrs = append(attrs, "group")
+	maxFeatures = 6
+	expected = build(1337, 1)
+	if !hasValSplitAbove(expected) {
+		t.Fatalf("expected random subsets below a categorical split:\n%s", expected)
+	}
+	for i := 0; i < 5; i++ {
+		if actual := build(1337, 1); !treesEqual(actual, expected) {
+			t.Fatal("tree with a categorical split differs with the same seed")
+		}
+	}
+}
+
+func TestID3Alpha(t *testing.T) {
+	samples := []Sample{
+		treeTestSample{"x": 1.0, "class": "a"},
+		treeTestSample{"x": 2.0, "class": "b"},
+		treeTestSample{"x": 3.0, "class": "b"},
+		treeTestSample{"x": 4.0, "class": "c"},
+		treeTestSample{"x": 5.0, "class": "c"},
+		treeTestSample{"x": 6.0, "class": "c"},
+	}
+	attrs := []Attr{"x"}
+
+	plain := ID3(samples, attrs, 1)
+	if p := plain.Classify(samples[0])["a"]; p != 1 {
+		t.Fatalf("expected probability 1 without smoothing but got %f", p)
+	}
+
+	tree := (&Builder{Alpha: 1}).Build(samples, attrs)
+	expected := map[Class]float64{"a": 0.5, "b": 0.25, "c": 0.25}
+	if actual := tree.Classify(samples[0]); !classificationsEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+	expected = map[Class]float64{"a": 1.0 / 6, "b": 1.0 / 6, "c": 4.0 / 6}
+	if actual := tree.Classify(samples[5]); !classificationsEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+	if tree.NumLeaves() != plain.NumLeaves() {
+		t.Errorf("smoothing changed the structure:\n%s", tree)
+	}
+}
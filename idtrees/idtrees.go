@@ -2,6 +2,12 @@
 // identification trees.
 package idtrees
 
+import (
+	"runtime"
+	"sort"
+	"sync"
+)
+
 // Comparable is any type, with the restriction
 // that the type must be comparable with the ==
 // operator. Thus, slices and maps are not
@@ -32,10 +38,28 @@ type Sample interface {
 	// Samples in the training set must return the same
 	// type and the attribute will be used to form
 	// split rules like "x >= 3".
+	// The other signed and unsigned integer types (int,
+	// int8, uint, uint64, etc.) are treated like int64,
+	// and float32 is treated like float64, in which case
+	// the resulting thresholds are int64 or float64
+	// values.
+	// Unsigned values above math.MaxInt64 are not
+	// supported.
+	// Builder.CategoricalAttrs can be used to split
+	// numerical attributes by value instead.
 	//
 	// If the returned type is not one of the numeric types
 	// listed above, then splits are equality-based (e.g.
 	// a rule like "x == true", or one like "x == Red").
+	// In particular, a bool attribute is split into a
+	// ValSplit with exactly two branches, keyed by false
+	// and true.
+	//
+	// If Attr returns nil, the value is treated as
+	// missing.
+	// During training, samples with missing values are
+	// sent down every branch of a split, with weights
+	// proportional to the sizes of the branches.
 	AttrMap
 
 	// Class returns the class of this Sample.
@@ -45,10 +69,63 @@ type Sample interface {
 	Class() Class
 }
 
+// A WeightedSample is a Sample with an importance weight.
+//
+// When training trees on WeightedSamples, each sample's
+// contribution to class probabilities and impurities is
+// scaled by its weight.
+// Samples which do not implement WeightedSample have a
+// weight of 1.
+type WeightedSample interface {
+	Sample
+
+	// Weight returns the non-negative weight of the
+	// sample.
+	Weight() float64
+}
+
+// A SparseSample is a Sample which has values for only a
+// few of the attributes.
+//
+// If every training sample is a SparseSample, then the
+// attributes considered at each node are restricted to
+// the ones which some of the node's samples have, so
+// that training does not ask every sample for every
+// attribute.
+type SparseSample interface {
+	Sample
+
+	// Attrs returns the attributes for which Attr returns
+	// a non-nil value.
+	// Attr must return nil for every other attribute.
+	Attrs() []Attr
+}
+
+func sampleWeight(s Sample) float64 {
+	if w, ok := s.(WeightedSample); ok {
+		return w.Weight()
+	}
+	return 1
+}
+
+// A Tree is a node of a decision tree, which is either a
+// leaf or a split with a subtree for each branch.
+//
+// Nothing in this package modifies a tree once it has
+// been built, other than the UnmarshalBinary,
+// UnmarshalJSON, and GobDecode methods, and
+// HoeffdingTree.Update, which grows HoeffdingTree.Tree in
+// place.
+// Thus, Classify, Predict, and the tree's other read-only
+// methods may be called from many Goroutines at once, as
+// long as none of those calls overlap with a call which
+// modifies the tree.
+// The maps and slices they return may be shared with the
+// tree, so they must not be modified.
 type Tree struct {
-	// Classification is non-nil if this is a leaf,
-	// in which case it maps classes to their final
-	// probabilities.
+	// Classification is non-nil if this is a leaf of a
+	// classification tree, in which case it maps classes
+	// to their final probabilities.
 	//
 	// If the training data was fully separable, this
 	// will contain one entry with probability 1.
@@ -57,8 +134,15 @@ type Tree struct {
 	// data, then this map is empty.
 	Classification map[Class]float64
 
-	// If Classification is nil (i.e. this is not a leaf),
-	// then this is the attribute used to split the branch.
+	// Classifications is non-nil if this is a leaf of a
+	// multi-output tree, in which case it stores one
+	// class distribution per output.
+	// Leaves of multi-output trees have a nil
+	// Classification.
+	Classifications []map[Class]float64
+
+	// If this is not a leaf, then this is the attribute
+	// used to split the branch.
 	// If the attribute refered to by Attr is an int64 or
 	// a float64, then NumSplit is non-nil.
 	// If the attribute is not for an int64 or a float64,
@@ -67,44 +151,350 @@ type Tree struct {
 
 	NumSplit *NumSplit
 	ValSplit ValSplit
+
+	// Fallback, if non-nil, is the classification of
+	// samples which reach this ValSplit node but which no
+	// branch or surrogate can route, such as samples with
+	// a value that was not seen during training.
+	// Builder sets it on the ValSplit nodes of
+	// classification trees to the classifications of the
+	// branches, weighted by their training weights.
+	// If it is nil, the same distribution is computed from
+	// the branches whenever it is needed.
+	Fallback map[Class]float64
+
+	// MissingValue, if non-nil, is a value of Attr which
+	// is treated like a missing (nil) value when
+	// classifying samples.
+	// It is set by Builder.MissingValues.
+	MissingValue Val
+
+	// Gain is the decrease in impurity achieved by the
+	// split of a non-leaf node: the impurity of the node's
+	// training samples minus the weighted average impurity
+	// of its branches, as measured by the criterion used
+	// to build the tree.
+	Gain float64
+
+	// Surrogates, if non-nil, lists the surrogate splits
+	// of a split node, from best to worst.
+	// They are used to classify samples which are missing
+	// the value of Attr.
+	Surrogates []Surrogate
+
+	// Weight is the total weight of the training samples
+	// which reached this node.
+	// For unweighted samples, this is the number of
+	// samples.
+	Weight float64
+
+	// SampleCount is the number of training samples which
+	// reached this node, regardless of their weights.
+	// It is set by ID3 and by Builder.
+	//
+	// The counts of a node's children add up to its own
+	// count, except that samples with missing values are
+	// counted in every branch they were sent down.
+	SampleCount int
+
+	// SampleIndices is set on leaves if the tree was built
+	// with Builder.LeafSamples, in which case it lists the
+	// indices of the training samples which reached the
+	// leaf in ascending order.
+	// A sample with missing values may be listed in more
+	// than one leaf.
+	// It is not saved by any of the tree's encodings.
+	SampleIndices []int
+
+	// Value is the predicted target if this is a leaf of
+	// a regression tree.
+	// Leaves of regression trees have a nil
+	// Classification, NumSplit, and ValSplit.
+	Value float64
 }
 
 // Classify follows the tree for the given sample and
 // returns the resulting leaf classification.
+//
+// If the sample has a missing (nil) value for a split,
+// the split's surrogates are used to pick a branch.
+// If no surrogate can route the sample, or if it has a
+// value which matches no branch of a ValSplit (and the
+// split has no OtherValue branch), the split's Fallback
+// is returned, or, if it has none, the classifications of
+// all the branches are combined, weighted by their
+// training weights.
 func (t *Tree) Classify(s AttrMap) map[Class]float64 {
-	for t.Classification == nil {
-		val := s.Attr(t.Attr)
-		if t.NumSplit != nil {
-			var greater bool
-			switch val := val.(type) {
-			case float64:
-				greater = val > t.NumSplit.Threshold.(float64)
-			case int64:
-				greater = val > t.NumSplit.Threshold.(int64)
-			}
-			if greater {
-				t = t.NumSplit.Greater
-			} else {
-				t = t.NumSplit.LessEqual
-			}
-		} else {
-			var found bool
-			for k, newTree := range t.ValSplit {
-				if k == val {
-					found = true
-					t = newTree
-				}
+	for !t.leaf() {
+		child := t.route(s)
+		if child == nil {
+			return fallbackClassification(t)
+		}
+		t = child
+	}
+	return t.Classification
+}
+
+// ClassifyDepth is like Classify, but it stops after
+// following at most maxDepth splits.
+// If the sample is still at an internal node by then, the
+// classifications of the node's leaves are combined,
+// weighted by their training weights (which are the
+// SampleCounts of the branches when the samples are
+// unweighted).
+//
+// A maxDepth of 0 combines every leaf of the tree, while
+// a maxDepth of at least t.Depth() gives the same result
+// as Classify.
+func (t *Tree) ClassifyDepth(s AttrMap, maxDepth int) map[Class]float64 {
+	for depth := 0; !t.leaf(); depth++ {
+		if depth >= maxDepth {
+			return mergedClassification(t)
+		}
+		child := t.route(s)
+		if child == nil {
+			return fallbackClassification(t)
+		}
+		t = child
+	}
+	return t.Classification
+}
+
+// ClassifyOne returns the most likely class for the
+// given sample.
+// Ties are broken deterministically by comparing the
+// string representations of the classes.
+//
+// If the sample reaches an empty leaf, nil is returned.
+func (t *Tree) ClassifyOne(s AttrMap) Class {
+	class, _ := topClass(t.Classify(s))
+	return class
+}
+
+// ClassifyWithCost returns the class which minimizes the
+// expected cost of classifying the given sample, rather
+// than the most likely class.
+//
+// The cost matrix maps pairs of predicted and actual
+// classes, in that order, to the costs of predicting the
+// first class when the second is correct.
+// Missing entries cost 0 for correct predictions and 1
+// for incorrect ones, so an empty matrix gives the same
+// results as ClassifyOne.
+// Any class in the leaf distribution or in the cost
+// matrix may be predicted.
+// Ties are broken as in ClassifyOne.
+//
+// If the sample reaches an empty leaf, nil is returned.
+func (t *Tree) ClassifyWithCost(s AttrMap, costMatrix map[[2]Class]float64) Class {
+	dist := t.Classify(s)
+	if len(dist) == 0 {
+		return nil
+	}
+	seen := map[Class]bool{}
+	var candidates []Val
+	for class := range dist {
+		seen[class] = true
+		candidates = append(candidates, class)
+	}
+	for key := range costMatrix {
+		if !seen[key[0]] {
+			seen[key[0]] = true
+			candidates = append(candidates, key[0])
+		}
+	}
+	sortVals(candidates)
+
+	var best Class
+	var bestCost float64
+	for i, predicted := range candidates {
+		var cost float64
+		for actual, prob := range dist {
+			c, ok := costMatrix[[2]Class{predicted, actual}]
+			if !ok && predicted != actual {
+				c = 1
 			}
-			if !found {
-				return map[Class]float64{}
+			cost += prob * c
+		}
+		if i == 0 || cost < bestCost {
+			best, bestCost = predicted, cost
+		}
+	}
+	return best
+}
+
+// Margin returns the difference between the
+// probabilities of the two most likely classes for the
+// given sample, which measures the confidence of the
+// classification.
+// A margin of 0 means that the top two classes are
+// equally likely, while a sample which reaches a pure
+// leaf has a margin of 1.
+//
+// If the sample reaches an empty leaf, 0 is returned.
+func (t *Tree) Margin(s AttrMap) float64 {
+	var first, second float64
+	for _, prob := range t.Classify(s) {
+		if prob > first {
+			first, second = prob, first
+		} else if prob > second {
+			second = prob
+		}
+	}
+	return first - second
+}
+
+// ClassifyBatch classifies every sample, returning the
+// classifications in the same order as the samples.
+//
+// The maxGos argument specifies the maximum number of
+// Goroutines to use, as in ID3.
+//
+// Like Classify, this does not copy the distributions:
+// samples which reach the same leaf share that leaf's
+// Classification map, so the maps must not be modified.
+func (t *Tree) ClassifyBatch(samples []Sample, maxGos int) []map[Class]float64 {
+	if maxGos == 0 {
+		maxGos = runtime.GOMAXPROCS(0)
+	}
+	res := make([]map[Class]float64, len(samples))
+	idxChan := make(chan int, len(samples))
+	for i := range samples {
+		idxChan <- i
+	}
+	close(idxChan)
+
+	var wg sync.WaitGroup
+	for i := 0; i < maxGos; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range idxChan {
+				res[idx] = t.Classify(samples[idx])
 			}
+		}()
+	}
+	wg.Wait()
+	return res
+}
+
+// value returns a sample's value for the attribute of a
+// split node, or nil if the value is missing.
+func (t *Tree) value(s AttrMap) Val {
+	return missingValue(s.Attr(t.Attr), t.MissingValue)
+}
+
+// missingValue returns nil if val is the sentinel for a
+// missing value, or val otherwise.
+func missingValue(val, sentinel Val) Val {
+	if sentinel != nil && val == sentinel {
+		return nil
+	}
+	return val
+}
+
+// leaf returns true if t is a leaf node.
+func (t *Tree) leaf() bool {
+	return t.NumSplit == nil && t.ValSplit == nil
+}
+
+// A NodeKind identifies the type of a node in a Tree.
+type NodeKind int
+
+const (
+	// Leaf is the kind of a node with no branches, which
+	// stores a Classification, Classifications, or a
+	// regression Value.
+	Leaf NodeKind = iota
+
+	// Numeric is the kind of a node with a NumSplit.
+	Numeric
+
+	// Categorical is the kind of a node with a ValSplit.
+	Categorical
+)
+
+// Kind returns the kind of the node, so that callers need
+// not check which of the fields of the Tree are set.
+func (t *Tree) Kind() NodeKind {
+	if t.NumSplit != nil {
+		return Numeric
+	} else if t.ValSplit != nil {
+		return Categorical
+	}
+	return Leaf
+}
+
+// children returns the branches of a node, which are
+// empty for a leaf.
+// The branches of a ValSplit are sorted by their values,
+// so that sums over them, like Fallback, do not depend
+// on the order of map iteration.
+func (t *Tree) children() []*Tree {
+	if t.NumSplit != nil {
+		return t.NumSplit.branches()
+	}
+	res := make([]*Tree, 0, len(t.ValSplit))
+	for _, val := range t.SortedValSplitKeys() {
+		res = append(res, t.ValSplit[val])
+	}
+	return res
+}
+
+// child returns the branch of a non-leaf node which is
+// taken for the given value of t.Attr.
+// Values which match no branch of a ValSplit take the
+// OtherValue branch, if there is one.
+// Otherwise, child returns nil if no branch matches.
+func (t *Tree) child(val Val) *Tree {
+	if val == nil {
+		// Missing values were distributed among all the
+		// branches during training.
+		return nil
+	}
+	if t.NumSplit != nil {
+		if t.NumSplit.Order != nil {
+			return t.NumSplit.orderedChild(val)
+		} else if t.NumSplit.Branches != nil {
+			return t.NumSplit.multiwayChild(val)
+		}
+		if numericGreater(val, t.NumSplit.Threshold) {
+			return t.NumSplit.Greater
 		}
+		return t.NumSplit.LessEqual
 	}
-	return t.Classification
+	for k, newTree := range t.ValSplit {
+		if k == val {
+			return newTree
+		}
+	}
+	return t.ValSplit[OtherValue]
+}
+
+// numericGreater returns true if a numerical value is
+// greater than an int64 or float64 threshold.
+// Integers and floats may be compared to thresholds of
+// either type, since the values of a NumericAttr may
+// mix the two.
+func numericGreater(val, threshold Val) bool {
+	switch val.(type) {
+	case float64, float32:
+		if t, ok := threshold.(int64); ok {
+			return floatValue(val) > float64(t)
+		}
+		return floatValue(val) > threshold.(float64)
+	case int64, int, int8, int16, int32, uint, uint8, uint16, uint32, uint64:
+		if t, ok := threshold.(float64); ok {
+			return float64(intValue(val)) > t
+		}
+		return intValue(val) > threshold.(int64)
+	}
+	return false
 }
 
-// NumSplit stores the two branches resulting from
-// splitting a tree based on a numerical cutoff.
+// NumSplit stores the branches resulting from splitting
+// a tree based on numerical cutoffs.
+// Most splits have one cutoff and two branches.
 type NumSplit struct {
 	// Threshold is the numerical decision boundary.
 	// If a sample's attribute's value is greater
@@ -112,10 +502,161 @@ type NumSplit struct {
 	// taken. Otherwise, the LessEqual branch is.
 	Threshold Val
 
+	// Order, if non-nil, lists the values of an ordered
+	// categorical attribute from smallest to largest.
+	// In this case, Threshold is one of these values,
+	// and values are compared by their positions in
+	// Order.
+	Order []Val
+
 	LessEqual *Tree
 	Greater   *Tree
+
+	// Thresholds and Branches are used instead of
+	// Threshold, LessEqual, and Greater for a multi-way
+	// split (see Builder.NumericBranches).
+	// Thresholds is sorted in ascending order, and there
+	// is one more branch than there are thresholds.
+	// A sample takes the first branch i for which its
+	// value is at most Thresholds[i], or the last branch
+	// if its value is greater than every threshold.
+	Thresholds []Val
+	Branches   []*Tree
+}
+
+// orderedChild finds the branch for a value of an ordered
+// categorical attribute.
+// It returns nil for values which are not in the order.
+func (n *NumSplit) orderedChild(val Val) *Tree {
+	valIdx, thresholdIdx := -1, -1
+	for i, v := range n.Order {
+		if v == val {
+			valIdx = i
+		}
+		if v == n.Threshold {
+			thresholdIdx = i
+		}
+	}
+	if valIdx < 0 {
+		return nil
+	} else if valIdx > thresholdIdx {
+		return n.Greater
+	}
+	return n.LessEqual
 }
 
 // ValSplit stores the branches resulting from splitting
 // a tree by a comparable but non-numeric attribute.
+//
+// Values which were not seen during training fall back on
+// the Fallback of the node which owns the ValSplit.
 type ValSplit map[Val]*Tree
+
+// fallbackClassification returns the classification of
+// samples which no branch of t can route.
+func fallbackClassification(t *Tree) map[Class]float64 {
+	if t.Fallback != nil {
+		return t.Fallback
+	}
+	return mergedClassification(t)
+}
+
+// mergedClassification combines the classifications of
+// the leaves of a tree, weighting branches by their
+// training weights.
+// If no branch has a positive weight, branches are
+// weighted equally.
+func mergedClassification(t *Tree) map[Class]float64 {
+	if t.leaf() {
+		return t.Classification
+	}
+	children := t.children()
+
+	var totalWeight float64
+	for _, child := range children {
+		totalWeight += child.Weight
+	}
+
+	res := map[Class]float64{}
+	for _, child := range children {
+		scaler := 1 / float64(len(children))
+		if totalWeight > 0 {
+			scaler = child.Weight / totalWeight
+		}
+		for class, prob := range mergedClassification(child) {
+			res[class] += prob * scaler
+		}
+	}
+	return res
+}
+
+// mergedSampleIndices combines the SampleIndices of all
+// the leaves under a node, or returns nil if there are
+// none.
+func mergedSampleIndices(t *Tree) []int {
+	seen := map[int]bool{}
+	var res []int
+	t.visit(func(node *Tree) {
+		for _, idx := range node.SampleIndices {
+			if !seen[idx] {
+				seen[idx] = true
+				res = append(res, idx)
+			}
+		}
+	})
+	sort.Ints(res)
+	return res
+}
+
+// copyTree creates a deep copy of a tree.
+func copyTree(t *Tree) *Tree {
+	res := &Tree{Attr: t.Attr, Gain: t.Gain, Weight: t.Weight,
+		SampleCount: t.SampleCount, Value: t.Value, MissingValue: t.MissingValue}
+	if t.SampleIndices != nil {
+		res.SampleIndices = append([]int{}, t.SampleIndices...)
+	}
+	if t.Classification != nil {
+		res.Classification = map[Class]float64{}
+		for class, prob := range t.Classification {
+			res.Classification[class] = prob
+		}
+	}
+	if t.Classifications != nil {
+		res.Classifications = make([]map[Class]float64, len(t.Classifications))
+		for i, dist := range t.Classifications {
+			res.Classifications[i] = map[Class]float64{}
+			for class, prob := range dist {
+				res.Classifications[i][class] = prob
+			}
+		}
+	}
+	for _, surrogate := range t.Surrogates {
+		if surrogate.Branches != nil {
+			branches := map[Val]Val{}
+			for val, key := range surrogate.Branches {
+				branches[val] = key
+			}
+			surrogate.Branches = branches
+		}
+		res.Surrogates = append(res.Surrogates, surrogate)
+	}
+	if t.NumSplit != nil {
+		var branches []*Tree
+		for _, child := range t.NumSplit.branches() {
+			branches = append(branches, copyTree(child))
+		}
+		res.NumSplit = t.NumSplit.withBranches(branches)
+	} else if t.ValSplit != nil {
+		res.ValSplit = ValSplit{}
+		for val, child := range t.ValSplit {
+			res.ValSplit[val] = copyTree(child)
+		}
+	}
+	if t.Fallback != nil {
+		res.Fallback = map[Class]float64{}
+		for class, prob := range t.Fallback {
+			res.Fallback[class] = prob
+		}
+	}
+	return res
+}
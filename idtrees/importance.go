@@ -0,0 +1,177 @@
+package idtrees
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// FeatureImportances computes the importance of each
+// attribute used by the tree.
+//
+// The samples, which are usually the training samples,
+// are routed through the tree.
+// At every split, the decrease in entropy caused by the
+// split (weighted by the total weight of the samples at
+// the split) is attributed to the split's attribute.
+// Samples which reach a split but which no branch or
+// surrogate can route are left out of its decrease.
+// The resulting importances are normalized to sum to 1.
+func (t *Tree) FeatureImportances(samples []Sample) map[Attr]float64 {
+	nodeSamples := map[*Tree][]Sample{}
+	routeSamples(t, samples, nodeSamples)
+
+	res := map[Attr]float64{}
+	var total float64
+	nodes := []*Tree{t}
+	for len(nodes) > 0 {
+		node := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+		if node.leaf() {
+			continue
+		}
+
+		children := node.children()
+
+		var routed []Sample
+		for _, s := range nodeSamples[node] {
+			if node.route(s) != nil {
+				routed = append(routed, s)
+			}
+		}
+		decrease := weightedEntropy(routed)
+		for _, child := range children {
+			decrease -= weightedEntropy(nodeSamples[child])
+		}
+		res[node.Attr] += decrease
+		total += decrease
+		nodes = append(nodes, children...)
+	}
+
+	if total > 0 {
+		for attr, importance := range res {
+			res[attr] = importance / total
+		}
+	}
+	return res
+}
+
+// PermutationImportance measures the importance of an
+// attribute as the drop in the tree's accuracy on the
+// samples when the attribute's values are shuffled
+// across the samples, which breaks the relationship
+// between the attribute and the classes.
+//
+// Unlike FeatureImportances, this does not favor
+// attributes with many distinct values, so it is best
+// computed on held-out samples.
+// The drop is averaged over the given number of random
+// shuffles, which defaults to 1 if repeats is not
+// positive.
+//
+// If rng is nil, the global source from math/rand is
+// used.
+func PermutationImportance(t *Tree, samples []Sample, attr Attr, repeats int,
+	rng *rand.Rand) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	if repeats < 1 {
+		repeats = 1
+	}
+	baseline := t.Accuracy(samples)
+
+	vals := make([]Val, len(samples))
+	for i, s := range samples {
+		vals[i] = s.Attr(attr)
+	}
+	permuted := make([]Sample, len(samples))
+	var drop float64
+	for i := 0; i < repeats; i++ {
+		for j := len(vals) - 1; j > 0; j-- {
+			k := randIntn(rng, j+1)
+			vals[j], vals[k] = vals[k], vals[j]
+		}
+		for j, s := range samples {
+			permuted[j] = &permutedSample{Sample: s, attr: attr, val: vals[j]}
+		}
+		drop += baseline - t.Accuracy(permuted)
+	}
+	return drop / float64(repeats)
+}
+
+// A permutedSample replaces the value of one attribute of
+// a sample.
+type permutedSample struct {
+	Sample
+	attr Attr
+	val  Val
+}
+
+func (p *permutedSample) Attr(attr Attr) Val {
+	if attr == p.attr {
+		return p.val
+	}
+	return p.Sample.Attr(attr)
+}
+
+// weightedEntropy computes the entropy of the samples,
+// scaled by their total weight.
+func weightedEntropy(samples []Sample) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	counter := newEntropyCounter(samples)
+	if counter.totalWeight <= 0 {
+		return 0
+	}
+	return counter.totalWeight * counter.Entropy()
+}
+
+// An AttrScore is the score of an attribute, as computed
+// by RankAttributes.
+type AttrScore struct {
+	Attr Attr
+
+	// Gain is the decrease in entropy caused by the best
+	// split on the attribute.
+	Gain float64
+
+	// Threshold is the threshold of the best split if the
+	// attribute is numerical, or nil otherwise.
+	Threshold Val
+}
+
+// RankAttributes computes the information gain of a split
+// on each attribute at the root of a tree, without
+// building the tree.
+// For numerical attributes, the gain of the best threshold
+// is used.
+//
+// The scores are sorted from most to least gain.
+// Attributes which cannot split the samples have a gain
+// of 0.
+func RankAttributes(samples []Sample, attrs []Attr) []AttrScore {
+	res := make([]AttrScore, len(attrs))
+	for i, attr := range attrs {
+		res[i].Attr = attr
+	}
+	if len(samples) > 0 {
+		b := (&Builder{MaxGos: 1}).newID3Builder(nil)
+		entropy := b.impurity(b.newCounter(samples))
+		root := b.presort(samples, attrs)
+		for i, attr := range attrs {
+			if split := b.createPotentialSplit(root, attr); split != nil {
+				res[i].Gain = entropy - split.Entropy
+				res[i].Threshold = split.Threshold
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Gain != res[j].Gain {
+			return res[i].Gain > res[j].Gain
+		}
+		return fmt.Sprintf("%v", res[i].Attr) < fmt.Sprintf("%v", res[j].Attr)
+	})
+	return res
+}
@@ -0,0 +1,483 @@
+package idtrees
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// jsonValue is the JSON representation of a Comparable,
+// tagged with its concrete type so that it can be
+// decoded exactly.
+//
+// The supported types are int, int64, float64, string,
+// and bool.
+type jsonValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+func newJSONValue(v Comparable) (*jsonValue, error) {
+	var typeName string
+	switch v.(type) {
+	case int:
+		typeName = "int"
+	case int64:
+		typeName = "int64"
+	case float64:
+		typeName = "float64"
+	case string:
+		typeName = "string"
+	case bool:
+		typeName = "bool"
+	default:
+		return nil, fmt.Errorf("cannot encode value of type %T", v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonValue{Type: typeName, Value: data}, nil
+}
+
+func (j *jsonValue) Comparable() (Comparable, error) {
+	var err error
+	switch j.Type {
+	case "int":
+		var x int
+		err = json.Unmarshal(j.Value, &x)
+		return x, err
+	case "int64":
+		var x int64
+		err = json.Unmarshal(j.Value, &x)
+		return x, err
+	case "float64":
+		var x float64
+		err = json.Unmarshal(j.Value, &x)
+		return x, err
+	case "string":
+		var x string
+		err = json.Unmarshal(j.Value, &x)
+		return x, err
+	case "bool":
+		var x bool
+		err = json.Unmarshal(j.Value, &x)
+		return x, err
+	default:
+		return nil, fmt.Errorf("cannot decode value of type %s", j.Type)
+	}
+}
+
+type jsonClassProb struct {
+	Class *jsonValue `json:"class"`
+	Prob  float64    `json:"prob"`
+}
+
+type jsonTree struct {
+	Classification  []jsonClassProb   `json:"classification"`
+	Classifications [][]jsonClassProb `json:"classifications,omitempty"`
+
+	Attr     *jsonValue `json:"attr,omitempty"`
+	NumSplit *NumSplit  `json:"numSplit,omitempty"`
+	ValSplit ValSplit   `json:"valSplit,omitempty"`
+
+	Fallback []jsonClassProb `json:"fallback,omitempty"`
+
+	Surrogates   []*jsonSurrogate `json:"surrogates,omitempty"`
+	MissingValue *jsonValue       `json:"missingValue,omitempty"`
+	Gain         float64          `json:"gain,omitempty"`
+
+	Weight      float64 `json:"weight"`
+	SampleCount int     `json:"sampleCount,omitempty"`
+	Value       float64 `json:"value,omitempty"`
+}
+
+// MarshalJSON encodes the tree as JSON.
+//
+// Attributes, values, and classes are tagged with their
+// types, so they must be int, int64, float64, string,
+// or bool values.
+func (t *Tree) MarshalJSON() ([]byte, error) {
+	obj := jsonTree{
+		NumSplit:    t.NumSplit,
+		ValSplit:    t.ValSplit,
+		Gain:        t.Gain,
+		Weight:      t.Weight,
+		SampleCount: t.SampleCount,
+		Value:       t.Value,
+	}
+	if t.Classification != nil {
+		c, err := newJSONClassification(t.Classification)
+		if err != nil {
+			return nil, err
+		}
+		obj.Classification = c
+	}
+	for _, dist := range t.Classifications {
+		c, err := newJSONClassification(dist)
+		if err != nil {
+			return nil, err
+		}
+		obj.Classifications = append(obj.Classifications, c)
+	}
+	if t.Fallback != nil {
+		c, err := newJSONClassification(t.Fallback)
+		if err != nil {
+			return nil, err
+		}
+		obj.Fallback = c
+	}
+	if t.Attr != nil {
+		a, err := newJSONValue(t.Attr)
+		if err != nil {
+			return nil, err
+		}
+		obj.Attr = a
+	}
+	if t.MissingValue != nil {
+		m, err := newJSONValue(t.MissingValue)
+		if err != nil {
+			return nil, err
+		}
+		obj.MissingValue = m
+	}
+	for i := range t.Surrogates {
+		surrogate, err := newJSONSurrogate(&t.Surrogates[i])
+		if err != nil {
+			return nil, err
+		}
+		obj.Surrogates = append(obj.Surrogates, surrogate)
+	}
+	return json.Marshal(&obj)
+}
+
+// UnmarshalJSON decodes a tree which was encoded with
+// MarshalJSON.
+func (t *Tree) UnmarshalJSON(data []byte) error {
+	var obj jsonTree
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*t = Tree{
+		NumSplit:    obj.NumSplit,
+		ValSplit:    obj.ValSplit,
+		Gain:        obj.Gain,
+		Weight:      obj.Weight,
+		SampleCount: obj.SampleCount,
+		Value:       obj.Value,
+	}
+	if obj.Classification != nil {
+		c, err := decodeJSONClassification(obj.Classification)
+		if err != nil {
+			return err
+		}
+		t.Classification = c
+	}
+	for _, entries := range obj.Classifications {
+		c, err := decodeJSONClassification(entries)
+		if err != nil {
+			return err
+		}
+		t.Classifications = append(t.Classifications, c)
+	}
+	if obj.Fallback != nil {
+		c, err := decodeJSONClassification(obj.Fallback)
+		if err != nil {
+			return err
+		}
+		t.Fallback = c
+	}
+	if obj.Attr != nil {
+		attr, err := obj.Attr.Comparable()
+		if err != nil {
+			return err
+		}
+		t.Attr = attr
+	}
+	if obj.MissingValue != nil {
+		m, err := obj.MissingValue.Comparable()
+		if err != nil {
+			return err
+		}
+		t.MissingValue = m
+	}
+	for _, entry := range obj.Surrogates {
+		surrogate, err := entry.Surrogate()
+		if err != nil {
+			return err
+		}
+		t.Surrogates = append(t.Surrogates, *surrogate)
+	}
+	return nil
+}
+
+func newJSONClassification(c map[Class]float64) ([]jsonClassProb, error) {
+	res := []jsonClassProb{}
+	for _, class := range sortedClasses(c) {
+		v, err := newJSONValue(class)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, jsonClassProb{v, c[class]})
+	}
+	return res, nil
+}
+
+func decodeJSONClassification(entries []jsonClassProb) (map[Class]float64, error) {
+	res := map[Class]float64{}
+	for _, entry := range entries {
+		if entry.Class == nil {
+			return nil, errors.New("missing class in classification")
+		}
+		class, err := entry.Class.Comparable()
+		if err != nil {
+			return nil, err
+		}
+		res[class] = entry.Prob
+	}
+	return res, nil
+}
+
+type jsonSurrogate struct {
+	Attr      *jsonValue            `json:"attr"`
+	Threshold *jsonValue            `json:"threshold,omitempty"`
+	LessEqual *jsonValue            `json:"lessEqual,omitempty"`
+	Greater   *jsonValue            `json:"greater,omitempty"`
+	Branches  []jsonSurrogateBranch `json:"branches,omitempty"`
+	Agreement float64               `json:"agreement"`
+
+	MissingValue *jsonValue `json:"missingValue,omitempty"`
+}
+
+type jsonSurrogateBranch struct {
+	Value  *jsonValue `json:"value"`
+	Branch *jsonValue `json:"branch"`
+}
+
+func newJSONSurrogate(s *Surrogate) (*jsonSurrogate, error) {
+	res := &jsonSurrogate{Agreement: s.Agreement}
+	var err error
+	if res.Attr, err = newJSONValue(s.Attr); err != nil {
+		return nil, err
+	}
+	if s.MissingValue != nil {
+		if res.MissingValue, err = newJSONValue(s.MissingValue); err != nil {
+			return nil, err
+		}
+	}
+	if s.Threshold != nil {
+		if res.Threshold, err = newJSONValue(s.Threshold); err != nil {
+			return nil, err
+		}
+		if res.LessEqual, err = newJSONValue(s.LessEqual); err != nil {
+			return nil, err
+		}
+		if res.Greater, err = newJSONValue(s.Greater); err != nil {
+			return nil, err
+		}
+	}
+	vals := make([]Val, 0, len(s.Branches))
+	for val := range s.Branches {
+		vals = append(vals, val)
+	}
+	sortByValue(vals)
+	for _, val := range vals {
+		v, err := newJSONValue(val)
+		if err != nil {
+			return nil, err
+		}
+		b, err := newJSONValue(s.Branches[val])
+		if err != nil {
+			return nil, err
+		}
+		res.Branches = append(res.Branches, jsonSurrogateBranch{v, b})
+	}
+	return res, nil
+}
+
+func (j *jsonSurrogate) Surrogate() (*Surrogate, error) {
+	if j.Attr == nil {
+		return nil, errors.New("missing surrogate attribute")
+	}
+	res := &Surrogate{Agreement: j.Agreement}
+	var err error
+	if res.Attr, err = j.Attr.Comparable(); err != nil {
+		return nil, err
+	}
+	if j.MissingValue != nil {
+		if res.MissingValue, err = j.MissingValue.Comparable(); err != nil {
+			return nil, err
+		}
+	}
+	if j.Threshold != nil {
+		if j.LessEqual == nil || j.Greater == nil {
+			return nil, errors.New("incomplete numerical surrogate")
+		}
+		if res.Threshold, err = j.Threshold.Comparable(); err != nil {
+			return nil, err
+		}
+		if res.LessEqual, err = j.LessEqual.Comparable(); err != nil {
+			return nil, err
+		}
+		if res.Greater, err = j.Greater.Comparable(); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	res.Branches = map[Val]Val{}
+	for _, entry := range j.Branches {
+		if entry.Value == nil || entry.Branch == nil {
+			return nil, errors.New("incomplete surrogate branch")
+		}
+		val, err := entry.Value.Comparable()
+		if err != nil {
+			return nil, err
+		}
+		branch, err := entry.Branch.Comparable()
+		if err != nil {
+			return nil, err
+		}
+		res.Branches[val] = branch
+	}
+	return res, nil
+}
+
+type jsonNumSplit struct {
+	Threshold  *jsonValue   `json:"threshold,omitempty"`
+	Order      []*jsonValue `json:"order,omitempty"`
+	LessEqual  *Tree        `json:"lessEqual,omitempty"`
+	Greater    *Tree        `json:"greater,omitempty"`
+	Thresholds []*jsonValue `json:"thresholds,omitempty"`
+	Branches   []*Tree      `json:"branches,omitempty"`
+}
+
+// MarshalJSON encodes the split as JSON.
+func (n *NumSplit) MarshalJSON() ([]byte, error) {
+	if n.Thresholds != nil {
+		obj := jsonNumSplit{Branches: n.Branches}
+		for _, val := range n.Thresholds {
+			v, err := newJSONValue(val)
+			if err != nil {
+				return nil, err
+			}
+			obj.Thresholds = append(obj.Thresholds, v)
+		}
+		return json.Marshal(&obj)
+	}
+	threshold, err := newJSONValue(n.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	obj := jsonNumSplit{
+		Threshold: threshold,
+		LessEqual: n.LessEqual,
+		Greater:   n.Greater,
+	}
+	for _, val := range n.Order {
+		v, err := newJSONValue(val)
+		if err != nil {
+			return nil, err
+		}
+		obj.Order = append(obj.Order, v)
+	}
+	return json.Marshal(&obj)
+}
+
+// UnmarshalJSON decodes a split which was encoded with
+// MarshalJSON.
+func (n *NumSplit) UnmarshalJSON(data []byte) error {
+	var obj jsonNumSplit
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	if obj.Thresholds != nil {
+		return n.unmarshalMultiway(&obj)
+	}
+	if obj.Threshold == nil || obj.LessEqual == nil || obj.Greater == nil {
+		return errors.New("incomplete numerical split")
+	}
+	threshold, err := obj.Threshold.Comparable()
+	if err != nil {
+		return err
+	}
+	*n = NumSplit{
+		Threshold: threshold,
+		LessEqual: obj.LessEqual,
+		Greater:   obj.Greater,
+	}
+	for _, v := range obj.Order {
+		if v == nil {
+			return errors.New("missing value in split order")
+		}
+		val, err := v.Comparable()
+		if err != nil {
+			return err
+		}
+		n.Order = append(n.Order, val)
+	}
+	return nil
+}
+
+func (n *NumSplit) unmarshalMultiway(obj *jsonNumSplit) error {
+	if len(obj.Branches) != len(obj.Thresholds)+1 {
+		return errors.New("multi-way split has wrong number of branches")
+	}
+	*n = NumSplit{}
+	for _, v := range obj.Thresholds {
+		if v == nil {
+			return errors.New("missing multi-way split threshold")
+		}
+		val, err := v.Comparable()
+		if err != nil {
+			return err
+		}
+		n.Thresholds = append(n.Thresholds, val)
+	}
+	for _, branch := range obj.Branches {
+		if branch == nil {
+			return errors.New("incomplete numerical split")
+		}
+	}
+	n.Branches = obj.Branches
+	return nil
+}
+
+type jsonBranch struct {
+	Value *jsonValue `json:"value"`
+	Tree  *Tree      `json:"tree"`
+}
+
+// MarshalJSON encodes the split as a JSON list of
+// branches.
+func (v ValSplit) MarshalJSON() ([]byte, error) {
+	branches := []jsonBranch{}
+	for _, val := range sortedValues(v) {
+		jsonVal, err := newJSONValue(val)
+		if err != nil {
+			return nil, err
+		}
+		branches = append(branches, jsonBranch{jsonVal, v[val]})
+	}
+	return json.Marshal(branches)
+}
+
+// UnmarshalJSON decodes a split which was encoded with
+// MarshalJSON.
+func (v *ValSplit) UnmarshalJSON(data []byte) error {
+	var branches []jsonBranch
+	if err := json.Unmarshal(data, &branches); err != nil {
+		return err
+	}
+	*v = ValSplit{}
+	for _, branch := range branches {
+		if branch.Value == nil || branch.Tree == nil {
+			return errors.New("incomplete value split branch")
+		}
+		val, err := branch.Value.Comparable()
+		if err != nil {
+			return err
+		}
+		(*v)[val] = branch.Tree
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package idtrees
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTreeJSON(t *testing.T) {
+	samples := []Sample{
+		treeTestSample{"age": int64(3), "height": 2.0, "color": "red", "class": "child"},
+		treeTestSample{"age": int64(5), "height": 3.0, "color": "blue", "class": "child"},
+		treeTestSample{"age": int64(30), "height": 5.5, "color": "red", "class": int64(1)},
+		treeTestSample{"age": int64(32), "height": 5.0, "color": "blue", "class": true},
+		treeTestSample{"age": int64(40), "height": 6.0, "color": "green", "class": 3.5},
+	}
+	attrs := []Attr{"age", "height", "color"}
+	tree := ID3(samples, attrs, 1)
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded *Tree
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !treesEqual(tree, decoded) {
+		t.Fatalf("expected %s but got %s", tree, decoded)
+	}
+	ageSplit := decoded.ValSplit["red"].NumSplit
+	if _, ok := ageSplit.Threshold.(int64); !ok {
+		t.Errorf("threshold has type %T", ageSplit.Threshold)
+	}
+	testSamples := append(samples, treeTestSample{"age": int64(31), "height": 5.2,
+		"color": "purple"})
+	for _, s := range testSamples {
+		expected := tree.Classify(s)
+		actual := decoded.Classify(s)
+		if len(expected) != len(actual) {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+		for class, prob := range expected {
+			if actual[class] != prob {
+				t.Errorf("expected %v but got %v", expected, actual)
+			}
+		}
+	}
+}
+
+func TestTreeJSONUnsupportedType(t *testing.T) {
+	tree := &Tree{Classification: map[Class]float64{struct{}{}: 1}}
+	if _, err := json.Marshal(tree); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+}
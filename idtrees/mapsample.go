@@ -0,0 +1,69 @@
+package idtrees
+
+// A MapSample is a Sample which stores its attributes in
+// a map from attribute names to values.
+type MapSample struct {
+	Values map[string]Val
+	Label  Class
+}
+
+// NewMapSample creates a MapSample with the given
+// attributes and class.
+//
+// Numerical attribute values are normalized so that ID3
+// splits them on thresholds: signed and unsigned integer
+// types become int64, and float32 values become float64.
+// Other values are stored as they are.
+func NewMapSample(attrs map[string]interface{}, class interface{}) *MapSample {
+	res := &MapSample{
+		Values: make(map[string]Val, len(attrs)),
+		Label:  class,
+	}
+	for name, val := range attrs {
+		res.Values[name] = normalizeNumber(val)
+	}
+	return res
+}
+
+// Attr returns the value of the attribute, which should
+// be a string.
+// It returns nil for unknown attributes.
+func (m *MapSample) Attr(attr Attr) Val {
+	name, ok := attr.(string)
+	if !ok {
+		return nil
+	}
+	return m.Values[name]
+}
+
+// Class returns the sample's label.
+func (m *MapSample) Class() Class {
+	return m.Label
+}
+
+func normalizeNumber(val interface{}) interface{} {
+	switch val := val.(type) {
+	case int:
+		return int64(val)
+	case int8:
+		return int64(val)
+	case int16:
+		return int64(val)
+	case int32:
+		return int64(val)
+	case uint:
+		return int64(val)
+	case uint8:
+		return int64(val)
+	case uint16:
+		return int64(val)
+	case uint32:
+		return int64(val)
+	case uint64:
+		return int64(val)
+	case float32:
+		return float64(val)
+	default:
+		return val
+	}
+}
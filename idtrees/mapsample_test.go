@@ -0,0 +1,37 @@
+package idtrees
+
+import "testing"
+
+func TestMapSample(t *testing.T) {
+	samples := []Sample{
+		NewMapSample(map[string]interface{}{"age": 3, "height": float32(2.5),
+			"color": "red"}, "child"),
+		NewMapSample(map[string]interface{}{"age": int32(5), "height": 3.0,
+			"color": "blue"}, "child"),
+		NewMapSample(map[string]interface{}{"age": uint8(30), "height": 5.5,
+			"color": "red"}, "adult"),
+		NewMapSample(map[string]interface{}{"age": int64(32), "height": float32(5),
+			"color": "blue"}, "adult"),
+	}
+	for _, s := range samples {
+		if _, ok := s.Attr("age").(int64); !ok {
+			t.Errorf("age has type %T", s.Attr("age"))
+		}
+		if _, ok := s.Attr("height").(float64); !ok {
+			t.Errorf("height has type %T", s.Attr("height"))
+		}
+	}
+	if val := samples[0].Attr("missing"); val != nil {
+		t.Errorf("expected nil for unknown attribute but got %v", val)
+	}
+
+	tree := ID3(samples, []Attr{"age", "height", "color"}, 0)
+	if tree.NumSplit == nil {
+		t.Fatal("expected a numerical split")
+	}
+	for _, s := range samples {
+		if class := tree.ClassifyOne(s); class != s.Class() {
+			t.Errorf("expected %v but got %v", s.Class(), class)
+		}
+	}
+}
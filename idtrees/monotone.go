@@ -0,0 +1,48 @@
+package idtrees
+
+import "math"
+
+// monotone checks if a numerical split on an attribute
+// satisfies the attribute's monotone constraint, given
+// the counters of its two branches.
+func (b *id3Builder) monotone(attr Attr, less, greater splitCounter) bool {
+	dir := b.MonotoneConstraints[attr]
+	if dir == 0 || !b.Regression {
+		return true
+	}
+	lessMean := less.(*varianceCounter).mean
+	greaterMean := greater.(*varianceCounter).mean
+	if dir > 0 {
+		return lessMean <= greaterMean
+	}
+	return lessMean >= greaterMean
+}
+
+// partitionNumeric partitions the samples of a node for
+// the two branches of a numerical split.
+//
+// If the split's attribute has a monotone constraint,
+// the bounds of the branches are narrowed so that every
+// target in one branch is on the correct side of every
+// target in the other.
+func (b *id3Builder) partitionNumeric(node *nodeSamples,
+	split *potentialSplit) (less, greater *nodeSamples) {
+	less = b.partition(node, split.NumSplitSamples[0])
+	greater = b.partition(node, split.NumSplitSamples[1])
+
+	dir := b.MonotoneConstraints[split.Attr]
+	if dir == 0 || !b.Regression {
+		return less, greater
+	}
+	lessMean := newVarianceCounter(less.Samples).mean
+	greaterMean := newVarianceCounter(greater.Samples).mean
+	mid := math.Max(node.Lower, math.Min(node.Upper, (lessMean+greaterMean)/2))
+	if dir > 0 {
+		less.Upper = mid
+		greater.Lower = mid
+	} else {
+		less.Lower = mid
+		greater.Upper = mid
+	}
+	return less, greater
+}
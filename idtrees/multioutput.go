@@ -0,0 +1,250 @@
+package idtrees
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A MultiSample has a set of attributes and several
+// independent classes, one per output.
+//
+// Every MultiSample in a training set must have the same
+// number of outputs.
+type MultiSample interface {
+	AttrMap
+
+	// Classes returns the class of this sample for each
+	// output.
+	// As with Sample, classes must be comparable.
+	Classes() []Class
+}
+
+// MultiOutputID3 is like ID3, but it generates a
+// multi-output tree for the samples.
+//
+// See Builder.BuildMulti for details.
+func MultiOutputID3(samples []MultiSample, attrs []Attr, maxGos int) *Tree {
+	b := &Builder{MaxGos: maxGos}
+	return b.BuildMulti(samples, attrs)
+}
+
+// BuildMulti generates a multi-output tree, whose leaves
+// store one class distribution per output in their
+// Classifications field.
+//
+// The impurity of a node is the sum of its impurities
+// for each output, so a single tree learns to predict
+// all of the outputs at once.
+// Samples may implement a Weight method to be weighted,
+// as with WeightedSample.
+//
+// Regression is ignored by BuildMulti.
+// Use ClassifyMulti to classify samples with the tree.
+func (b *Builder) BuildMulti(samples []MultiSample, attrs []Attr) *Tree {
+	numOutputs := 0
+	if len(samples) > 0 {
+		numOutputs = len(samples[0].Classes())
+	}
+	wrapped := make([]Sample, len(samples))
+	for i, s := range samples {
+		classes := s.Classes()
+		if len(classes) != numOutputs {
+			panic("samples have different numbers of outputs")
+		}
+		wrapped[i] = &multiOutputSample{
+			MultiSample: s,
+			classes:     classes,
+			key:         multiClassKey(classes),
+		}
+	}
+	s := b.newID3Builder(nil)
+	s.Regression = false
+	s.numOutputs = numOutputs
+	return s.build(wrapped, attrs, b.maxDepth())
+}
+
+// ClassifyMulti follows a multi-output tree for the
+// given sample and returns the resulting class
+// distribution for each output.
+//
+// Missing values are handled as in Classify.
+func (t *Tree) ClassifyMulti(s AttrMap) []map[Class]float64 {
+	for !t.leaf() {
+		child := t.route(s)
+		if child == nil {
+			return mergedClassifications(t)
+		}
+		t = child
+	}
+	return t.Classifications
+}
+
+func mergedClassifications(t *Tree) []map[Class]float64 {
+	if t.leaf() {
+		return t.Classifications
+	}
+	children := t.children()
+
+	var totalWeight float64
+	for _, child := range children {
+		totalWeight += child.Weight
+	}
+
+	var res []map[Class]float64
+	for _, child := range children {
+		scaler := 1 / float64(len(children))
+		if totalWeight > 0 {
+			scaler = child.Weight / totalWeight
+		}
+		for i, dist := range mergedClassifications(child) {
+			if i == len(res) {
+				res = append(res, map[Class]float64{})
+			}
+			for class, prob := range dist {
+				res[i][class] += prob * scaler
+			}
+		}
+	}
+	return res
+}
+
+// multiOutputSample adapts a MultiSample to a Sample.
+//
+// Its class is a key which is unique to the combination
+// of its classes, so a node is pure exactly when every
+// output is pure.
+type multiOutputSample struct {
+	MultiSample
+	classes []Class
+	key     string
+}
+
+func (m *multiOutputSample) Class() Class {
+	return m.key
+}
+
+func (m *multiOutputSample) Weight() float64 {
+	if w, ok := m.MultiSample.(interface {
+		Weight() float64
+	}); ok {
+		return w.Weight()
+	}
+	return 1
+}
+
+func multiClassKey(classes []Class) string {
+	parts := make([]string, len(classes))
+	for i, class := range classes {
+		parts[i] = fmt.Sprintf("%#v", class)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// sampleClasses returns the classes of a sample which
+// wraps a multiOutputSample.
+func sampleClasses(s Sample) []Class {
+	for {
+		switch x := s.(type) {
+		case *multiOutputSample:
+			return x.classes
+		case *sentinelSample:
+			s = x.Sample
+		case *indexedSample:
+			s = x.Sample
+		case *scaledSample:
+			s = x.Sample
+		default:
+			panic("sample has no outputs")
+		}
+	}
+}
+
+// multiCounter counts the class distribution of every
+// output, and its impurities are the sums of the
+// impurities of the outputs.
+type multiCounter struct {
+	outputs []*entropyCounter
+}
+
+func newMultiCounter(s []Sample, numOutputs int) *multiCounter {
+	res := &multiCounter{outputs: make([]*entropyCounter, numOutputs)}
+	for i := range res.outputs {
+		res.outputs[i] = &entropyCounter{classWeights: map[Class]float64{}}
+	}
+	for _, sample := range s {
+		res.Add(sample)
+	}
+	return res
+}
+
+func (m *multiCounter) Add(s Sample) {
+	w := sampleWeight(s)
+	for i, class := range sampleClasses(s) {
+		output := m.outputs[i]
+		if _, ok := output.classWeights[class]; !ok {
+			output.addClass(class)
+		}
+		output.updateWeight(class, w)
+	}
+}
+
+func (m *multiCounter) Remove(s Sample) {
+	w := sampleWeight(s)
+	for i, class := range sampleClasses(s) {
+		m.outputs[i].updateWeight(class, -w)
+	}
+}
+
+func (m *multiCounter) clone() splitCounter {
+	res := &multiCounter{outputs: make([]*entropyCounter, len(m.outputs))}
+	for i, output := range m.outputs {
+		res.outputs[i] = output.clone().(*entropyCounter)
+	}
+	return res
+}
+
+func (m *multiCounter) TotalWeight() float64 {
+	if len(m.outputs) == 0 {
+		return 0
+	}
+	return m.outputs[0].totalWeight
+}
+
+func (m *multiCounter) Entropy() float64 {
+	var res float64
+	for _, output := range m.outputs {
+		res += output.Entropy()
+	}
+	return res
+}
+
+func (m *multiCounter) Gini() float64 {
+	var res float64
+	for _, output := range m.outputs {
+		res += output.Gini()
+	}
+	return res
+}
+
+// createMultiLeaf creates a leaf whose Classifications
+// are the weighted class distributions of each output.
+func createMultiLeaf(samples []Sample, numOutputs int) *Tree {
+	counter := newMultiCounter(samples, numOutputs)
+	res := &Tree{
+		Classifications: make([]map[Class]float64, numOutputs),
+		Weight:          counter.TotalWeight(),
+	}
+	for i, output := range counter.outputs {
+		dist := map[Class]float64{}
+		if output.totalWeight > 0 {
+			totalScaler := 1 / output.totalWeight
+			for class, weight := range output.classWeights {
+				if weight > 0 {
+					dist[class] = weight * totalScaler
+				}
+			}
+		}
+		res.Classifications[i] = dist
+	}
+	return res
+}
@@ -0,0 +1,118 @@
+package idtrees
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+type multiTestSample struct {
+	values  map[Attr]Val
+	classes []Class
+}
+
+func (m *multiTestSample) Attr(a Attr) Val {
+	return m.values[a]
+}
+
+func (m *multiTestSample) Classes() []Class {
+	return m.classes
+}
+
+func TestMultiOutputID3(t *testing.T) {
+	rng := rand.New(rand.NewSource(1337))
+	var samples []MultiSample
+	for i := 0; i < 200; i++ {
+		x := rng.Float64()
+		color := []string{"red", "green", "blue"}[rng.Intn(3)]
+		big := x > 0.5
+		// The second output is correlated with the first,
+		// but it also depends on the color.
+		warm := big && color == "red"
+		if color == "green" {
+			warm = !big
+		}
+		samples = append(samples, &multiTestSample{
+			values:  map[Attr]Val{"x": x, "color": color},
+			classes: []Class{big, warm},
+		})
+	}
+
+	tree := MultiOutputID3(samples, []Attr{"x", "color"}, 0)
+	checkMulti := func(tree *Tree) {
+		for _, s := range samples {
+			dists := tree.ClassifyMulti(s)
+			if len(dists) != 2 {
+				t.Fatalf("expected 2 outputs but got %d", len(dists))
+			}
+			for i, class := range s.Classes() {
+				if dists[i][class] != 1 {
+					t.Fatalf("output %d: expected %v but got %v", i, class, dists[i])
+				}
+			}
+		}
+	}
+	checkMulti(tree)
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded *Tree
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !treesEqual(tree, decoded) {
+		t.Error("tree changed after JSON round trip")
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(tree); err != nil {
+		t.Fatal(err)
+	}
+	decoded = nil
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkMulti(decoded)
+
+	missing := &multiTestSample{values: map[Attr]Val{}}
+	for i, dist := range tree.ClassifyMulti(missing) {
+		var total float64
+		for _, prob := range dist {
+			total += prob
+		}
+		if total < 0.999 || total > 1.001 {
+			t.Errorf("output %d: bad distribution %v", i, dist)
+		}
+	}
+}
+
+func TestMultiOutputStrings(t *testing.T) {
+	samples := []MultiSample{
+		&multiTestSample{values: map[Attr]Val{"x": 0.0}, classes: []Class{"a", "x"}},
+		&multiTestSample{values: map[Attr]Val{"x": 1.0}, classes: []Class{"b", "x"}},
+	}
+	tree := MultiOutputID3(samples, []Attr{"x"}, 0)
+
+	expected := "|--- x <= 0.5\n" +
+		"|   |--- class=a p=1.00; class=x p=1.00\n" +
+		"|--- x > 0.5\n" +
+		"|   |--- class=b p=1.00; class=x p=1.00"
+	if tree.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, tree)
+	}
+
+	dot := tree.DOT()
+	for _, label := range []string{`a=100.00%\nx=100.00%`, `b=100.00%\nx=100.00%`} {
+		if !strings.Contains(dot, label) {
+			t.Errorf("DOT output is missing %q:\n%s", label, dot)
+		}
+	}
+	if strings.Contains(dot, "value=") {
+		t.Errorf("DOT output has regression leaves:\n%s", dot)
+	}
+}
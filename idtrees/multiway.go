@@ -0,0 +1,172 @@
+package idtrees
+
+import "sort"
+
+// branches returns the branches of the split, from the
+// one for the smallest values to the one for the
+// largest.
+func (n *NumSplit) branches() []*Tree {
+	if n.Branches != nil {
+		return n.Branches
+	}
+	return []*Tree{n.LessEqual, n.Greater}
+}
+
+// branchTests describes the test which leads to each of
+// the branches of the split, in the same order as
+// branches.
+func (n *NumSplit) branchTests(attr string) []string {
+	if n.Branches == nil {
+		threshold := valueString(n.Threshold)
+		return []string{attr + " <= " + threshold, attr + " > " + threshold}
+	}
+	res := make([]string, len(n.Branches))
+	for i := range res {
+		switch i {
+		case 0:
+			res[i] = attr + " <= " + valueString(n.Thresholds[0])
+		case len(n.Thresholds):
+			res[i] = attr + " > " + valueString(n.Thresholds[i-1])
+		default:
+			res[i] = valueString(n.Thresholds[i-1]) + " < " + attr + " <= " +
+				valueString(n.Thresholds[i])
+		}
+	}
+	return res
+}
+
+// multiwayChild finds the branch of a multi-way split
+// for a numerical value.
+func (n *NumSplit) multiwayChild(val Val) *Tree {
+	idx := sort.Search(len(n.Thresholds), func(i int) bool {
+		return !numericGreater(val, n.Thresholds[i])
+	})
+	return n.Branches[idx]
+}
+
+// withBranches copies the split, replacing its branches
+// with new ones in the same order as branches.
+func (n *NumSplit) withBranches(branches []*Tree) *NumSplit {
+	res := &NumSplit{Threshold: n.Threshold, Order: n.Order, Thresholds: n.Thresholds}
+	if n.Branches != nil {
+		res.Branches = branches
+	} else {
+		res.LessEqual, res.Greater = branches[0], branches[1]
+	}
+	return res
+}
+
+// binaryChain returns a node equivalent to one with a
+// multi-way split, in which the split is replaced by a
+// chain of binary splits, each of which separates one
+// branch from those for larger values.
+func binaryChain(t *Tree) *Tree {
+	split := t.NumSplit
+	res := split.Branches[len(split.Thresholds)]
+	for i := len(split.Thresholds) - 1; i >= 0; i-- {
+		less := split.Branches[i]
+		res = &Tree{
+			Attr: t.Attr,
+			NumSplit: &NumSplit{
+				Threshold: split.Thresholds[i],
+				LessEqual: less,
+				Greater:   res,
+			},
+			SampleCount: less.SampleCount + res.SampleCount,
+			Weight:      less.Weight + res.Weight,
+		}
+	}
+	res.SampleCount = t.SampleCount
+	res.Weight = t.Weight
+	return res
+}
+
+// createMultiwaySplit finds a split of a numerical
+// attribute with up to NumericBranches branches, given
+// the samples sorted by that attribute.
+//
+// It returns a binary split if no further threshold
+// reduces the impurity.
+func (b *id3Builder) createMultiwaySplit(samples []Sample, attr Attr,
+	total splitCounter) *potentialSplit {
+	cutoffIdxs, cutoffs := numericCutoffs(samples, attr)
+	best := b.createNumericSplit(sampleSorter{Attr: attr, Samples: samples}, cutoffIdxs,
+		cutoffs, total)
+	if best == nil {
+		return nil
+	}
+
+	thresholds := []Val{best.Threshold}
+	segments := best.NumSplitSamples[:]
+	entropies := best.NumSplitEntropies[:]
+	weights := make([]float64, len(segments))
+	for i, segment := range segments {
+		weights[i] = b.newCounter(segment).TotalWeight()
+	}
+
+	for len(segments) < b.NumericBranches {
+		var bestSplit *potentialSplit
+		var bestIdx int
+		var bestReduction float64
+		for i, segment := range segments {
+			split := b.createSegmentSplit(segment, attr)
+			if split == nil {
+				continue
+			}
+			reduction := weights[i] * (entropies[i] - split.Entropy)
+			if reduction > bestReduction {
+				bestSplit, bestIdx, bestReduction = split, i, reduction
+			}
+		}
+		if bestSplit == nil {
+			break
+		}
+		thresholds = insertVal(thresholds, bestIdx, bestSplit.Threshold)
+		segments = append(segments[:bestIdx:bestIdx], append(bestSplit.NumSplitSamples[:],
+			segments[bestIdx+1:]...)...)
+		entropies = append(entropies[:bestIdx:bestIdx], append(bestSplit.NumSplitEntropies[:],
+			entropies[bestIdx+1:]...)...)
+		splitWeights := []float64{
+			b.newCounter(bestSplit.NumSplitSamples[0]).TotalWeight(),
+			b.newCounter(bestSplit.NumSplitSamples[1]).TotalWeight(),
+		}
+		weights = append(weights[:bestIdx:bestIdx], append(splitWeights,
+			weights[bestIdx+1:]...)...)
+	}
+	if len(thresholds) == 1 {
+		return best
+	}
+
+	res := &potentialSplit{
+		Attr:                attr,
+		Thresholds:          thresholds,
+		MultiSplitEntropies: entropies,
+		MultiSplitSamples:   segments,
+	}
+	var totalWeight float64
+	for i, w := range weights {
+		res.Entropy += w * entropies[i]
+		totalWeight += w
+	}
+	res.Entropy /= totalWeight
+	return res
+}
+
+// createSegmentSplit finds the best binary split of a
+// range of a multi-way split, given its sorted samples.
+func (b *id3Builder) createSegmentSplit(samples []Sample, attr Attr) *potentialSplit {
+	if len(samples) < 2 {
+		return nil
+	}
+	cutoffIdxs, cutoffs := numericCutoffs(samples, attr)
+	return b.createNumericSplit(sampleSorter{Attr: attr, Samples: samples}, cutoffIdxs,
+		cutoffs, nil)
+}
+
+// insertVal inserts a value into a slice at index i.
+func insertVal(vals []Val, i int, val Val) []Val {
+	res := make([]Val, 0, len(vals)+1)
+	res = append(res, vals[:i]...)
+	res = append(res, val)
+	return append(res, vals[i:]...)
+}
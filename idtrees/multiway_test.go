@@ -0,0 +1,123 @@
+package idtrees
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestNumericBranches(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 30; i++ {
+		for j, class := range []string{"a", "b", "c"} {
+			x := float64(j*5 + i%3)
+			samples = append(samples, treeTestSample{"x": x, "class": class})
+		}
+	}
+	attrs := []Attr{"x"}
+
+	binary := (&Builder{MaxDepth: 1}).Build(samples, attrs)
+	if binary.NumSplit == nil || binary.NumSplit.Branches != nil {
+		t.Fatal("expected a binary split by default")
+	}
+
+	tree := (&Builder{MaxDepth: 1, NumericBranches: 3}).Build(samples, attrs)
+	if tree.NumSplit == nil || len(tree.NumSplit.Branches) != 3 {
+		t.Fatalf("expected a three-way split but got %s", tree)
+	}
+	for _, s := range samples {
+		class, _ := topClass(tree.Classify(s))
+		if class != s.Class() {
+			t.Errorf("sample %v: got class %v", s, class)
+		}
+	}
+	expected := "|--- x <= 3.5\n" +
+		"|   |--- class=a p=1.00\n" +
+		"|--- 3.5 < x <= 8.5\n" +
+		"|   |--- class=b p=1.00\n" +
+		"|--- x > 8.5\n" +
+		"|   |--- class=c p=1.00"
+	if tree.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, tree)
+	}
+
+	res, err := tree.Sklearn(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSklearnTree(t, res)
+	for _, s := range samples {
+		expected := tree.Classify(s)
+		actual := sklearnPredict(res, attrs, s)
+		for i, class := range res.Classes {
+			if math.Abs(actual[i]-expected[class]) > 1e-8 {
+				t.Fatalf("sample %v: expected %v but got %v", s, expected, actual)
+			}
+		}
+	}
+
+	// More branches are only added if they help.
+	tree = (&Builder{MaxDepth: 1, NumericBranches: 5}).Build(samples, attrs)
+	if tree.NumSplit == nil || len(tree.NumSplit.Branches) != 3 {
+		t.Fatalf("expected a three-way split but got %s", tree)
+	}
+}
+
+func TestNumericBranchesEncoding(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(1000, 4)
+	for i, s := range samples {
+		if i%10 == 0 {
+			s.(treeTestSample)[1] = nil
+		}
+	}
+	attrs := []Attr{0, 1, 2, 3}
+	tree := (&Builder{MaxDepth: 3, NumericBranches: 4}).Build(samples, attrs)
+	var multiway bool
+	tree.visit(func(node *Tree) {
+		if node.NumSplit != nil && node.NumSplit.Branches != nil {
+			multiway = true
+		}
+	})
+	if !multiway {
+		t.Fatal("expected a multi-way split")
+	}
+
+	binaryData, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromBinary Tree
+	if err := fromBinary.UnmarshalBinary(binaryData); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonData, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON *Tree
+	if err := json.Unmarshal(jsonData, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(tree); err != nil {
+		t.Fatal(err)
+	}
+	var fromGob *Tree
+	if err := gob.NewDecoder(&buf).Decode(&fromGob); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, decoded := range map[string]*Tree{"binary": &fromBinary, "JSON": fromJSON,
+		"gob": fromGob} {
+		if !treesEqual(tree, decoded) {
+			t.Errorf("%s: tree changed after round trip", name)
+		}
+	}
+
+}
@@ -0,0 +1,77 @@
+package idtrees
+
+import "fmt"
+
+// A Decision describes one step of the path that a
+// sample takes through a tree.
+type Decision struct {
+	// Attr is the attribute of the node.
+	Attr Attr
+
+	// Value is the sample's value for Attr, which is nil
+	// if the value was missing.
+	Value Val
+
+	// Test describes the branch which was taken, such as
+	// "age <= 40", "age > 40", "20 < age <= 40", or
+	// "color == red".
+	// If Missing is true, it describes the failed test
+	// instead, such as "color == purple" or
+	// "color is missing".
+	Test string
+
+	// Missing is true if no branch could be taken, in
+	// which case the classifications of all the branches
+	// were combined, as in Classify.
+	// This is always the last decision of a path.
+	Missing bool
+}
+
+// ClassifyPath is like Classify, but it also returns the
+// decisions which were made at each node along the way,
+// from the root to the leaf.
+//
+// If a split's surrogates were used to pick a branch, the
+// decision has a nil Value, but its Test still describes
+// the branch in terms of the split's attribute.
+func (t *Tree) ClassifyPath(s AttrMap) ([]Decision, map[Class]float64) {
+	var path []Decision
+	for !t.leaf() {
+		decision := Decision{Attr: t.Attr, Value: t.value(s)}
+		child := t.route(s)
+		if child == nil {
+			decision.Missing = true
+			if decision.Value == nil {
+				decision.Test = fmt.Sprintf("%v is missing", t.Attr)
+			} else {
+				decision.Test = fmt.Sprintf("%v == %s", t.Attr, valueString(decision.Value))
+			}
+			return append(path, decision), fallbackClassification(t)
+		}
+		decision.Test = t.branchTest(child)
+		path = append(path, decision)
+		t = child
+	}
+	return path, t.Classification
+}
+
+// branchTest describes the test which leads from a node
+// to one of its children.
+func (t *Tree) branchTest(child *Tree) string {
+	attr := fmt.Sprintf("%v", t.Attr)
+	if t.NumSplit != nil {
+		tests := t.NumSplit.branchTests(attr)
+		for i, c := range t.NumSplit.branches() {
+			if c == child {
+				return tests[i]
+			}
+		}
+		panic("not a child of the node")
+	}
+	for val, c := range t.ValSplit {
+		if c == child {
+			return attr + " == " + valueString(val)
+		}
+	}
+	panic("not a child of the node")
+}
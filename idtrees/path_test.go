@@ -0,0 +1,79 @@
+package idtrees
+
+import "testing"
+
+func TestClassifyPath(t *testing.T) {
+	samples := []Sample{
+		treeTestSample{"age": int64(3), "color": "red", "class": "child"},
+		treeTestSample{"age": int64(5), "color": "blue", "class": "child"},
+		treeTestSample{"age": int64(30), "color": "red", "class": "adult"},
+		treeTestSample{"age": int64(32), "color": "blue", "class": "senior"},
+		treeTestSample{"age": int64(40), "color": "blue", "class": "senior"},
+	}
+	tree := ID3(samples, []Attr{"age", "color"}, 1)
+
+	for _, s := range samples {
+		path, dist := tree.ClassifyPath(s)
+		node := tree
+		for i, decision := range path {
+			if decision.Missing {
+				t.Fatalf("unexpected missing decision: %+v", decision)
+			}
+			if decision.Attr != node.Attr || decision.Value != s.Attr(node.Attr) {
+				t.Fatalf("decision %d has bad attribute: %+v", i, decision)
+			}
+			node = node.child(decision.Value)
+		}
+		if !node.leaf() {
+			t.Fatalf("path for %v ended at a non-leaf", s)
+		}
+		if !classificationsEqual(dist, node.Classification) ||
+			!classificationsEqual(dist, tree.Classify(s)) {
+			t.Errorf("bad distribution for %v: %v", s, dist)
+		}
+	}
+
+	path, _ := tree.ClassifyPath(treeTestSample{"age": int64(31), "color": "red"})
+	if len(path) == 0 {
+		t.Fatal("empty path")
+	}
+	if path[0].Test != "age > 17" {
+		t.Errorf("unexpected first test: %s", path[0].Test)
+	}
+
+	colorTree := &Tree{
+		Attr: "color",
+		ValSplit: ValSplit{
+			"red":  &Tree{Classification: map[Class]float64{"adult": 1}, Weight: 1},
+			"blue": &Tree{Classification: map[Class]float64{"child": 1}, Weight: 3},
+		},
+	}
+	path, dist := colorTree.ClassifyPath(treeTestSample{"color": "green"})
+	if len(path) != 1 || !path[0].Missing || path[0].Test != "color == green" {
+		t.Errorf("unexpected path: %+v", path)
+	}
+	if dist["adult"] != 0.25 || dist["child"] != 0.75 {
+		t.Errorf("unexpected distribution: %v", dist)
+	}
+	path, _ = colorTree.ClassifyPath(treeTestSample{"color": "blue"})
+	if len(path) != 1 || path[0].Missing || path[0].Test != "color == blue" {
+		t.Errorf("unexpected path: %+v", path)
+	}
+
+	path, _ = tree.ClassifyPath(treeTestSample{"color": "red"})
+	if len(path) != 1 || !path[0].Missing || path[0].Test != "age is missing" {
+		t.Errorf("unexpected path: %+v", path)
+	}
+}
+
+func classificationsEqual(c1, c2 map[Class]float64) bool {
+	if len(c1) != len(c2) {
+		return false
+	}
+	for class, prob := range c1 {
+		if c2[class] != prob {
+			return false
+		}
+	}
+	return true
+}
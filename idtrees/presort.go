@@ -0,0 +1,289 @@
+package idtrees
+
+import (
+	"math"
+	"sort"
+)
+
+// nodeSamples stores the samples which reach a node
+// while a tree is being built.
+//
+// To avoid sorting the samples at every node, the
+// samples are sorted by each numerical attribute once,
+// at the root.
+// Partitioning the samples between a node's children
+// preserves their relative order, so each child's sorted
+// lists are found by filtering its parent's.
+type nodeSamples struct {
+	Samples []Sample
+
+	// Sorted maps numerical attributes to the samples
+	// with known values for them, in ascending order.
+	// Attributes which are not in Sorted are sorted at
+	// every node, as needed.
+	Sorted map[Attr][]Sample
+
+	// Depth is the depth of the node, which is 0 for the
+	// root.
+	Depth int
+
+	// Lower and Upper bound the targets of regression
+	// leaves under the node, as required by
+	// MonotoneConstraints.
+	Lower float64
+	Upper float64
+
+	// RandomCuts maps attributes to the random numbers
+	// which pick the thresholds of numerical attributes
+	// for ExtraTrees.
+	// It is filled in by bestSplit.
+	RandomCuts map[Attr]float64
+
+	// Counter counts all of the samples, so that the
+	// counts need not be recomputed for every attribute.
+	// It is filled in by bestSplit.
+	Counter splitCounter
+}
+
+// sorted returns the known samples for a numerical
+// attribute in ascending order.
+func (n *nodeSamples) sorted(known []Sample, attr Attr) []Sample {
+	if sorted, ok := n.Sorted[attr]; ok {
+		return sorted
+	}
+	return sortNumeric(known, attr)
+}
+
+// An indexedSample records the index of a training
+// sample, so that it can be found in presorted lists
+// even if it has been wrapped in a scaledSample.
+//
+// It also records the index of the sample's class, so
+// that class weights can be counted in a slice rather
+// than a map.
+type indexedSample struct {
+	Sample
+	index      int
+	classIndex int
+}
+
+func (i *indexedSample) Weight() float64 {
+	return sampleWeight(i.Sample)
+}
+
+// sampleIndex finds the index of an indexedSample,
+// possibly wrapped in scaledSamples.
+func sampleIndex(s Sample) int {
+	return unwrapIndexed(s).index
+}
+
+func unwrapIndexed(s Sample) *indexedSample {
+	for {
+		switch x := s.(type) {
+		case *indexedSample:
+			return x
+		case *scaledSample:
+			s = x.Sample
+		default:
+			panic("sample has no index")
+		}
+	}
+}
+
+// presort creates the nodeSamples for the root of a
+// tree, sorting the samples by every numerical attribute.
+// When NumBins is used, the numerical attributes are
+// binned instead.
+func (b *id3Builder) presort(samples []Sample, attrs []Attr) *nodeSamples {
+	res := &nodeSamples{
+		Samples: make([]Sample, len(samples)),
+		Sorted:  map[Attr][]Sample{},
+		Lower:   math.Inf(-1),
+		Upper:   math.Inf(1),
+	}
+	classIndices := b.classIndices(samples)
+	for i, s := range samples {
+		res.Samples[i] = &indexedSample{Sample: s, index: i}
+		if classIndices != nil {
+			res.Samples[i].(*indexedSample).classIndex = classIndices[s.Class()]
+		}
+	}
+	b.scratch = make([]Sample, len(samples))
+	b.bins = nil
+	if b.useBins() {
+		b.bins = map[Attr]*attrBins{}
+	}
+	for _, attr := range b.presentAttrs(res.Samples, attrs) {
+		if b.cancelled() {
+			// Unsorted attributes are sorted at each node.
+			break
+		}
+		if _, ok := b.OrderedAttrs[attr]; ok || b.categorical(attr) {
+			continue
+		}
+		known, _ := splitMissing(res.Samples, attr)
+		if len(known) == 0 {
+			continue
+		}
+		switch known[0].Attr(attr).(type) {
+		case int64, int, int8, int16, int32, uint, uint8, uint16, uint32, uint64,
+			float64, float32:
+			sorted := sortNumeric(known, attr)
+			if b.bins != nil {
+				b.bins[attr] = b.binAttr(sorted, attr, len(samples))
+			} else {
+				res.Sorted[attr] = sorted
+			}
+		}
+	}
+	return res
+}
+
+// classIndices assigns a dense index to every class of
+// the samples, setting b.numClasses.
+// Indices follow the classes' string representations,
+// so that impurities are summed in the same order as
+// with an entropyCounter.
+//
+// It returns nil for regression and multi-output trees.
+func (b *id3Builder) classIndices(samples []Sample) map[Class]int {
+	if b.Regression || b.numOutputs > 0 || len(samples) == 0 {
+		return nil
+	}
+	seen := map[Class]bool{}
+	var classes []Val
+	for _, s := range samples {
+		if !seen[s.Class()] {
+			seen[s.Class()] = true
+			classes = append(classes, s.Class())
+		}
+	}
+	sortVals(classes)
+	res := make(map[Class]int, len(classes))
+	for i, class := range classes {
+		res[class] = i
+	}
+	b.numClasses = len(classes)
+	return res
+}
+
+// partition creates the nodeSamples for a child of a
+// node, given the samples which reach the child.
+//
+// The child's samples must come from the node, although
+// they may have been wrapped in scaledSamples.
+func (b *id3Builder) partition(node *nodeSamples, samples []Sample) *nodeSamples {
+	res := &nodeSamples{
+		Samples: samples,
+		Depth:   node.Depth + 1,
+		Lower:   node.Lower,
+		Upper:   node.Upper,
+	}
+	if len(node.Sorted) == 0 {
+		return res
+	}
+
+	for _, s := range samples {
+		b.scratch[sampleIndex(s)] = s
+	}
+	res.Sorted = make(map[Attr][]Sample, len(node.Sorted))
+	for attr, sorted := range node.Sorted {
+		childSorted := make([]Sample, 0, len(samples))
+		for _, s := range sorted {
+			if child := b.scratch[sampleIndex(s)]; child != nil {
+				childSorted = append(childSorted, child)
+			}
+		}
+		res.Sorted[attr] = childSorted
+	}
+	for _, s := range samples {
+		b.scratch[sampleIndex(s)] = nil
+	}
+	return res
+}
+
+// sortNumeric returns a copy of the samples sorted by a
+// numerical attribute, all of whose values must be
+// known.
+func sortNumeric(samples []Sample, attr Attr) []Sample {
+	res := copySampleSlice(samples)
+	s := sampleSorter{Attr: attr, Samples: res}
+	switch samples[0].Attr(attr).(type) {
+	case int64, int, int8, int16, int32, uint, uint8, uint16, uint32, uint64:
+		sort.Sort(&intSorter{sampleSorter: s})
+	default:
+		sort.Sort(&floatSorter{sampleSorter: s})
+	}
+	return res
+}
+
+// An indexedCounter is like an entropyCounter, but it
+// counts the classes of indexedSamples in a slice.
+type indexedCounter struct {
+	classWeights []float64
+	totalWeight  float64
+	weightLogSum float64
+	numPositive  int
+}
+
+func newIndexedCounter(s []Sample, numClasses int) *indexedCounter {
+	res := &indexedCounter{classWeights: make([]float64, numClasses)}
+	for _, sample := range s {
+		res.Add(sample)
+	}
+	return res
+}
+
+func (i *indexedCounter) Entropy() float64 {
+	return incrementalEntropy(i.totalWeight, i.weightLogSum, i.numPositive)
+}
+
+func (i *indexedCounter) exactEntropy() float64 {
+	var entropy float64
+	weightScaler := 1 / i.totalWeight
+	for _, weight := range i.classWeights {
+		if weight <= 0 {
+			continue
+		}
+		probability := weight * weightScaler
+		entropy -= probability * math.Log(probability)
+	}
+	return entropy
+}
+
+func (i *indexedCounter) Gini() float64 {
+	impurity := 1.0
+	weightScaler := 1 / i.totalWeight
+	for _, weight := range i.classWeights {
+		probability := weight * weightScaler
+		impurity -= probability * probability
+	}
+	return impurity
+}
+
+func (i *indexedCounter) TotalWeight() float64 {
+	return i.totalWeight
+}
+
+func (i *indexedCounter) clone() splitCounter {
+	res := *i
+	res.classWeights = append([]float64{}, i.classWeights...)
+	return &res
+}
+
+func (i *indexedCounter) Add(s Sample) {
+	i.updateWeight(unwrapIndexed(s).classIndex, sampleWeight(s))
+}
+
+func (i *indexedCounter) Remove(s Sample) {
+	i.updateWeight(unwrapIndexed(s).classIndex, -sampleWeight(s))
+}
+
+func (i *indexedCounter) updateWeight(class int, delta float64) {
+	old := i.classWeights[class]
+	updated := updatedWeight(old, delta)
+	i.classWeights[class] = updated
+	i.weightLogSum += xlogx(updated) - xlogx(old)
+	i.numPositive += positiveDelta(old, updated)
+	i.totalWeight += delta
+}
@@ -0,0 +1,143 @@
+package idtrees
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestPresortedID3(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(500, 4)
+	for _, s := range samples {
+		s.(treeTestSample)["color"] = []string{"red", "green", "blue"}[rand.Intn(3)]
+	}
+	attrs := []Attr{0, 1, 2, 3, "color"}
+
+	for _, builder := range []Builder{{}, {Criterion: Gini}, {MaxLeafNodes: 20}} {
+		expected := builder.Build(samples, attrs)
+
+		// Without presorted lists, every node sorts the
+		// samples itself.
+		unsorted := &id3Builder{Builder: builder, entropyScale: 1}
+		unsorted.MaxGos = 1
+		root := &nodeSamples{Samples: samples}
+		impurity := unsorted.impurity(unsorted.newCounter(samples))
+		var actual *Tree
+		if builder.MaxLeafNodes > 0 {
+			actual = unsorted.bestFirst(root, attrs, -1, impurity)
+		} else {
+			actual = unsorted.id3(root, attrs, -1, impurity)
+		}
+
+		if !treesEqual(actual, expected) {
+			t.Errorf("builder %+v: presorted tree differs", builder)
+		}
+	}
+}
+
+func TestNumericSplitTotals(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(500, 4)
+	for _, builder := range []Builder{{}, {Criterion: Gini}, {MaxThresholds: 10}} {
+		b := builder.newID3Builder(nil)
+		root := b.presort(samples, []Attr{0, 1, 2, 3})
+		total := b.newCounter(root.Samples)
+		totalWeight := total.TotalWeight()
+		for attr, sorted := range root.Sorted {
+			var expected, actual *potentialSplit
+			if attr.(int)%2 == 0 {
+				expected = b.createFloatSplit(sorted, attr, nil)
+				actual = b.createFloatSplit(sorted, attr, total)
+			} else {
+				expected = b.createIntSplit(sorted, attr, nil)
+				actual = b.createIntSplit(sorted, attr, total)
+			}
+			if actual.Threshold != expected.Threshold {
+				t.Errorf("attr %v: expected threshold %v but got %v", attr,
+					expected.Threshold, actual.Threshold)
+			}
+			if math.Abs(actual.Entropy-expected.Entropy) > 1e-12 {
+				t.Errorf("attr %v: expected entropy %f but got %f", attr,
+					expected.Entropy, actual.Entropy)
+			}
+			for i, e := range expected.NumSplitEntropies {
+				if math.Abs(actual.NumSplitEntropies[i]-e) > 1e-12 {
+					t.Errorf("attr %v: branch %d: expected entropy %f but got %f", attr,
+						i, e, actual.NumSplitEntropies[i])
+				}
+			}
+		}
+		if total.TotalWeight() != totalWeight {
+			t.Error("total counter was modified")
+		}
+	}
+}
+
+func BenchmarkID3Numeric(b *testing.B) {
+	benchmarkNumeric(b, &Builder{})
+}
+
+func BenchmarkID3MaxThresholds(b *testing.B) {
+	benchmarkNumeric(b, &Builder{MaxThresholds: 32})
+}
+
+func benchmarkNumeric(b *testing.B, builder *Builder) {
+	rand.Seed(1337)
+	samples := make([]Sample, 5000)
+	var attrs []Attr
+	for i := 0; i < 40; i++ {
+		attrs = append(attrs, i)
+	}
+	for i := range samples {
+		s := &vectorSample{vals: make([]float64, len(attrs))}
+		var sum float64
+		for j := range s.vals {
+			s.vals[j] = rand.Float64()
+			sum += s.vals[j]
+		}
+		s.class = int(sum / 5)
+		samples[i] = s
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		builder.Build(samples, attrs)
+	}
+}
+
+type vectorSample struct {
+	vals  []float64
+	class int
+}
+
+func (v *vectorSample) Attr(attr Attr) Val {
+	return v.vals[attr.(int)]
+}
+
+func (v *vectorSample) Class() Class {
+	return v.class
+}
+
+func presortTestSamples(n, numAttrs int) []Sample {
+	res := make([]Sample, n)
+	for i := range res {
+		s := treeTestSample{}
+		var sum float64
+		for j := 0; j < numAttrs; j++ {
+			if j%2 == 0 {
+				x := rand.Float64()
+				s[j] = x
+				sum += x
+			} else {
+				x := int64(rand.Intn(100))
+				s[j] = x
+				sum += float64(x) / 100
+			}
+		}
+		s["class"] = fmt.Sprint(int(sum * 4 / float64(numAttrs)))
+		res[i] = s
+	}
+	return res
+}
@@ -0,0 +1,366 @@
+package idtrees
+
+import (
+	"fmt"
+	"math"
+)
+
+// Prune performs reduced-error pruning on a tree using
+// a set of validation samples.
+//
+// Working from the bottom of the tree up, each subtree
+// is replaced with a leaf if doing so does not increase
+// the number of misclassified validation samples.
+// The leaf which replaces a subtree combines the
+// classifications of the subtree's leaves, just like
+// Tree.Classify does for unseen values.
+//
+// The original tree is not modified, although the
+// result may share subtrees with it.
+func Prune(t *Tree, validation []Sample) *Tree {
+	res, _ := pruneReducedError(t, validation)
+	return res
+}
+
+// pruneReducedError prunes t and returns the result,
+// along with the number of samples it misclassifies.
+func pruneReducedError(t *Tree, samples []Sample) (*Tree, int) {
+	if t.Classification != nil {
+		return t, classificationErrors(t.Classification, samples)
+	}
+
+	merged := mergedClassification(t)
+	res := &Tree{Attr: t.Attr, Gain: t.Gain, Weight: t.Weight,
+		SampleCount: t.SampleCount, Surrogates: t.Surrogates,
+		MissingValue: t.MissingValue, Fallback: t.Fallback}
+	var errors int
+
+	// Samples are routed like Tree.Classify routes them,
+	// so samples with missing values use the surrogates.
+	branchSamples := map[*Tree][]Sample{}
+	var unknown []Sample
+	for _, s := range samples {
+		if child := t.route(s); child != nil {
+			branchSamples[child] = append(branchSamples[child], s)
+		} else {
+			unknown = append(unknown, s)
+		}
+	}
+	if t.NumSplit != nil {
+		var subtrees []*Tree
+		for _, child := range t.NumSplit.branches() {
+			subtree, subErrors := pruneReducedError(child, branchSamples[child])
+			subtrees = append(subtrees, subtree)
+			errors += subErrors
+		}
+		res.NumSplit = t.NumSplit.withBranches(subtrees)
+	} else {
+		res.ValSplit = ValSplit{}
+		for val, child := range t.ValSplit {
+			subtree, subErrors := pruneReducedError(child, branchSamples[child])
+			res.ValSplit[val] = subtree
+			errors += subErrors
+		}
+	}
+
+	// Samples which no branch or surrogate can route are
+	// classified using the fallback of the node, as in
+	// Tree.Classify.
+	errors += classificationErrors(fallbackClassification(t), unknown)
+
+	leafErrors := classificationErrors(merged, samples)
+	if leafErrors <= errors {
+		return &Tree{Classification: merged, Weight: t.Weight,
+			SampleCount: t.SampleCount, SampleIndices: mergedSampleIndices(t)}, leafErrors
+	}
+	return res, errors
+}
+
+// CostComplexityPrune performs CART-style minimal
+// cost-complexity pruning on a tree using its training
+// samples.
+//
+// Subtrees are repeatedly collapsed into leaves, starting
+// with the weakest link (the subtree which reduces the
+// misclassification rate the least per extra leaf),
+// until every remaining subtree has an effective alpha
+// of at least alpha.
+// The leaf which replaces a subtree classifies the
+// samples which reached that subtree.
+//
+// If alpha is 0, t is returned unchanged.
+// Otherwise, the original tree is not modified.
+func CostComplexityPrune(t *Tree, samples []Sample, alpha float64) *Tree {
+	if alpha <= 0 || len(samples) == 0 {
+		return t
+	}
+	res := copyTree(t)
+	nodeSamples := map[*Tree][]Sample{}
+	routeSamples(res, samples, nodeSamples)
+	for {
+		p := &costComplexityPruner{
+			NodeSamples: nodeSamples,
+			Scaler:      1 / float64(len(samples)),
+		}
+		p.Evaluate(res)
+		if p.Weakest == nil || p.WeakestAlpha >= alpha {
+			break
+		}
+		*p.Weakest = Tree{
+			Classification: p.leafClassification(p.Weakest),
+			Weight:         p.Weakest.Weight,
+			SampleCount:    p.Weakest.SampleCount,
+			SampleIndices:  mergedSampleIndices(p.Weakest),
+		}
+	}
+	return res
+}
+
+// PessimisticPrune performs C4.5's error-based pruning on
+// a tree using its training samples, so that no
+// validation set is needed.
+//
+// The number of errors that each leaf would make on
+// unseen samples is estimated with the upper limit of a
+// binomial confidence interval for its error rate on the
+// training samples, with a continuity correction.
+// Working from the bottom of the tree up, a subtree is
+// replaced with a leaf if the leaf's estimated errors are
+// not greater than the sum of the estimates for the
+// subtree's leaves (plus 0.1, as in C4.5).
+// As with CostComplexityPrune, the new leaf classifies
+// the samples which reached the subtree.
+//
+// The confidence is C4.5's CF, which should be in
+// (0, 0.5], and is 0.25 by default in C4.5.
+// Smaller confidences give more pessimistic estimates
+// and prune more.
+// If confidence is 0, t is returned unchanged.
+//
+// The original tree is not modified, although the
+// result may share subtrees with it.
+func PessimisticPrune(t *Tree, samples []Sample, confidence float64) *Tree {
+	if confidence <= 0 || len(samples) == 0 {
+		return t
+	}
+	nodeSamples := map[*Tree][]Sample{}
+	routeSamples(t, samples, nodeSamples)
+	p := &pessimisticPruner{NodeSamples: nodeSamples, Confidence: confidence}
+	res, _ := p.Prune(t)
+	return res
+}
+
+type pessimisticPruner struct {
+	NodeSamples map[*Tree][]Sample
+	Confidence  float64
+}
+
+// Prune prunes t and returns the result, along with its
+// estimated number of errors.
+func (p *pessimisticPruner) Prune(t *Tree) (*Tree, float64) {
+	samples := p.NodeSamples[t]
+	if t.Classification != nil {
+		return t, p.estimatedErrors(t.Classification, samples)
+	}
+
+	res := &Tree{Attr: t.Attr, Gain: t.Gain, Weight: t.Weight,
+		SampleCount: t.SampleCount, Surrogates: t.Surrogates,
+		MissingValue: t.MissingValue, Fallback: t.Fallback}
+	var errors float64
+	if t.NumSplit != nil {
+		var subtrees []*Tree
+		for _, child := range t.NumSplit.branches() {
+			subtree, subErrors := p.Prune(child)
+			subtrees = append(subtrees, subtree)
+			errors += subErrors
+		}
+		res.NumSplit = t.NumSplit.withBranches(subtrees)
+	} else {
+		res.ValSplit = ValSplit{}
+		for val, child := range t.ValSplit {
+			subtree, subErrors := p.Prune(child)
+			res.ValSplit[val] = subtree
+			errors += subErrors
+		}
+	}
+
+	// Samples which no branch or surrogate can route are
+	// classified using the fallback of the node, which
+	// acts like another leaf.
+	var unknown []Sample
+	for _, s := range samples {
+		if t.route(s) == nil {
+			unknown = append(unknown, s)
+		}
+	}
+	if len(unknown) > 0 {
+		errors += p.estimatedErrors(fallbackClassification(t), unknown)
+	}
+
+	leaf := samplesClassification(t, samples)
+	leafErrors := p.estimatedErrors(leaf, samples)
+	if leafErrors <= errors+0.1 {
+		return &Tree{Classification: leaf, Weight: t.Weight,
+			SampleCount: t.SampleCount, SampleIndices: mergedSampleIndices(t)}, leafErrors
+	}
+	return res, errors
+}
+
+// estimatedErrors estimates the number of errors that a
+// leaf with the given classification makes, given the
+// samples which reach it.
+func (p *pessimisticPruner) estimatedErrors(c map[Class]float64, samples []Sample) float64 {
+	n := float64(len(samples))
+	e := float64(classificationErrors(c, samples))
+	return e + pessimisticExtraErrors(n, e, p.Confidence)
+}
+
+// pessimisticExtraErrors computes the number of errors
+// which C4.5 adds to the e errors observed in n samples,
+// so that the total is n times the upper limit of the
+// confidence interval for the error rate.
+//
+// This follows the addErrs function of C4.5.
+func pessimisticExtraErrors(n, e, confidence float64) float64 {
+	if n == 0 {
+		return 0
+	}
+	if e < 1 {
+		// The upper limit for no errors is found exactly,
+		// and interpolated for fractional errors.
+		base := n * (1 - math.Pow(confidence, 1/n))
+		if e == 0 {
+			return base
+		}
+		return base + e*(pessimisticExtraErrors(n, 1, confidence)-base)
+	}
+	if e+0.5 >= n {
+		return math.Max(0.67*(n-e), 0)
+	}
+	z := math.Sqrt2 * math.Erfinv(1-2*confidence)
+	f := (e + 0.5) / n
+	r := (f + z*z/(2*n) + z*math.Sqrt(f/n-f*f/n+z*z/(4*n*n))) / (1 + z*z/n)
+	return r*n - e
+}
+
+type costComplexityPruner struct {
+	NodeSamples map[*Tree][]Sample
+	Scaler      float64
+
+	Weakest      *Tree
+	WeakestAlpha float64
+}
+
+// Evaluate computes the misclassification rate and the
+// number of leaves for a subtree, updating the weakest
+// link along the way.
+func (c *costComplexityPruner) Evaluate(t *Tree) (float64, int) {
+	samples := c.NodeSamples[t]
+	if t.Classification != nil {
+		return float64(classificationErrors(t.Classification, samples)) * c.Scaler, 1
+	}
+
+	children := t.children()
+
+	var subtreeError float64
+	var leaves int
+	for _, child := range children {
+		e, l := c.Evaluate(child)
+		subtreeError += e
+		leaves += l
+	}
+
+	var unknown []Sample
+	for _, s := range samples {
+		if t.route(s) == nil {
+			unknown = append(unknown, s)
+		}
+	}
+	unknownErrors := classificationErrors(fallbackClassification(t), unknown)
+	subtreeError += float64(unknownErrors) * c.Scaler
+
+	leafError := float64(classificationErrors(c.leafClassification(t), samples)) * c.Scaler
+	alpha := (leafError - subtreeError) / float64(leaves-1)
+	if c.Weakest == nil || alpha < c.WeakestAlpha {
+		c.Weakest = t
+		c.WeakestAlpha = alpha
+	}
+
+	return subtreeError, leaves
+}
+
+func (c *costComplexityPruner) leafClassification(t *Tree) map[Class]float64 {
+	return samplesClassification(t, c.NodeSamples[t])
+}
+
+// samplesClassification computes the classification of
+// a leaf which replaces a subtree, given the samples
+// which reach the subtree.
+// If there are no samples, the classifications of the
+// subtree's leaves are combined instead.
+func samplesClassification(t *Tree, samples []Sample) map[Class]float64 {
+	if len(samples) > 0 {
+		return createLeaf(samples).Classification
+	}
+	return mergedClassification(t)
+}
+
+// routeSamples records the samples which reach each
+// node of a tree, routing them like Tree.Classify.
+// Samples which no branch or surrogate can route stop at
+// the node where they are stuck.
+func routeSamples(t *Tree, samples []Sample, nodeSamples map[*Tree][]Sample) {
+	nodeSamples[t] = samples
+	if t.Classification != nil {
+		return
+	}
+	branchSamples := map[*Tree][]Sample{}
+	for _, s := range samples {
+		if child := t.route(s); child != nil {
+			branchSamples[child] = append(branchSamples[child], s)
+		}
+	}
+	for _, child := range t.children() {
+		routeSamples(child, branchSamples[child], nodeSamples)
+	}
+}
+
+// classificationErrors counts the samples whose class
+// is not the most likely class in a classification.
+func classificationErrors(c map[Class]float64, samples []Sample) int {
+	if len(samples) == 0 {
+		return 0
+	}
+	top, ok := topClass(c)
+	var errors int
+	for _, s := range samples {
+		if !ok || s.Class() != top {
+			errors++
+		}
+	}
+	return errors
+}
+
+// topClass returns the most likely class in c.
+// Ties are broken by comparing the string
+// representations of the classes, so that the result
+// is deterministic.
+//
+// The second return value is false if c is empty.
+func topClass(c map[Class]float64) (Class, bool) {
+	var best Class
+	var bestProb float64
+	var bestStr string
+	var found bool
+	for class, prob := range c {
+		if !found || prob > bestProb {
+			best, bestProb, found = class, prob, true
+			bestStr = fmt.Sprintf("%v", class)
+		} else if prob == bestProb {
+			if str := fmt.Sprintf("%v", class); str < bestStr {
+				best, bestStr = class, str
+			}
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,238 @@
+package idtrees
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	rand.Seed(1337)
+	noisySamples := func(n int) []Sample {
+		var res []Sample
+		for i := 0; i < n; i++ {
+			x := rand.Float64()
+			class := x > 0.5
+			if rand.Intn(5) == 0 {
+				class = !class
+			}
+			res = append(res, treeTestSample{"x": x, "class": class})
+		}
+		return res
+	}
+	training := noisySamples(300)
+	validation := noisySamples(300)
+
+	tree := ID3(training, []Attr{"x"}, 1)
+	pruned := Prune(tree, validation)
+
+	oldErrors := treeErrors(tree, validation)
+	newErrors := treeErrors(pruned, validation)
+	if newErrors > oldErrors {
+		t.Errorf("errors went from %d to %d", oldErrors, newErrors)
+	}
+	if pruned.NumNodes() >= tree.NumNodes() {
+		t.Errorf("node count went from %d to %d", tree.NumNodes(), pruned.NumNodes())
+	}
+	if treeErrors(tree, validation) != oldErrors {
+		t.Error("original tree was modified")
+	}
+}
+
+func TestPruneUnknownValue(t *testing.T) {
+	tree := &Tree{
+		Attr: "color",
+		ValSplit: ValSplit{
+			"red":  &Tree{Classification: map[Class]float64{"a": 1}},
+			"blue": &Tree{Classification: map[Class]float64{"b": 1}},
+		},
+	}
+	validation := []Sample{
+		treeTestSample{"color": "red", "class": "a"},
+		treeTestSample{"color": "blue", "class": "b"},
+		treeTestSample{"color": "green", "class": "a"},
+	}
+	pruned := Prune(tree, validation)
+	if pruned.ValSplit == nil {
+		t.Errorf("tree should not have been pruned:\n%s", pruned)
+	}
+}
+
+func TestPruneMissingNumeric(t *testing.T) {
+	tree := &Tree{
+		Attr: "x",
+		NumSplit: &NumSplit{
+			Threshold: 0.5,
+			LessEqual: &Tree{Classification: map[Class]float64{"a": 1}, Weight: 5},
+			Greater:   &Tree{Classification: map[Class]float64{"b": 1}, Weight: 10},
+		},
+		Weight: 15,
+	}
+	var samples []Sample
+	for i := 0; i < 5; i++ {
+		samples = append(samples, treeTestSample{"x": 0.2, "y": 0.2, "class": "a"})
+	}
+	for i := 0; i < 10; i++ {
+		samples = append(samples, treeTestSample{"y": 0.9, "class": "b"})
+	}
+
+	// Without surrogates, the samples which are missing x
+	// are classified with the merged distribution of the
+	// root, which predicts b.
+	if errs := treeErrors(tree, samples); errs != 0 {
+		t.Fatalf("expected no errors but got %d", errs)
+	}
+	if pruned := Prune(tree, samples); pruned.NumSplit == nil {
+		t.Errorf("tree should not have been pruned:\n%s", pruned)
+	}
+
+	// With a surrogate, the samples take the Greater
+	// branch, even though the merged distribution now
+	// predicts a.
+	tree.Surrogates = []Surrogate{{Attr: "y", Threshold: 0.5, LessEqual: false,
+		Greater: true}}
+	tree.NumSplit.Greater.Weight = 1
+	tree.NumSplit.LessEqual.Weight = 10
+	if errs := treeErrors(tree, samples); errs != 0 {
+		t.Fatalf("expected no errors but got %d", errs)
+	}
+	for name, pruned := range map[string]*Tree{
+		"reduced-error":   Prune(tree, samples),
+		"cost-complexity": CostComplexityPrune(tree, samples, 0.1),
+		"pessimistic":     PessimisticPrune(tree, samples, 0.25),
+	} {
+		if pruned.NumSplit == nil {
+			t.Errorf("%s: tree should not have been pruned:\n%s", name, pruned)
+		}
+	}
+
+	nodeSamples := map[*Tree][]Sample{}
+	routeSamples(tree, samples, nodeSamples)
+	if n := len(nodeSamples[tree.NumSplit.Greater]); n != 10 {
+		t.Errorf("expected 10 samples in the Greater branch but got %d", n)
+	}
+}
+
+func treeErrors(t *Tree, samples []Sample) int {
+	var errors int
+	for _, s := range samples {
+		if class, ok := topClass(t.Classify(s)); !ok || class != s.Class() {
+			errors++
+		}
+	}
+	return errors
+}
+
+func TestCostComplexityPrune(t *testing.T) {
+	rand.Seed(1338)
+	var samples []Sample
+	for i := 0; i < 300; i++ {
+		x := rand.Float64()
+		class := x > 0.5
+		if rand.Intn(5) == 0 {
+			class = !class
+		}
+		samples = append(samples, treeTestSample{"x": x, "class": class})
+	}
+	tree := ID3(samples, []Attr{"x"}, 1)
+
+	if !treesEqual(CostComplexityPrune(tree, samples, 0), tree) {
+		t.Error("alpha=0 should not change the tree")
+	}
+
+	lastCount := tree.NumNodes()
+	for _, alpha := range []float64{0.001, 0.01, 0.1} {
+		pruned := CostComplexityPrune(tree, samples, alpha)
+		count := pruned.NumNodes()
+		if count > lastCount {
+			t.Errorf("alpha %f: node count grew from %d to %d", alpha, lastCount, count)
+		}
+		lastCount = count
+	}
+	if lastCount != 3 {
+		t.Errorf("expected a single split for large alpha, but got %d nodes", lastCount)
+	}
+	if CostComplexityPrune(tree, samples, 1).NumNodes() != 1 {
+		t.Error("expected a leaf for huge alpha")
+	}
+}
+
+func TestPessimisticPrune(t *testing.T) {
+	rand.Seed(1338)
+	noisySamples := func(n int) []Sample {
+		var samples []Sample
+		for i := 0; i < n; i++ {
+			x := rand.Float64()
+			class := x > 0.5
+			if rand.Intn(5) == 0 {
+				class = !class
+			}
+			samples = append(samples, treeTestSample{"x": x, "class": class})
+		}
+		return samples
+	}
+	samples := noisySamples(300)
+	tree := ID3(samples, []Attr{"x"}, 1)
+
+	if !treesEqual(PessimisticPrune(tree, samples, 0), tree) {
+		t.Error("confidence 0 should not change the tree")
+	}
+
+	pruned := PessimisticPrune(tree, samples, 0.25)
+	if pruned.NumLeaves()*4 > tree.NumLeaves() {
+		t.Errorf("expected far fewer than %d leaves but got %d", tree.NumLeaves(),
+			pruned.NumLeaves())
+	}
+	if pruned.leaf() {
+		t.Error("expected the x > 0.5 split to survive")
+	}
+	if PessimisticPrune(tree, samples, 0.01).NumLeaves() > pruned.NumLeaves() {
+		t.Error("a lower confidence should prune at least as much")
+	}
+
+	test := noisySamples(1000)
+	if treeErrors(pruned, test) > treeErrors(tree, test) {
+		t.Errorf("pruning increased test errors from %d to %d", treeErrors(tree, test),
+			treeErrors(pruned, test))
+	}
+}
+
+func TestPessimisticExtraErrors(t *testing.T) {
+	// Values from Quinlan's C4.5 book, where U(0, 6) is
+	// 0.206 and U(1, 16) is 0.157 at the default CF.
+	// The book uses exact binomial limits, while C4.5
+	// approximates them for nonzero errors.
+	cases := []struct {
+		n, e     float64
+		expected float64
+	}{
+		{6, 0, 6 * 0.206},
+		{16, 1, 16*0.157 - 1},
+		{1, 0, 0.75},
+		{4, 4, 0},
+	}
+	for _, c := range cases {
+		actual := pessimisticExtraErrors(c.n, c.e, 0.25)
+		if math.Abs(actual-c.expected) > 0.05 {
+			t.Errorf("n=%f e=%f: expected %f but got %f", c.n, c.e, c.expected, actual)
+		}
+	}
+
+	// Values of C4.5's addErrs, in the cases which do not
+	// depend on its normal deviation table.
+	exactCases := []struct {
+		n, e     float64
+		expected float64
+	}{
+		{6, 0, 6 * (1 - math.Pow(0.25, 1.0/6))},
+		{6, 5.5, 0.67 * 0.5},
+		{4, 3.6, 0.67 * 0.4},
+		{6, 6, 0},
+	}
+	for _, c := range exactCases {
+		actual := pessimisticExtraErrors(c.n, c.e, 0.25)
+		if math.Abs(actual-c.expected) > 1e-6 {
+			t.Errorf("n=%f e=%f: expected %f but got %f", c.n, c.e, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package idtrees
+
+// RegressionTree generates a regression tree, where each
+// sample's Class is a float64 target.
+//
+// The maxGos argument works just like it does for ID3.
+//
+// Regression trees can be used with Tree.Predict.
+func RegressionTree(samples []Sample, attrs []Attr, maxGos int) *Tree {
+	b := &Builder{MaxGos: maxGos, Regression: true}
+	return b.Build(samples, attrs)
+}
+
+// Predict follows a regression tree for the given sample
+// and returns the resulting leaf's target.
+//
+// If the sample has a missing (nil) value for a split,
+// the split's surrogates are used to pick a branch.
+// If no surrogate can route the sample, or if it has a
+// value which matches no branch of a ValSplit (and the
+// split has no OtherValue branch), the
+// targets of all the branches are averaged, weighted by
+// their training weights.
+func (t *Tree) Predict(s AttrMap) float64 {
+	for !t.leaf() {
+		child := t.route(s)
+		if child == nil {
+			return mergedValue(t)
+		}
+		t = child
+	}
+	return t.Value
+}
+
+// mergedValue averages the targets of the leaves of a
+// regression tree, weighting branches by their training
+// weights.
+func mergedValue(t *Tree) float64 {
+	if t.leaf() {
+		return t.Value
+	}
+	children := t.children()
+
+	var totalWeight float64
+	for _, child := range children {
+		totalWeight += child.Weight
+	}
+
+	var res float64
+	for _, child := range children {
+		scaler := 1 / float64(len(children))
+		if totalWeight > 0 {
+			scaler = child.Weight / totalWeight
+		}
+		res += mergedValue(child) * scaler
+	}
+	return res
+}
+
+func createRegressionLeaf(samples []Sample) *Tree {
+	counter := newVarianceCounter(samples)
+	return &Tree{
+		Value:  counter.mean,
+		Weight: counter.totalWeight,
+	}
+}
+
+// varianceCounter computes the weighted mean and
+// variance of sample targets using Welford's method.
+type varianceCounter struct {
+	totalWeight float64
+	mean        float64
+	sqDiffSum   float64
+}
+
+func newVarianceCounter(s []Sample) *varianceCounter {
+	res := &varianceCounter{}
+	for _, sample := range s {
+		res.Add(sample)
+	}
+	return res
+}
+
+func (v *varianceCounter) Variance() float64 {
+	if v.totalWeight <= 0 || v.sqDiffSum <= 0 {
+		return 0
+	}
+	return v.sqDiffSum / v.totalWeight
+}
+
+func (v *varianceCounter) TotalWeight() float64 {
+	return v.totalWeight
+}
+
+func (v *varianceCounter) clone() splitCounter {
+	res := *v
+	return &res
+}
+
+func (v *varianceCounter) Add(s Sample) {
+	w := sampleWeight(s)
+	if w == 0 {
+		return
+	}
+	x := s.Class().(float64)
+	v.totalWeight += w
+	delta := x - v.mean
+	v.mean += delta * w / v.totalWeight
+	v.sqDiffSum += w * delta * (x - v.mean)
+}
+
+func (v *varianceCounter) Remove(s Sample) {
+	w := sampleWeight(s)
+	if w == 0 {
+		return
+	}
+	x := s.Class().(float64)
+	newWeight := v.totalWeight - w
+	if newWeight <= 0 {
+		*v = varianceCounter{}
+		return
+	}
+	delta := x - v.mean
+	newMean := v.mean - delta*w/newWeight
+	v.sqDiffSum -= w * delta * (x - newMean)
+	v.mean = newMean
+	v.totalWeight = newWeight
+}
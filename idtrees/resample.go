@@ -0,0 +1,57 @@
+package idtrees
+
+import "math/rand"
+
+// Bootstrap samples len(samples) samples with
+// replacement.
+//
+// If rng is nil, the global source from math/rand is
+// used.
+func Bootstrap(samples []Sample, rng *rand.Rand) []Sample {
+	res := make([]Sample, len(samples))
+	for i := range res {
+		res[i] = samples[randIntn(rng, len(samples))]
+	}
+	return res
+}
+
+// Subsample randomly selects the given fraction of the
+// samples without replacement, rounding the number of
+// samples to the nearest integer.
+// The fraction must be between 0 and 1.
+//
+// If rng is nil, the global source from math/rand is
+// used.
+func Subsample(samples []Sample, fraction float64, rng *rand.Rand) []Sample {
+	if fraction < 0 || fraction > 1 {
+		panic("subsample fraction out of range")
+	}
+	n := int(fraction*float64(len(samples)) + 0.5)
+	res := copySampleSlice(samples)
+	for i := 0; i < n; i++ {
+		idx := randIntn(rng, len(res)-i) + i
+		res[i], res[idx] = res[idx], res[i]
+	}
+	return res[:n]
+}
+
+func randIntn(rng *rand.Rand, n int) int {
+	if rng == nil {
+		return rand.Intn(n)
+	}
+	return rng.Intn(n)
+}
+
+func randPerm(rng *rand.Rand, n int) []int {
+	if rng == nil {
+		return rand.Perm(n)
+	}
+	return rng.Perm(n)
+}
+
+func randFloat64(rng *rand.Rand) float64 {
+	if rng == nil {
+		return rand.Float64()
+	}
+	return rng.Float64()
+}
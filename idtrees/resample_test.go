@@ -0,0 +1,67 @@
+package idtrees
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func resampleTestSamples() []Sample {
+	res := make([]Sample, 50)
+	for i := range res {
+		res[i] = treeTestSample{"id": i, "class": i % 2}
+	}
+	return res
+}
+
+func TestBootstrap(t *testing.T) {
+	samples := resampleTestSamples()
+	res := Bootstrap(samples, rand.New(rand.NewSource(1337)))
+	if len(res) != len(samples) {
+		t.Fatalf("expected %d samples but got %d", len(samples), len(res))
+	}
+	seen := map[Val]bool{}
+	for _, s := range res {
+		seen[s.Attr("id")] = true
+	}
+	if len(seen) == len(samples) {
+		t.Error("bootstrap did not repeat any samples")
+	}
+
+	res1 := Bootstrap(samples, rand.New(rand.NewSource(1337)))
+	for i, s := range res {
+		if s.Attr("id") != res1[i].Attr("id") {
+			t.Fatal("same seed gave different samples")
+		}
+	}
+}
+
+func TestSubsample(t *testing.T) {
+	samples := resampleTestSamples()
+	res := Subsample(samples, 0.3, rand.New(rand.NewSource(1337)))
+	if len(res) != 15 {
+		t.Fatalf("expected 15 samples but got %d", len(res))
+	}
+	seen := map[Val]bool{}
+	for _, s := range res {
+		if seen[s.Attr("id")] {
+			t.Fatalf("sample %v repeated", s.Attr("id"))
+		}
+		seen[s.Attr("id")] = true
+	}
+	for i, s := range samples {
+		if s.Attr("id") != i {
+			t.Fatal("input samples were modified")
+		}
+	}
+
+	res1 := Subsample(samples, 0.3, rand.New(rand.NewSource(1337)))
+	for i, s := range res {
+		if s.Attr("id") != res1[i].Attr("id") {
+			t.Fatal("same seed gave different samples")
+		}
+	}
+
+	if n := len(Subsample(samples, 1, nil)); n != len(samples) {
+		t.Errorf("expected %d samples but got %d", len(samples), n)
+	}
+}
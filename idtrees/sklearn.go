@@ -0,0 +1,290 @@
+package idtrees
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	sklearnLeaf      = -1
+	sklearnUndefined = -2
+)
+
+// A SklearnTree stores a tree in the array layout of
+// scikit-learn's sklearn.tree._tree.Tree, so that it can
+// be encoded as JSON and read by Python tools.
+//
+// Nodes are numbered in depth-first order, starting with
+// the root.
+// A sample goes to ChildrenLeft[i] at node i if its
+// value of Feature[i] is at most Threshold[i], and to
+// ChildrenRight[i] otherwise.
+// For leaves, the children are -1 and the feature and
+// threshold are -2, as in scikit-learn.
+//
+// Since scikit-learn trees are binary, every ValSplit is
+// encoded as a cascade of equality tests, each on an
+// indicator feature which is 1 if an attribute has a
+// certain value and 0 otherwise.
+// Indicator features are numbered after the attributes,
+// and FeatureNames names them like "color=red".
+// The last node of a cascade is the OtherValue branch if
+// the split has one, or otherwise a leaf which combines
+// all of the branches, as Classify does for unseen
+// values.
+type SklearnTree struct {
+	NodeCount     int       `json:"node_count"`
+	ChildrenLeft  []int     `json:"children_left"`
+	ChildrenRight []int     `json:"children_right"`
+	Feature       []int     `json:"feature"`
+	Threshold     []float64 `json:"threshold"`
+
+	// Value has one entry per node, which holds a single
+	// output.
+	// For a classification tree, the output holds the
+	// probabilities of Classes.
+	// For a regression tree, it holds the target.
+	// Internal nodes combine the values of their leaves.
+	Value [][][]float64 `json:"value"`
+
+	NNodeSamples         []int     `json:"n_node_samples"`
+	WeightedNNodeSamples []float64 `json:"weighted_n_node_samples"`
+
+	NFeatures    int      `json:"n_features"`
+	FeatureNames []string `json:"feature_names"`
+
+	// Classes lists the classes of a classification tree,
+	// sorted as by SortedValSplitKeys.
+	// It is nil for regression trees.
+	Classes []Class `json:"classes,omitempty"`
+}
+
+// Sklearn converts the tree to the layout of a
+// scikit-learn tree.
+//
+// The attributes, which must include the attribute of
+// every NumSplit in the tree, give the indices of the
+// features.
+// Thresholds on ordered categorical attributes (see
+// Builder.OrderedAttrs) are encoded as indices into the
+// attributes' orders.
+//
+// Multi-output trees are not supported, and surrogates
+// and missing values are not exported.
+func (t *Tree) Sklearn(attrs []Attr) (*SklearnTree, error) {
+	e := &sklearnExporter{
+		res:        &SklearnTree{},
+		features:   map[Attr]int{},
+		indicators: map[sklearnIndicator]int{},
+	}
+	for i, attr := range attrs {
+		if _, ok := e.features[attr]; ok {
+			return nil, fmt.Errorf("duplicate attribute: %v", attr)
+		}
+		e.features[attr] = i
+		e.res.FeatureNames = append(e.res.FeatureNames, fmt.Sprintf("%v", attr))
+	}
+
+	var multiOutput bool
+	classSet := map[Class]bool{}
+	var classes []Class
+	e.regression = true
+	t.visit(func(node *Tree) {
+		if node.Classifications != nil {
+			multiOutput = true
+		}
+		if !node.leaf() || node.Classification == nil {
+			return
+		}
+		e.regression = false
+		for class := range node.Classification {
+			if !classSet[class] {
+				classSet[class] = true
+				classes = append(classes, class)
+			}
+		}
+	})
+	if multiOutput {
+		return nil, errors.New("cannot export multi-output tree")
+	}
+	if !e.regression {
+		sort.SliceStable(classes, func(i, j int) bool {
+			return valueLess(classes[i], classes[j])
+		})
+		e.classIndices = map[Class]int{}
+		for i, class := range classes {
+			e.classIndices[class] = i
+		}
+		e.res.Classes = classes
+	}
+
+	if err := e.export(t); err != nil {
+		return nil, err
+	}
+	e.res.NodeCount = len(e.res.Feature)
+	e.res.NFeatures = len(e.res.FeatureNames)
+	return e.res, nil
+}
+
+// WriteSklearn writes the JSON encoding of the
+// SklearnTree for the tree.
+func (t *Tree) WriteSklearn(w io.Writer, attrs []Attr) error {
+	res, err := t.Sklearn(attrs)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(res)
+}
+
+type sklearnIndicator struct {
+	Attr Attr
+	Val  Val
+}
+
+type sklearnExporter struct {
+	res          *SklearnTree
+	features     map[Attr]int
+	indicators   map[sklearnIndicator]int
+	regression   bool
+	classIndices map[Class]int
+}
+
+func (s *sklearnExporter) export(t *Tree) error {
+	if t.leaf() {
+		s.addNode(t, t.SampleCount, t.Weight)
+		return nil
+	}
+	if t.ValSplit != nil {
+		keys := t.SortedValSplitKeys()
+		var other *Tree
+		for i, key := range keys {
+			if key == OtherValue {
+				other = t.ValSplit[key]
+				keys = append(keys[:i:i], keys[i+1:]...)
+				break
+			}
+		}
+		return s.exportCascade(t, keys, other)
+	}
+	if t.NumSplit.Thresholds != nil {
+		return s.export(binaryChain(t))
+	}
+
+	feature, ok := s.features[t.Attr]
+	if !ok {
+		return fmt.Errorf("unknown attribute: %v", t.Attr)
+	}
+	var threshold float64
+	if t.NumSplit.Order != nil {
+		idx := -1
+		for i, val := range t.NumSplit.Order {
+			if val == t.NumSplit.Threshold {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("threshold %v of attribute %v is not in its ordering",
+				t.NumSplit.Threshold, t.Attr)
+		}
+		threshold = float64(idx)
+	} else {
+		switch x := t.NumSplit.Threshold.(type) {
+		case int64:
+			threshold = float64(x)
+		case float64:
+			threshold = x
+		default:
+			return fmt.Errorf("unsupported threshold type: %T", x)
+		}
+	}
+	idx := s.addNode(t, t.SampleCount, t.Weight)
+	return s.addChildren(idx, feature, threshold, func() error {
+		return s.export(t.NumSplit.LessEqual)
+	}, func() error {
+		return s.export(t.NumSplit.Greater)
+	})
+}
+
+// exportCascade exports the branches of a ValSplit for
+// the given keys, followed by the other branch, which
+// may be nil.
+func (s *sklearnExporter) exportCascade(t *Tree, keys []Val, other *Tree) error {
+	if len(keys) == 0 {
+		if other != nil {
+			return s.export(other)
+		}
+		// Unseen values take every branch at once.
+		s.addNode(t, 0, 0)
+		return nil
+	}
+
+	// The node covers the remaining branches.
+	remaining := &Tree{Attr: t.Attr, ValSplit: ValSplit{}}
+	for _, key := range keys {
+		remaining.ValSplit[key] = t.ValSplit[key]
+	}
+	if other != nil {
+		remaining.ValSplit[OtherValue] = other
+	}
+	var sampleCount int
+	var weight float64
+	for _, child := range remaining.ValSplit {
+		sampleCount += child.SampleCount
+		weight += child.Weight
+	}
+
+	indicator := sklearnIndicator{Attr: t.Attr, Val: keys[0]}
+	feature, ok := s.indicators[indicator]
+	if !ok {
+		feature = len(s.res.FeatureNames)
+		s.indicators[indicator] = feature
+		s.res.FeatureNames = append(s.res.FeatureNames, fmt.Sprintf("%v=%v", t.Attr, keys[0]))
+	}
+	idx := s.addNode(remaining, sampleCount, weight)
+	return s.addChildren(idx, feature, 0.5, func() error {
+		return s.exportCascade(t, keys[1:], other)
+	}, func() error {
+		return s.export(t.ValSplit[keys[0]])
+	})
+}
+
+// addNode adds a leaf for the node, returning its index.
+func (s *sklearnExporter) addNode(t *Tree, sampleCount int, weight float64) int {
+	r := s.res
+	r.ChildrenLeft = append(r.ChildrenLeft, sklearnLeaf)
+	r.ChildrenRight = append(r.ChildrenRight, sklearnLeaf)
+	r.Feature = append(r.Feature, sklearnUndefined)
+	r.Threshold = append(r.Threshold, sklearnUndefined)
+	r.NNodeSamples = append(r.NNodeSamples, sampleCount)
+	r.WeightedNNodeSamples = append(r.WeightedNNodeSamples, weight)
+
+	var value []float64
+	if s.regression {
+		value = []float64{mergedValue(t)}
+	} else {
+		value = make([]float64, len(s.classIndices))
+		for class, prob := range mergedClassification(t) {
+			value[s.classIndices[class]] = prob
+		}
+	}
+	r.Value = append(r.Value, [][]float64{value})
+	return len(r.Feature) - 1
+}
+
+// addChildren turns a node into a split, exporting its
+// left and right subtrees in order.
+func (s *sklearnExporter) addChildren(idx, feature int, threshold float64,
+	left, right func() error) error {
+	s.res.Feature[idx] = feature
+	s.res.Threshold[idx] = threshold
+	s.res.ChildrenLeft[idx] = len(s.res.Feature)
+	if err := left(); err != nil {
+		return err
+	}
+	s.res.ChildrenRight[idx] = len(s.res.Feature)
+	return right()
+}
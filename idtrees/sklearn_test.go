@@ -0,0 +1,166 @@
+package idtrees
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestTreeSklearn(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(300, 2)
+	colors := []string{"red", "green", "blue", "cyan", "black"}
+	for i, s := range samples {
+		color := colors[rand.Intn(len(colors))]
+		s.(treeTestSample)["color"] = color
+		if color == "red" {
+			s.(treeTestSample)["class"] = "9"
+		} else if color == "blue" && i%3 == 0 {
+			s.(treeTestSample)["class"] = "8"
+		}
+	}
+	attrs := []Attr{0, 1, "color"}
+
+	for _, builder := range []*Builder{{MaxDepth: 4}, {MaxDepth: 4, MinCategoryCount: 55},
+		{MaxDepth: 4, Regression: true}} {
+		trainSamples := samples
+		if builder.Regression {
+			trainSamples = nil
+			for _, s := range samples {
+				target := treeTestSample{}
+				for _, attr := range attrs {
+					target[attr] = s.Attr(attr)
+				}
+				target["class"] = s.Attr(0).(float64) * 10
+				trainSamples = append(trainSamples, target)
+			}
+		}
+		tree := builder.Build(trainSamples, attrs)
+		res, err := tree.Sklearn(attrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSklearnTree(t, res)
+		if !builder.Regression && res.NFeatures == len(attrs) {
+			t.Errorf("builder %+v: expected indicator features", builder)
+		}
+
+		unseen := treeTestSample{0: 0.5, 1: int64(50), "color": "purple"}
+		for _, s := range append(trainSamples, unseen) {
+			value := sklearnPredict(res, attrs, s)
+			if builder.Regression {
+				if expected := tree.Predict(s); math.Abs(value[0]-expected) > 1e-8 {
+					t.Fatalf("expected %f but got %f", expected, value[0])
+				}
+				continue
+			}
+			expected := tree.Classify(s)
+			for i, class := range res.Classes {
+				if math.Abs(value[i]-expected[class]) > 1e-8 {
+					t.Fatalf("expected %v but got %v for classes %v", expected, value,
+						res.Classes)
+				}
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := tree.WriteSklearn(&buf, attrs); err != nil {
+			t.Fatal(err)
+		}
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"children_left", "children_right", "feature",
+			"threshold", "value"} {
+			if arr, ok := decoded[key].([]interface{}); !ok || len(arr) != res.NodeCount {
+				t.Errorf("bad JSON field %s", key)
+			}
+		}
+	}
+
+	tree := ID3(samples, attrs, 0)
+	if _, err := tree.Sklearn([]Attr{1, "color"}); err == nil {
+		t.Error("expected error for missing attribute")
+	}
+}
+
+// checkSklearnTree checks that every node but the root
+// has one parent which comes before it, and that leaves
+// have no children or features.
+func checkSklearnTree(t *testing.T, res *SklearnTree) {
+	n := res.NodeCount
+	for _, arr := range []int{len(res.ChildrenLeft), len(res.ChildrenRight),
+		len(res.Feature), len(res.Threshold), len(res.Value), len(res.NNodeSamples),
+		len(res.WeightedNNodeSamples)} {
+		if arr != n {
+			t.Fatalf("expected %d nodes but got an array of length %d", n, arr)
+		}
+	}
+	parents := make([]int, n)
+	for i := 0; i < n; i++ {
+		left, right := res.ChildrenLeft[i], res.ChildrenRight[i]
+		if left == sklearnLeaf || right == sklearnLeaf {
+			if left != right || res.Feature[i] != sklearnUndefined ||
+				res.Threshold[i] != sklearnUndefined {
+				t.Errorf("node %d: bad leaf", i)
+			}
+			continue
+		}
+		if res.Feature[i] < 0 || res.Feature[i] >= res.NFeatures {
+			t.Errorf("node %d: bad feature %d", i, res.Feature[i])
+		}
+		for _, child := range []int{left, right} {
+			if child <= i || child >= n {
+				t.Fatalf("node %d: bad child %d", i, child)
+			}
+			parents[child]++
+		}
+		if res.NNodeSamples[left]+res.NNodeSamples[right] != res.NNodeSamples[i] {
+			t.Errorf("node %d: sample counts do not add up", i)
+		}
+	}
+	for i, count := range parents {
+		if (i == 0 && count != 0) || (i > 0 && count != 1) {
+			t.Errorf("node %d has %d parents", i, count)
+		}
+	}
+	if len(res.FeatureNames) != res.NFeatures {
+		t.Errorf("expected %d feature names but got %d", res.NFeatures,
+			len(res.FeatureNames))
+	}
+}
+
+// sklearnPredict follows a SklearnTree the way that
+// scikit-learn would, encoding other attributes with
+// indicator features.
+func sklearnPredict(res *SklearnTree, attrs []Attr, s AttrMap) []float64 {
+	features := make([]float64, res.NFeatures)
+	for i, attr := range attrs {
+		switch x := s.Attr(attr).(type) {
+		case float64:
+			features[i] = x
+		case int64:
+			features[i] = float64(x)
+		}
+	}
+	for i := len(attrs); i < res.NFeatures; i++ {
+		name := res.FeatureNames[i]
+		for _, attr := range attrs {
+			if val, ok := s.Attr(attr).(string); ok && name == attr.(string)+"="+val {
+				features[i] = 1
+			}
+		}
+	}
+	node := 0
+	for res.ChildrenLeft[node] != sklearnLeaf {
+		if features[res.Feature[node]] <= res.Threshold[node] {
+			node = res.ChildrenLeft[node]
+		} else {
+			node = res.ChildrenRight[node]
+		}
+	}
+	return res.Value[node][0]
+}
@@ -0,0 +1,57 @@
+package idtrees
+
+// Depth returns the depth of the tree, as defined by
+// LimitedID3.
+// A leaf has depth 0.
+func (t *Tree) Depth() int {
+	type entry struct {
+		node  *Tree
+		depth int
+	}
+	var maxDepth int
+	nodes := []entry{{t, 0}}
+	for len(nodes) > 0 {
+		e := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+		if e.depth > maxDepth {
+			maxDepth = e.depth
+		}
+		for _, child := range e.node.children() {
+			nodes = append(nodes, entry{child, e.depth + 1})
+		}
+	}
+	return maxDepth
+}
+
+// NumNodes returns the total number of nodes in the
+// tree, including leaves.
+func (t *Tree) NumNodes() int {
+	var count int
+	t.visit(func(*Tree) {
+		count++
+	})
+	return count
+}
+
+// NumLeaves returns the number of leaves in the tree.
+func (t *Tree) NumLeaves() int {
+	var count int
+	t.visit(func(node *Tree) {
+		if node.leaf() {
+			count++
+		}
+	})
+	return count
+}
+
+// visit calls f for every node in the tree, without
+// using recursion.
+func (t *Tree) visit(f func(node *Tree)) {
+	nodes := []*Tree{t}
+	for len(nodes) > 0 {
+		node := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+		f(node)
+		nodes = append(nodes, node.children()...)
+	}
+}
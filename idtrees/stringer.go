@@ -3,56 +3,289 @@ package idtrees
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 // String returns a human-readable representation of
 // the tree, using indentation to signify depth.
+//
+// The format is similar to that of scikit-learn's
+// export_text, with lines like "|--- age <= 10" for
+// numerical branches, "|--- color == red" for
+// categorical branches, and "|--- class=X p=0.82" (or
+// "|--- value=3.5" for regression trees) for leaves.
+// Leaves of multi-output trees list one distribution per
+// output, separated by semicolons.
 func (t *Tree) String() string {
-	if t.Classification != nil {
-		return classificationString(t.Classification)
+	type stringNode struct {
+		Tree   *Tree
+		Depth  int
+		Header string
 	}
 
 	var buf bytes.Buffer
+	writeLine := func(depth int, text string) {
+		if buf.Len() > 0 {
+			buf.WriteRune('\n')
+		}
+		buf.WriteString(strings.Repeat("|   ", depth))
+		buf.WriteString("|--- ")
+		buf.WriteString(text)
+	}
 
-	buf.WriteString(fmt.Sprintf("%v", t.Attr))
-	buf.WriteRune('\n')
+	stack := []stringNode{{Tree: t}}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
 
-	split := t.ValSplit
+		depth := node.Depth
+		if node.Header != "" {
+			writeLine(depth, node.Header)
+			depth++
+		}
 
-	if t.NumSplit != nil {
-		lessKey := fmt.Sprintf("<= %v", t.NumSplit.Threshold)
-		greaterKey := fmt.Sprintf("> %v", t.NumSplit.Threshold)
-		split = ValSplit{
-			lessKey:    t.NumSplit.LessEqual,
-			greaterKey: t.NumSplit.Greater,
+		tree := node.Tree
+		if tree.Classification != nil {
+			writeLine(depth, leafString(tree.Classification))
+			continue
+		} else if tree.Classifications != nil {
+			writeLine(depth, outputsString(tree.Classifications, leafString, "; "))
+			continue
+		} else if tree.leaf() {
+			writeLine(depth, "value="+valueString(tree.Value))
+			continue
 		}
-	}
 
-	isFirst := true
-	for value, subtree := range split {
-		if !isFirst {
-			buf.WriteRune('\n')
+		attr := fmt.Sprintf("%v", tree.Attr)
+		var children []stringNode
+		if tree.NumSplit != nil {
+			tests := tree.NumSplit.branchTests(attr)
+			for i, child := range tree.NumSplit.branches() {
+				children = append(children, stringNode{child, depth, tests[i]})
+			}
+		} else {
+			for _, val := range tree.SortedValSplitKeys() {
+				children = append(children, stringNode{tree.ValSplit[val], depth,
+					attr + " == " + valueString(val)})
+			}
+		}
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, children[i])
 		}
-		isFirst = false
-		var subBuf bytes.Buffer
-		subBuf.WriteRune(' ')
-		subBuf.WriteString(fmt.Sprintf("%v", value))
-		subBuf.WriteString(" -> ")
-		subBuf.WriteString(subtree.String())
-		buf.WriteString(strings.Replace(subBuf.String(), "\n", "\n  ", -1))
 	}
 
 	return buf.String()
 }
 
+// Rules flattens the tree into one IF-THEN rule per
+// leaf, in the same order as the leaves of String.
+//
+// Each rule joins the tests along the path to its leaf
+// with AND, and names the most likely class of the leaf,
+// as in "IF age <= 40 AND color == red THEN class=buy
+// (p=0.91)".
+// Regression leaves give rules like "THEN value=3.5",
+// and the rule for a tree with no splits is
+// "IF true THEN ...".
+func (t *Tree) Rules() []string {
+	var res []string
+	var visit func(t *Tree, conditions []string)
+	visit = func(t *Tree, conditions []string) {
+		if t.leaf() {
+			condition := "true"
+			if len(conditions) > 0 {
+				condition = strings.Join(conditions, " AND ")
+			}
+			res = append(res, "IF "+condition+" THEN "+ruleConclusion(t))
+			return
+		}
+		attr := fmt.Sprintf("%v", t.Attr)
+		// Copy the conditions so that siblings do not share
+		// the same backing array.
+		branch := func(child *Tree, condition string) {
+			visit(child, append(append([]string{}, conditions...), condition))
+		}
+		if t.NumSplit != nil {
+			tests := t.NumSplit.branchTests(attr)
+			for i, child := range t.NumSplit.branches() {
+				branch(child, tests[i])
+			}
+			return
+		}
+		for _, val := range t.SortedValSplitKeys() {
+			branch(t.ValSplit[val], attr+" == "+valueString(val))
+		}
+	}
+	visit(t, nil)
+	return res
+}
+
+func ruleConclusion(t *Tree) string {
+	if t.Classification == nil && t.Classifications == nil {
+		return "value=" + valueString(t.Value)
+	}
+	dists := t.Classifications
+	if t.Classification != nil {
+		dists = []map[Class]float64{t.Classification}
+	}
+	parts := make([]string, len(dists))
+	for i, dist := range dists {
+		if class, ok := topClass(dist); ok {
+			parts[i] = fmt.Sprintf("class=%v (p=%.2f)", class, dist[class])
+		} else {
+			parts[i] = "unreachable"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// outputsString joins the strings for the distributions
+// of the outputs of a multi-output leaf.
+func outputsString(dists []map[Class]float64, f func(map[Class]float64) string,
+	sep string) string {
+	parts := make([]string, len(dists))
+	for i, dist := range dists {
+		parts[i] = f(dist)
+	}
+	return strings.Join(parts, sep)
+}
+
+func leafString(m map[Class]float64) string {
+	if len(m) == 0 {
+		return "unreachable"
+	}
+	classes := make([]Class, 0, len(m))
+	for class := range m {
+		classes = append(classes, class)
+	}
+	sort.SliceStable(classes, func(i, j int) bool {
+		if m[classes[i]] != m[classes[j]] {
+			return m[classes[i]] > m[classes[j]]
+		}
+		return fmt.Sprintf("%v", classes[i]) < fmt.Sprintf("%v", classes[j])
+	})
+	parts := make([]string, len(classes))
+	for i, class := range classes {
+		parts[i] = fmt.Sprintf("%v p=%.2f", class, m[class])
+	}
+	return "class=" + strings.Join(parts, ", ")
+}
+
+func valueString(v Val) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'g', 6, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// SortedValSplitKeys returns the values of the node's
+// ValSplit in a deterministic order, which is used by
+// String, Rules, WriteDOT, and the encodings of the tree.
+// String, WriteDOT, and MarshalJSON also list the classes
+// of distributions and the branches of surrogates in
+// this order.
+//
+// Values are grouped by type, with bools first, then
+// numbers, then strings, then all other types ordered by
+// their type names.
+// Within each group, numbers are sorted in ascending
+// order, bools and strings in the usual order, and other
+// values by their string representations.
+func (t *Tree) SortedValSplitKeys() []Val {
+	return sortedValues(t.ValSplit)
+}
+
+func sortedValues(v ValSplit) []Val {
+	res := make([]Val, 0, len(v))
+	for val := range v {
+		res = append(res, val)
+	}
+	sortByValue(res)
+	return res
+}
+
+// sortedClasses returns the classes of a distribution in
+// the same order as SortedValSplitKeys, so that exports
+// do not depend on the order of map iteration.
+func sortedClasses(m map[Class]float64) []Class {
+	res := make([]Class, 0, len(m))
+	for class := range m {
+		res = append(res, class)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return valueLess(res[i], res[j])
+	})
+	return res
+}
+
+// sortByValue sorts values in place using valueLess.
+func sortByValue(vals []Val) {
+	sort.SliceStable(vals, func(i, j int) bool {
+		return valueLess(vals[i], vals[j])
+	})
+}
+
+// valueLess defines the order used by SortedValSplitKeys.
+func valueLess(v1, v2 Val) bool {
+	r1, r2 := valueRank(v1), valueRank(v2)
+	if r1 != r2 {
+		return r1 < r2
+	}
+	switch r1 {
+	case 0:
+		return !v1.(bool) && v2.(bool)
+	case 1:
+		i1, ok1 := numericValue(v1).(int64)
+		i2, ok2 := numericValue(v2).(int64)
+		if ok1 && ok2 {
+			return i1 < i2
+		}
+		f1, f2 := float64(i1), float64(i2)
+		if !ok1 {
+			f1 = floatValue(v1)
+		}
+		if !ok2 {
+			f2 = floatValue(v2)
+		}
+		if f1 != f2 {
+			return f1 < f2
+		}
+		// Equal ints and floats are ordered by type.
+		return ok1 && !ok2
+	case 2:
+		return v1.(string) < v2.(string)
+	}
+	t1, t2 := fmt.Sprintf("%T", v1), fmt.Sprintf("%T", v2)
+	if t1 != t2 {
+		return t1 < t2
+	}
+	return fmt.Sprintf("%v", v1) < fmt.Sprintf("%v", v2)
+}
+
+// valueRank identifies the group of a value for
+// valueLess.
+func valueRank(v Val) int {
+	switch v.(type) {
+	case bool:
+		return 0
+	case int64, int, int8, int16, int32, uint, uint8, uint16, uint32, uint64,
+		float64, float32:
+		return 1
+	case string:
+		return 2
+	}
+	return 3
+}
+
 func classificationString(m map[Class]float64) string {
 	if len(m) == 0 {
 		return "Unreachable"
 	}
 	var parts []string
-	for key, frac := range m {
-		parts = append(parts, fmt.Sprintf("%v=%.02f%%", key, frac*100))
+	for _, key := range sortedClasses(m) {
+		parts = append(parts, fmt.Sprintf("%v=%.02f%%", key, m[key]*100))
 	}
 	return strings.Join(parts, " ")
 }
@@ -0,0 +1,337 @@
+package idtrees
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A Surrogate is a split on a different attribute which
+// mimics the split of a node.
+// When a sample is missing the attribute of a node, the
+// node's surrogates are tried in order, and the first
+// one which can route the sample picks its branch.
+//
+// Branches are identified by keys: the key of a ValSplit
+// branch is its value, while the keys of the LessEqual
+// and Greater branches of a NumSplit are false and true,
+// respectively.
+type Surrogate struct {
+	Attr Attr
+
+	// Threshold is non-nil for a numerical surrogate, in
+	// which case samples whose values are less than or
+	// equal to Threshold take the LessEqual branch, and
+	// the other samples take the Greater branch.
+	Threshold Val
+	LessEqual Val
+	Greater   Val
+
+	// Branches is used by a categorical surrogate, and it
+	// maps values of the attribute to branch keys.
+	Branches map[Val]Val
+
+	// Agreement is the weighted fraction of the training
+	// samples for which the surrogate chose the same branch
+	// as the node's split.
+	Agreement float64
+
+	// MissingValue, if non-nil, is a value of Attr which
+	// is treated as missing, as with Tree.MissingValue.
+	MissingValue Val
+}
+
+// branch returns the branch key for a value of the
+// surrogate's attribute, or nil if the surrogate cannot
+// route the value.
+func (s *Surrogate) branch(val Val) Val {
+	if val == nil {
+		return nil
+	}
+	if s.Threshold != nil {
+		if numericGreater(val, s.Threshold) {
+			return s.Greater
+		}
+		return s.LessEqual
+	}
+	return s.Branches[val]
+}
+
+// route is like child, but it falls back on the node's
+// surrogates if the sample is missing the attribute.
+func (t *Tree) route(s AttrMap) *Tree {
+	val := t.value(s)
+	if val != nil {
+		return t.child(val)
+	}
+	for i := range t.Surrogates {
+		surrogate := &t.Surrogates[i]
+		key := surrogate.branch(missingValue(s.Attr(surrogate.Attr),
+			surrogate.MissingValue))
+		if key == nil {
+			continue
+		}
+		if t.NumSplit != nil {
+			if greater, ok := key.(bool); ok {
+				if greater {
+					return t.NumSplit.Greater
+				}
+				return t.NumSplit.LessEqual
+			}
+		} else if child := t.ValSplit[key]; child != nil {
+			return child
+		}
+	}
+	return nil
+}
+
+// surrogates finds the best surrogates for the split of
+// a node, sorted from most to least agreement.
+//
+// Only surrogates which agree with the split more often
+// than sending every sample down the heaviest branch are
+// kept.
+func (b *id3Builder) surrogates(node *nodeSamples, attrs []Attr,
+	split *potentialSplit) []Surrogate {
+	if b.MaxSurrogates == 0 || split.Thresholds != nil {
+		return nil
+	}
+
+	keys := split.branchKeys(node.Samples)
+	branchWeights := map[Val]float64{}
+	var totalWeight float64
+	for _, s := range node.Samples {
+		if key, ok := keys[sampleIndex(s)]; ok {
+			branchWeights[key] += sampleWeight(s)
+			totalWeight += sampleWeight(s)
+		}
+	}
+	if totalWeight <= 0 {
+		return nil
+	}
+	var baseline float64
+	for _, w := range branchWeights {
+		baseline = maxFloat(baseline, w)
+	}
+
+	var res []Surrogate
+	for _, attr := range attrs {
+		if attr == split.Attr {
+			continue
+		}
+		var surrogate *Surrogate
+		if sorted, ok := node.Sorted[attr]; ok {
+			surrogate = numericSurrogate(sorted, attr, keys)
+		} else if b.bins[attr] != nil {
+			if known, _ := splitMissing(node.Samples, attr); len(known) > 0 {
+				surrogate = numericSurrogate(sortNumeric(known, attr), attr, keys)
+			}
+		} else {
+			surrogate = categoricalSurrogate(node.Samples, attr, keys)
+		}
+		if surrogate != nil && surrogate.Agreement > baseline {
+			surrogate.Agreement /= totalWeight
+			res = append(res, *surrogate)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Agreement != res[j].Agreement {
+			return res[i].Agreement > res[j].Agreement
+		}
+		return fmt.Sprintf("%v", res[i].Attr) < fmt.Sprintf("%v", res[j].Attr)
+	})
+	if len(res) > b.MaxSurrogates {
+		res = res[:b.MaxSurrogates]
+	}
+	return res
+}
+
+// branchKeys maps the index of every sample which has a
+// value for the split's attribute to the key of the
+// branch it takes.
+func (p *potentialSplit) branchKeys(samples []Sample) map[int]Val {
+	node := &Tree{Attr: p.Attr}
+	if p.Threshold != nil {
+		node.NumSplit = &NumSplit{
+			Threshold: p.Threshold,
+			Order:     p.Order,
+			LessEqual: &Tree{},
+			Greater:   &Tree{},
+		}
+	}
+	res := map[int]Val{}
+	for _, s := range samples {
+		val := s.Attr(p.Attr)
+		if val == nil {
+			continue
+		}
+		if node.NumSplit != nil {
+			res[sampleIndex(s)] = node.child(val) == node.NumSplit.Greater
+		} else if _, ok := p.ValSplitSamples[val]; ok {
+			res[sampleIndex(s)] = val
+		} else if _, ok := p.ValSplitSamples[OtherValue]; ok {
+			res[sampleIndex(s)] = OtherValue
+		}
+	}
+	return res
+}
+
+// numericSurrogate finds the threshold on a numerical
+// attribute which best agrees with the branch keys,
+// given the samples sorted by the attribute.
+//
+// The Agreement of the result is the total weight of the
+// samples for which it agrees with the keys.
+func numericSurrogate(sorted []Sample, attr Attr, keys map[int]Val) *Surrogate {
+	var samples []Sample
+	rightWeights := map[Val]float64{}
+	for _, s := range sorted {
+		if key, ok := keys[sampleIndex(s)]; ok {
+			samples = append(samples, s)
+			rightWeights[key] += sampleWeight(s)
+		}
+	}
+	if len(samples) < 2 {
+		return nil
+	}
+	var branchKeys []Val
+	for key := range rightWeights {
+		branchKeys = append(branchKeys, key)
+	}
+	sortVals(branchKeys)
+
+	leftWeights := map[Val]float64{}
+	var best *Surrogate
+	for i := 1; i < len(samples); i++ {
+		prev := samples[i-1]
+		w := sampleWeight(prev)
+		key := keys[sampleIndex(prev)]
+		leftWeights[key] += w
+		rightWeights[key] -= w
+
+		lastVal, val := prev.Attr(attr), samples[i].Attr(attr)
+		if !numericGreater(val, numericValue(lastVal)) {
+			continue
+		}
+		leftKey, leftWeight := heaviestKey(branchKeys, leftWeights)
+		rightKey, rightWeight := heaviestKey(branchKeys, rightWeights)
+		if best == nil || leftWeight+rightWeight > best.Agreement {
+			best = &Surrogate{
+				Attr:      attr,
+				Threshold: numericThreshold(lastVal, val),
+				LessEqual: leftKey,
+				Greater:   rightKey,
+				Agreement: leftWeight + rightWeight,
+			}
+		}
+	}
+	return best
+}
+
+// categoricalSurrogate maps each value of a categorical
+// attribute to the branch key which it most often
+// appears with.
+//
+// As with numericSurrogate, the Agreement of the result
+// is a total weight rather than a fraction.
+func categoricalSurrogate(samples []Sample, attr Attr, keys map[int]Val) *Surrogate {
+	valWeights := map[Val]map[Val]float64{}
+	var vals, branchKeys []Val
+	seenKeys := map[Val]bool{}
+	for _, s := range samples {
+		key, ok := keys[sampleIndex(s)]
+		val := s.Attr(attr)
+		if !ok || val == nil {
+			continue
+		}
+		if valWeights[val] == nil {
+			valWeights[val] = map[Val]float64{}
+			vals = append(vals, val)
+		}
+		valWeights[val][key] += sampleWeight(s)
+		if !seenKeys[key] {
+			seenKeys[key] = true
+			branchKeys = append(branchKeys, key)
+		}
+	}
+	if len(valWeights) < 2 {
+		return nil
+	}
+	sortVals(vals)
+	sortVals(branchKeys)
+
+	res := &Surrogate{Attr: attr, Branches: map[Val]Val{}}
+	for _, val := range vals {
+		key, weight := heaviestKey(branchKeys, valWeights[val])
+		res.Branches[val] = key
+		res.Agreement += weight
+	}
+	return res
+}
+
+// heaviestKey returns the key with the largest weight,
+// preferring earlier keys in the case of ties.
+func heaviestKey(keys []Val, weights map[Val]float64) (Val, float64) {
+	var bestKey Val
+	var bestWeight float64
+	for _, key := range keys {
+		if bestKey == nil || weights[key] > bestWeight {
+			bestKey = key
+			bestWeight = weights[key]
+		}
+	}
+	return bestKey, bestWeight
+}
+
+// numericThreshold returns the midpoint of two numerical
+// values as an int64 or a float64 threshold.
+func numericThreshold(low, high Val) Val {
+	switch low.(type) {
+	case int64, int, int8, int16, int32, uint, uint8, uint16, uint32, uint64:
+		return intMidpoint(intValue(low), intValue(high))
+	default:
+		return floatMidpoint(floatValue(low), floatValue(high))
+	}
+}
+
+// intMidpoint computes floor((low+high)/2) without
+// overflowing.
+// If low < high, the result r satisfies low <= r < high,
+// so a threshold of r separates the two values.
+func intMidpoint(low, high int64) int64 {
+	return (low & high) + (low^high)>>1
+}
+
+// floatMidpoint computes a threshold r between two values
+// such that low <= r < high.
+// The midpoint is used unless it rounds to high, as
+// happens for adjacent floats, in which case low is used.
+func floatMidpoint(low, high float64) float64 {
+	mid := low + (high-low)/2
+	if math.IsInf(high-low, 0) {
+		mid = low/2 + high/2
+	}
+	if !(mid >= low && mid < high) {
+		return low
+	}
+	return mid
+}
+
+// numericValue converts a numerical value to an int64 or
+// a float64.
+func numericValue(val Val) Val {
+	switch val.(type) {
+	case int64, int, int8, int16, int32, uint, uint8, uint16, uint32, uint64:
+		return intValue(val)
+	default:
+		return floatValue(val)
+	}
+}
+
+func maxFloat(x, y float64) float64 {
+	if x > y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,119 @@
+package idtrees
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func TestSurrogates(t *testing.T) {
+	rng := rand.New(rand.NewSource(1337))
+	var samples []Sample
+	for i := 0; i < 200; i++ {
+		x := rng.Float64()
+		// The noisy copy of x and the size are both good,
+		// but imperfect, surrogates for x.
+		noisy := x + rng.NormFloat64()*0.1
+		size := "small"
+		if x > 0.5 {
+			size = "big"
+		}
+		if rng.Intn(10) == 0 {
+			size = "medium"
+		}
+		samples = append(samples, treeTestSample{
+			"x":     x,
+			"noisy": noisy,
+			"size":  size,
+			"class": x > 0.5,
+		})
+	}
+	attrs := []Attr{"x", "noisy", "size"}
+
+	b := &Builder{MaxSurrogates: 2, MaxDepth: 1}
+	tree := b.Build(samples, attrs)
+	if tree.Attr != "x" {
+		t.Fatalf("unexpected split attribute: %v", tree.Attr)
+	}
+	if len(tree.Surrogates) != 2 {
+		t.Fatalf("expected 2 surrogates but got %d", len(tree.Surrogates))
+	}
+	first, second := tree.Surrogates[0], tree.Surrogates[1]
+	if first.Agreement < second.Agreement || second.Agreement < 0.8 {
+		t.Errorf("bad agreements: %f, %f", first.Agreement, second.Agreement)
+	}
+
+	tests := []struct {
+		Sample   treeTestSample
+		Expected bool
+	}{
+		{treeTestSample{"noisy": 0.9, "size": "big"}, true},
+		{treeTestSample{"noisy": 0.05, "size": "small"}, false},
+		{treeTestSample{"size": "big"}, true},
+		{treeTestSample{"size": "small"}, false},
+		{treeTestSample{"noisy": 1.2}, true},
+	}
+	for i, test := range tests {
+		if class := tree.ClassifyOne(test.Sample); class != test.Expected {
+			t.Errorf("test %d: expected %v but got %v", i, test.Expected, class)
+		}
+	}
+
+	if len(ID3(samples, attrs, 0).Surrogates) != 0 {
+		t.Error("surrogates should be disabled by default")
+	}
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded *Tree
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !treesEqual(tree, decoded) {
+		t.Error("tree changed after JSON round trip")
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(tree); err != nil {
+		t.Fatal(err)
+	}
+	decoded = nil
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !treesEqual(tree, decoded) {
+		t.Error("tree changed after gob round trip")
+	}
+}
+
+func TestCategoricalSurrogates(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 30; i++ {
+		color := []string{"red", "green", "blue"}[i%3]
+		// The shade is dark for red and blue samples, but
+		// light for green ones.
+		shade := "dark"
+		if color == "green" {
+			shade = "light"
+		}
+		samples = append(samples, treeTestSample{
+			"color": color,
+			"shade": shade,
+			"class": color == "green",
+		})
+	}
+	b := &Builder{MaxSurrogates: 1}
+	tree := b.Build(samples, []Attr{"color", "shade"})
+	if tree.Attr != "color" && tree.Attr != "shade" {
+		t.Fatalf("unexpected split attribute: %v", tree.Attr)
+	}
+	for _, s := range []treeTestSample{{"shade": "light"}, {"color": "green"}} {
+		if tree.ClassifyOne(s) != true {
+			t.Errorf("bad classification for %v: %v", s, tree.Classify(s))
+		}
+	}
+}
@@ -1,6 +1,18 @@
 package idtrees
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
 
 type treeTestSample map[Attr]Val
 
@@ -16,6 +28,9 @@ type treeTest struct {
 	Samples  []Sample
 	Attrs    []Attr
 	Expected *Tree
+
+	// Builder, if non-nil, is used instead of ID3.
+	Builder *Builder
 }
 
 func (t *treeTest) Run(test *testing.T, prefix string) {
@@ -29,6 +44,11 @@ func (t *treeTest) Run(test *testing.T, prefix string) {
 }
 
 func (t *treeTest) actual(maxGos int) *Tree {
+	if t.Builder != nil {
+		b := *t.Builder
+		b.MaxGos = maxGos
+		return b.Build(t.Samples, t.Attrs)
+	}
 	return ID3(t.Samples, t.Attrs, maxGos)
 }
 
@@ -48,9 +68,29 @@ func treesEqual(t1, t2 *Tree) bool {
 		return true
 	}
 
-	if t1.Attr != t2.Attr {
+	if t1.Attr != t2.Attr || t1.Value != t2.Value || t1.MissingValue != t2.MissingValue {
+		return false
+	}
+
+	if len(t1.Surrogates) != 0 || len(t2.Surrogates) != 0 {
+		if !reflect.DeepEqual(t1.Surrogates, t2.Surrogates) {
+			return false
+		}
+	}
+
+	if len(t1.Classifications) != len(t2.Classifications) {
 		return false
 	}
+	for i, dist := range t1.Classifications {
+		if len(dist) != len(t2.Classifications[i]) {
+			return false
+		}
+		for k, v := range dist {
+			if t2.Classifications[i][k] != v {
+				return false
+			}
+		}
+	}
 
 	if t1.NumSplit != nil {
 		if t2.NumSplit == nil {
@@ -59,13 +99,43 @@ func treesEqual(t1, t2 *Tree) bool {
 		if t1.NumSplit.Threshold != t2.NumSplit.Threshold {
 			return false
 		}
-		return treesEqual(t1.NumSplit.Greater, t2.NumSplit.Greater) &&
-			treesEqual(t1.NumSplit.LessEqual, t2.NumSplit.LessEqual)
+		if len(t1.NumSplit.Order) != len(t2.NumSplit.Order) {
+			return false
+		}
+		for i, val := range t1.NumSplit.Order {
+			if t2.NumSplit.Order[i] != val {
+				return false
+			}
+		}
+		if len(t1.NumSplit.Thresholds) != len(t2.NumSplit.Thresholds) {
+			return false
+		}
+		for i, val := range t1.NumSplit.Thresholds {
+			if t2.NumSplit.Thresholds[i] != val {
+				return false
+			}
+		}
+		b1, b2 := t1.NumSplit.branches(), t2.NumSplit.branches()
+		if len(b1) != len(b2) {
+			return false
+		}
+		for i, child := range b1 {
+			if !treesEqual(child, b2[i]) {
+				return false
+			}
+		}
+		return true
 	}
 
 	if len(t1.ValSplit) != len(t2.ValSplit) {
 		return false
 	}
+
+	// Expected trees only give a Fallback when the test
+	// checks it.
+	if t1.Fallback != nil && (t2.Fallback == nil || !distributionsEqual(t1.Fallback, t2.Fallback)) {
+		return false
+	}
 	for val, tree := range t1.ValSplit {
 		tree2 := t2.ValSplit[val]
 		if tree2 == nil {
@@ -78,3 +148,847 @@ func treesEqual(t1, t2 *Tree) bool {
 
 	return true
 }
+
+// leafCounts routes samples through a tree and counts
+// how many samples reach each leaf.
+func leafCounts(t *Tree, samples []Sample) map[*Tree]int {
+	res := map[*Tree]int{}
+	for _, s := range samples {
+		node := t
+		for !node.leaf() {
+			node = node.child(s.Attr(node.Attr))
+		}
+		res[node]++
+	}
+	return res
+}
+
+func TestTreeKind(t *testing.T) {
+	leaf := &Tree{Classification: map[Class]float64{"a": 1}}
+	regression := &Tree{Value: 3}
+	categorical := &Tree{Attr: "color", ValSplit: ValSplit{"red": leaf}}
+	numeric := &Tree{
+		Attr: "x",
+		NumSplit: &NumSplit{
+			Threshold: 1.5,
+			LessEqual: categorical,
+			Greater:   regression,
+		},
+	}
+	expected := map[*Tree]NodeKind{
+		leaf:        Leaf,
+		regression:  Leaf,
+		categorical: Categorical,
+		numeric:     Numeric,
+	}
+	for node, kind := range expected {
+		if actual := node.Kind(); actual != kind {
+			t.Errorf("%s: expected kind %d but got %d", node, kind, actual)
+		}
+	}
+}
+
+func TestTreeSortedValSplitKeys(t *testing.T) {
+	expected := []Val{false, true, int64(-3), 2.5, int64(9), 10, "a", "b",
+		gobTestClass{"x"}}
+	tree := &Tree{Attr: "key", ValSplit: ValSplit{}}
+	for i, val := range expected {
+		tree.ValSplit[val] = &Tree{Classification: map[Class]float64{i: 1}}
+	}
+	dot := tree.DOT()
+	for i := 0; i < 10; i++ {
+		keys := tree.SortedValSplitKeys()
+		if !reflect.DeepEqual(keys, expected) {
+			t.Fatalf("expected %v but got %v", expected, keys)
+		}
+		if tree.DOT() != dot {
+			t.Fatal("DOT output changed between calls")
+		}
+	}
+}
+
+func TestTreeStableExports(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(300, 2)
+	for i, s := range samples {
+		s.(treeTestSample)["color"] = []string{"red", "green", "blue", "cyan"}[i%4]
+		if i%5 == 0 {
+			s.(treeTestSample)[0] = nil
+		}
+	}
+	tree := (&Builder{MaxDepth: 2, MaxSurrogates: 2}).Build(samples,
+		[]Attr{0, 1, "color"})
+	var multiClass bool
+	tree.visit(func(node *Tree) {
+		if len(node.Classification) > 2 {
+			multiClass = true
+		}
+	})
+	if !multiClass {
+		t.Fatal("expected a leaf with several classes")
+	}
+
+	dot, str := tree.DOT(), tree.String()
+	jsonData, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if tree.DOT() != dot {
+			t.Fatal("DOT output changed between calls")
+		}
+		if tree.String() != str {
+			t.Fatal("String output changed between calls")
+		}
+		data, err := json.Marshal(tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, jsonData) {
+			t.Fatal("JSON output changed between calls")
+		}
+	}
+}
+
+func TestTreeClassify(t *testing.T) {
+	samples := []Sample{
+		treeTestSample{"color": "red", "size": 1.0, "class": "apple"},
+		treeTestSample{"color": "red", "size": 1.5, "class": "apple"},
+		treeTestSample{"color": "red", "size": 9.0, "class": "melon"},
+		treeTestSample{"color": "green", "size": 8.0, "class": "melon"},
+		treeTestSample{"color": "green", "size": 7.0, "class": "melon"},
+		treeTestSample{"color": "yellow", "size": 2.0, "class": "banana"},
+	}
+	tree := ID3(samples, []Attr{"color", "size"}, 1)
+	for _, s := range samples {
+		if p := tree.Classify(s)[s.Class()]; p < 0.99 {
+			t.Errorf("sample %v has probability %f", s, p)
+		}
+	}
+}
+
+func TestTreeClassifyBatch(t *testing.T) {
+	rand.Seed(1337)
+	var samples []Sample
+	for i := 0; i < 500; i++ {
+		s := treeTestSample{"x": rand.Float64(), "color": rand.Intn(4),
+			"class": rand.Intn(3)}
+		if i%7 == 0 {
+			s["color"] = nil
+		}
+		samples = append(samples, s)
+	}
+	tree := LimitedID3(samples[:300], []Attr{"x", "color"}, 0, 4)
+	for _, maxGos := range []int{0, 1, 3} {
+		batch := tree.ClassifyBatch(samples, maxGos)
+		if len(batch) != len(samples) {
+			t.Fatalf("expected %d results but got %d", len(samples), len(batch))
+		}
+		for i, s := range samples {
+			expected := tree.Classify(s)
+			if len(batch[i]) != len(expected) {
+				t.Fatalf("sample %d: expected %v but got %v", i, expected, batch[i])
+			}
+			for class, prob := range expected {
+				if batch[i][class] != prob {
+					t.Fatalf("sample %d: expected %v but got %v", i, expected, batch[i])
+				}
+			}
+		}
+	}
+}
+
+func TestTreeClassifyUnseenValue(t *testing.T) {
+	tree := &Tree{
+		Attr: "color",
+		ValSplit: ValSplit{
+			"red": &Tree{
+				Classification: map[Class]float64{"apple": 1},
+				Weight:         3,
+			},
+			"yellow": &Tree{
+				Classification: map[Class]float64{"banana": 0.5, "lemon": 0.5},
+				Weight:         1,
+			},
+		},
+		Weight: 4,
+	}
+	actual := tree.Classify(treeTestSample{"color": "purple"})
+	expected := map[Class]float64{"apple": 0.75, "banana": 0.125, "lemon": 0.125}
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+	for class, prob := range expected {
+		if actual[class] != prob {
+			t.Errorf("expected %v but got %v", expected, actual)
+		}
+	}
+}
+
+func TestTreeClassifyUnseenCategory(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 60; i++ {
+		color := []string{"red", "green", "yellow"}[i%3]
+		class := map[string]string{"red": "apple", "green": "pear", "yellow": "banana"}[color]
+		if i%5 == 0 {
+			class = "lemon"
+		}
+		samples = append(samples, treeTestSample{
+			"color": color,
+			"size":  float64(i % 7),
+			"class": class,
+		})
+	}
+	tree := ID3(samples, []Attr{"color", "size"}, 1)
+	if tree.ValSplit == nil || tree.Depth() < 2 {
+		t.Fatalf("expected a deep categorical split:\n%s", tree)
+	}
+	expected := createLeaf(samples).Classification
+	if !distributionsEqual(tree.Fallback, expected) {
+		t.Fatalf("expected fallback %v but got %v", expected, tree.Fallback)
+	}
+	bestFirst := (&Builder{MaxLeafNodes: 4}).Build(samples, []Attr{"color", "size"})
+	if bestFirst.ValSplit == nil || !distributionsEqual(bestFirst.Fallback, expected) {
+		t.Errorf("expected best-first fallback %v but got %v", expected, bestFirst.Fallback)
+	}
+	unseen := treeTestSample{"color": "purple", "size": 3.0}
+	actual := tree.Classify(unseen)
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+	for class, prob := range expected {
+		if math.Abs(actual[class]-prob) > 1e-8 {
+			t.Errorf("expected %v but got %v", expected, actual)
+		}
+	}
+
+	// The stored fallback is used as is, rather than being
+	// rebuilt from the branches.
+	tree.Fallback = map[Class]float64{"lemon": 1}
+	if class := tree.ClassifyOne(unseen); class != "lemon" {
+		t.Errorf("expected stored fallback but got %v", tree.Classify(unseen))
+	}
+	if _, c := tree.ClassifyPath(unseen); c["lemon"] != 1 {
+		t.Errorf("expected stored fallback from ClassifyPath but got %v", c)
+	}
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Tree
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !treesEqual(tree, &decoded) {
+		t.Error("fallback changed after binary round trip")
+	}
+	data, err = json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded = Tree{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !treesEqual(tree, &decoded) {
+		t.Error("fallback changed after JSON round trip")
+	}
+	data, err = tree.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded = Tree{}
+	if err := decoded.GobDecode(data); err != nil {
+		t.Fatal(err)
+	}
+	if !treesEqual(tree, &decoded) {
+		t.Error("fallback changed after gob round trip")
+	}
+
+	var targets []Sample
+	var mean float64
+	for i, s := range samples {
+		target := float64(i % 4)
+		mean += target / float64(len(samples))
+		s := s.(treeTestSample)
+		targets = append(targets, treeTestSample{"color": s["color"], "class": target})
+	}
+	regression := RegressionTree(targets, []Attr{"color"}, 1)
+	if regression.Fallback != nil {
+		t.Errorf("unexpected regression fallback %v", regression.Fallback)
+	}
+	if pred := regression.Predict(treeTestSample{"color": "purple"}); math.Abs(pred-mean) > 1e-8 {
+		t.Errorf("expected prediction %f but got %f", mean, pred)
+	}
+}
+
+func TestTreeClassifyOne(t *testing.T) {
+	samples := []Sample{
+		treeTestSample{"x": 1.0, "class": "a"},
+		treeTestSample{"x": 1.0, "class": "a"},
+		treeTestSample{"x": 1.0, "class": "b"},
+		treeTestSample{"x": 2.0, "class": "c"},
+		treeTestSample{"x": 2.0, "class": "b"},
+	}
+	tree := ID3(samples, []Attr{"x"}, 1)
+	if class := tree.ClassifyOne(treeTestSample{"x": 1.0}); class != "a" {
+		t.Errorf("expected a but got %v", class)
+	}
+	for i := 0; i < 10; i++ {
+		if class := tree.ClassifyOne(treeTestSample{"x": 2.0}); class != "b" {
+			t.Errorf("expected tie to be broken as b but got %v", class)
+		}
+	}
+	if class := (&Tree{Classification: map[Class]float64{}}).ClassifyOne(nil); class != nil {
+		t.Errorf("expected nil but got %v", class)
+	}
+}
+
+func TestTreeClassifyWithCost(t *testing.T) {
+	tree := &Tree{Classification: map[Class]float64{"healthy": 0.7, "sick": 0.3}}
+	if class := tree.ClassifyWithCost(nil, nil); class != "healthy" {
+		t.Errorf("expected healthy but got %v", class)
+	}
+
+	// Missing a sick patient is ten times worse than a
+	// false alarm.
+	costs := map[[2]Class]float64{
+		{"healthy", "sick"}: 10,
+		{"sick", "healthy"}: 1,
+	}
+	if class := tree.ClassifyWithCost(nil, costs); class != "sick" {
+		t.Errorf("expected sick but got %v", class)
+	}
+
+	// A class which is not in the distribution may be the
+	// cheapest prediction.
+	costs[[2]Class{"retest", "healthy"}] = 0.2
+	costs[[2]Class{"retest", "sick"}] = 0.2
+	if class := tree.ClassifyWithCost(nil, costs); class != "retest" {
+		t.Errorf("expected retest but got %v", class)
+	}
+
+	if class := (&Tree{Classification: map[Class]float64{}}).ClassifyWithCost(nil,
+		costs); class != nil {
+		t.Errorf("expected nil but got %v", class)
+	}
+}
+
+func TestTreeMargin(t *testing.T) {
+	tree := &Tree{
+		Attr: "x",
+		ValSplit: ValSplit{
+			"pure":   &Tree{Classification: map[Class]float64{"a": 1}},
+			"even":   &Tree{Classification: map[Class]float64{"a": 0.5, "b": 0.5}},
+			"skewed": &Tree{Classification: map[Class]float64{"a": 0.2, "b": 0.7, "c": 0.1}},
+			"empty":  &Tree{Classification: map[Class]float64{}},
+		},
+	}
+	expected := map[string]float64{"pure": 1, "even": 0, "skewed": 0.5, "empty": 0}
+	for val, margin := range expected {
+		if actual := tree.Margin(treeTestSample{"x": val}); math.Abs(actual-margin) > 1e-8 {
+			t.Errorf("%s: expected margin %f but got %f", val, margin, actual)
+		}
+	}
+}
+
+func TestTreeDOT(t *testing.T) {
+	tree := &Tree{
+		Attr: "color",
+		ValSplit: ValSplit{
+			"red": &Tree{
+				Attr: "size",
+				NumSplit: &NumSplit{
+					Threshold: 1.5,
+					LessEqual: &Tree{Classification: map[Class]float64{"apple": 1}},
+					Greater:   &Tree{Classification: map[Class]float64{"melon": 1}},
+				},
+			},
+			`"quoted"`: &Tree{Classification: map[Class]float64{}},
+		},
+	}
+	dot := tree.DOT()
+	if !strings.HasPrefix(dot, "digraph tree {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Fatalf("bad DOT output: %s", dot)
+	}
+	if strings.Count(dot, "{") != strings.Count(dot, "}") {
+		t.Errorf("unbalanced braces: %s", dot)
+	}
+	nodeExpr := regexp.MustCompile(`^  (n[0-9]+) \[label=".*", shape=(box|ellipse)\];$`)
+	edgeExpr := regexp.MustCompile(`^  (n[0-9]+) -> (n[0-9]+) \[label="(.*)"\];$`)
+	nodes := map[string]bool{}
+	var edges [][]string
+	var edgeLabels []string
+	lines := strings.Split(strings.TrimSpace(dot), "\n")
+	for _, line := range lines[1 : len(lines)-1] {
+		if match := nodeExpr.FindStringSubmatch(line); match != nil {
+			if nodes[match[1]] {
+				t.Errorf("duplicate node: %s", match[1])
+			}
+			nodes[match[1]] = true
+		} else if match := edgeExpr.FindStringSubmatch(line); match != nil {
+			edges = append(edges, match[1:3])
+			edgeLabels = append(edgeLabels, match[3])
+		} else {
+			t.Errorf("unexpected line: %s", line)
+		}
+	}
+	if len(nodes) != 5 || len(edges) != 4 {
+		t.Errorf("expected 5 nodes and 4 edges but got %d and %d", len(nodes), len(edges))
+	}
+	for _, edge := range edges {
+		if !nodes[edge[0]] || !nodes[edge[1]] {
+			t.Errorf("edge refers to missing node: %v", edge)
+		}
+	}
+	sort.Strings(edgeLabels)
+	expectedLabels := []string{"<=", `== \"quoted\"`, "== red", ">"}
+	if !reflect.DeepEqual(edgeLabels, expectedLabels) {
+		t.Errorf("expected edge labels %v but got %v", expectedLabels, edgeLabels)
+	}
+}
+
+func TestTreeString(t *testing.T) {
+	tree := &Tree{
+		Attr: "height",
+		NumSplit: &NumSplit{
+			Threshold: (3.0 + 4.3) / 2.0,
+			LessEqual: &Tree{Classification: map[Class]float64{"child": 1}},
+			Greater: &Tree{
+				Attr: "drinks",
+				ValSplit: ValSplit{
+					false: &Tree{Classification: map[Class]float64{"teenager": 1}},
+					true: &Tree{
+						Attr: "age",
+						NumSplit: &NumSplit{
+							Threshold: int64(20),
+							LessEqual: &Tree{
+								Classification: map[Class]float64{
+									"teenager": 0.25, "adult": 0.75,
+								},
+							},
+							Greater: &Tree{Classification: map[Class]float64{}},
+						},
+					},
+				},
+			},
+		},
+	}
+	expected, err := ioutil.ReadFile("testdata/tree_string.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := tree.String() + "\n"; actual != string(expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestTreeRules(t *testing.T) {
+	tree := &Tree{
+		Attr: "age",
+		NumSplit: &NumSplit{
+			Threshold: 40.5,
+			LessEqual: &Tree{
+				Attr: "color",
+				ValSplit: ValSplit{
+					"red":  &Tree{Classification: map[Class]float64{"buy": 0.91, "skip": 0.09}},
+					"blue": &Tree{Classification: map[Class]float64{"skip": 1}},
+				},
+			},
+			Greater: &Tree{Classification: map[Class]float64{}},
+		},
+	}
+	expected := []string{
+		"IF age <= 40.5 AND color == blue THEN class=skip (p=1.00)",
+		"IF age <= 40.5 AND color == red THEN class=buy (p=0.91)",
+		"IF age > 40.5 THEN unreachable",
+	}
+	if actual := tree.Rules(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q but got %q", expected, actual)
+	}
+	if len(expected) != tree.NumLeaves() {
+		t.Errorf("expected one rule per leaf")
+	}
+
+	regression := &Tree{
+		Attr: "x",
+		NumSplit: &NumSplit{
+			Threshold: int64(3),
+			LessEqual: &Tree{Value: 1.5},
+			Greater:   &Tree{Value: 2},
+		},
+	}
+	expected = []string{"IF x <= 3 THEN value=1.5", "IF x > 3 THEN value=2"}
+	if actual := regression.Rules(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q but got %q", expected, actual)
+	}
+
+	leaf := &Tree{Classification: map[Class]float64{"a": 1}}
+	expected = []string{"IF true THEN class=a (p=1.00)"}
+	if actual := leaf.Rules(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q but got %q", expected, actual)
+	}
+}
+
+func TestTreeFeatureImportances(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 40; i++ {
+		samples = append(samples, treeTestSample{
+			"signal": i%2 == 0,
+			"noise":  int64((i * 7) % 5),
+			"class":  i%2 == 0 && i%3 != 0,
+		})
+	}
+	tree := ID3(samples, []Attr{"signal", "noise"}, 1)
+	importances := tree.FeatureImportances(samples)
+
+	var sum float64
+	for _, x := range importances {
+		sum += x
+	}
+	if math.Abs(sum-1) > 1e-8 {
+		t.Errorf("importances sum to %f", sum)
+	}
+	if importances["signal"] <= importances["noise"] {
+		t.Errorf("expected signal to dominate: %v", importances)
+	}
+
+	var separable []Sample
+	for i := 0; i < 20; i++ {
+		separable = append(separable, treeTestSample{"x": int64(i), "y": int64(i % 3),
+			"class": i < 10})
+	}
+	tree = ID3(separable, []Attr{"x", "y"}, 1)
+	importances = tree.FeatureImportances(separable)
+	if importances["x"] != 1 {
+		t.Errorf("expected x to have all the importance: %v", importances)
+	}
+
+	// Samples which a split cannot route do not count
+	// towards its decrease in entropy.
+	tree = &Tree{
+		Attr: "x",
+		ValSplit: ValSplit{
+			"a": {Classification: map[Class]float64{"p": 1}, Weight: 1},
+			"b": {
+				Attr: "y",
+				NumSplit: &NumSplit{
+					Threshold: 0.5,
+					LessEqual: &Tree{Classification: map[Class]float64{"p": 1}, Weight: 1},
+					Greater:   &Tree{Classification: map[Class]float64{"q": 1}, Weight: 1},
+				},
+				Weight: 2,
+			},
+		},
+		Weight: 3,
+	}
+	var routable []Sample
+	for i := 0; i < 10; i++ {
+		routable = append(routable,
+			treeTestSample{"x": "a", "y": 0.0, "class": "p"},
+			treeTestSample{"x": "b", "y": 0.0, "class": "p"},
+			treeTestSample{"x": "b", "y": 1.0, "class": "q"})
+	}
+	missing := append([]Sample{}, routable...)
+	for i := 0; i < 20; i++ {
+		missing = append(missing, treeTestSample{"y": float64(i % 2),
+			"class": []string{"p", "q"}[i%2]})
+	}
+	expected := tree.FeatureImportances(routable)
+	actual := tree.FeatureImportances(missing)
+	for _, attr := range []Attr{"x", "y"} {
+		if math.Abs(actual[attr]-expected[attr]) > 1e-8 {
+			t.Errorf("expected importances %v but got %v", expected, actual)
+			break
+		}
+	}
+}
+
+func TestPermutationImportance(t *testing.T) {
+	rand.Seed(1337)
+	makeSamples := func(n int) []Sample {
+		var res []Sample
+		for i := 0; i < n; i++ {
+			x := rand.Float64()
+			class := x > 0.5
+			if rand.Intn(10) == 0 {
+				class = !class
+			}
+			res = append(res, treeTestSample{"x": x, "noise": rand.Float64(), "class": class})
+		}
+		return res
+	}
+	tree := LimitedID3(makeSamples(500), []Attr{"x", "noise"}, 1, 4)
+	test := makeSamples(500)
+	rng := rand.New(rand.NewSource(42))
+	if imp := PermutationImportance(tree, test, "x", 5, rng); imp < 0.3 {
+		t.Errorf("expected a large importance for x but got %f", imp)
+	}
+	if imp := PermutationImportance(tree, test, "noise", 5, rng); math.Abs(imp) > 0.03 {
+		t.Errorf("expected a near-zero importance for noise but got %f", imp)
+	}
+	if imp := PermutationImportance(tree, test, "missing", 5, rng); imp != 0 {
+		t.Errorf("expected zero importance for an unused attribute but got %f", imp)
+	}
+}
+
+func TestRankAttributes(t *testing.T) {
+	rand.Seed(1337)
+	var samples []Sample
+	for i := 0; i < 200; i++ {
+		x := rand.Float64()
+		samples = append(samples, treeTestSample{
+			"x":     x,
+			"noise": rand.Intn(4),
+			"color": []string{"red", "green"}[rand.Intn(2)],
+			"class": x > 0.3,
+		})
+	}
+	scores := RankAttributes(samples, []Attr{"noise", "color", "x"})
+	if len(scores) != 3 {
+		t.Fatalf("expected 3 scores but got %d", len(scores))
+	}
+	if scores[0].Attr != "x" {
+		t.Fatalf("expected x to rank first: %v", scores)
+	}
+	rootEntropy := newEntropyCounter(samples).Entropy()
+	if math.Abs(scores[0].Gain-rootEntropy) > 1e-8 {
+		t.Errorf("expected gain %f but got %f", rootEntropy, scores[0].Gain)
+	}
+	if th := scores[0].Threshold.(float64); th < 0.25 || th > 0.35 {
+		t.Errorf("unexpected threshold %f", th)
+	}
+	for _, score := range scores[1:] {
+		if (score.Threshold == nil) != (score.Attr == "color") {
+			t.Errorf("unexpected threshold for %v: %v", score.Attr, score.Threshold)
+		}
+		if score.Gain < 0 || score.Gain >= scores[0].Gain {
+			t.Errorf("unexpected gain for %v: %f", score.Attr, score.Gain)
+		}
+	}
+}
+
+func TestTreeEqual(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(300, 4)
+	for _, s := range samples {
+		s.(treeTestSample)["color"] = []string{"red", "green", "blue"}[rand.Intn(3)]
+	}
+	tree := (&Builder{MaxSurrogates: 2}).Build(samples, []Attr{0, 1, 2, 3, "color"})
+	if !tree.Equal(tree) || !tree.Equal(copyTree(tree)) {
+		t.Fatal("tree does not equal its copy")
+	}
+	if tree.Equal(nil) || (*Tree)(nil).Equal(tree) || !(*Tree)(nil).Equal(nil) {
+		t.Error("bad comparison with nil")
+	}
+
+	var numSplits []*Tree
+	copied := copyTree(tree)
+	copied.visit(func(node *Tree) {
+		if node.NumSplit != nil {
+			if _, ok := node.NumSplit.Threshold.(float64); ok {
+				numSplits = append(numSplits, node)
+			}
+		}
+	})
+	if len(numSplits) == 0 {
+		t.Fatal("no float thresholds")
+	}
+	split := numSplits[len(numSplits)-1].NumSplit
+	threshold := split.Threshold.(float64)
+
+	split.Threshold = threshold * (1 + 1e-12)
+	if !tree.Equal(copied) {
+		t.Error("tiny threshold change should be tolerated")
+	}
+	split.Threshold = threshold + 0.01
+	if tree.Equal(copied) || copied.Equal(tree) {
+		t.Error("trees with different thresholds are equal")
+	}
+	split.Threshold = int64(threshold)
+	if tree.Equal(copied) {
+		t.Error("int64 threshold equals float64 threshold")
+	}
+	split.Threshold = threshold
+
+	leaf := split.Greater
+	for leaf.NumSplit != nil || leaf.ValSplit != nil {
+		leaf = leaf.children()[0]
+	}
+	for class, prob := range leaf.Classification {
+		leaf.Classification[class] = prob + 1e-12
+	}
+	if !tree.Equal(copied) {
+		t.Error("tiny probability change should be tolerated")
+	}
+	leaf.Classification["unseen"] = 0.1
+	if tree.Equal(copied) {
+		t.Error("trees with different distributions are equal")
+	}
+	leaf.Classification["unseen"] = 0
+	if !tree.Equal(copied) || !copied.Equal(tree) {
+		t.Error("zero-probability class should be ignored")
+	}
+
+	copied.Attr = "other"
+	if tree.Equal(copied) {
+		t.Error("trees with different attributes are equal")
+	}
+}
+
+func TestTreeStats(t *testing.T) {
+	leaf := func() *Tree {
+		return &Tree{Classification: map[Class]float64{"x": 1}}
+	}
+	tree := &Tree{
+		Attr: "a",
+		ValSplit: ValSplit{
+			"red": leaf(),
+			"green": &Tree{
+				Attr: "b",
+				NumSplit: &NumSplit{
+					Threshold: 3.0,
+					LessEqual: leaf(),
+					Greater: &Tree{
+						Attr: "c",
+						NumSplit: &NumSplit{
+							Threshold: int64(1),
+							LessEqual: leaf(),
+							Greater:   leaf(),
+						},
+					},
+				},
+			},
+			"blue": leaf(),
+		},
+	}
+	if d := tree.Depth(); d != 3 {
+		t.Errorf("expected depth 3 but got %d", d)
+	}
+	if n := tree.NumNodes(); n != 8 {
+		t.Errorf("expected 8 nodes but got %d", n)
+	}
+	if n := tree.NumLeaves(); n != 5 {
+		t.Errorf("expected 5 leaves but got %d", n)
+	}
+
+	l := leaf()
+	if l.Depth() != 0 || l.NumNodes() != 1 || l.NumLeaves() != 1 {
+		t.Errorf("unexpected leaf stats: %d %d %d", l.Depth(), l.NumNodes(), l.NumLeaves())
+	}
+}
+
+func TestTreeClassifyDepth(t *testing.T) {
+	rand.Seed(1337)
+	samples := forestTestSamples()
+	tree := ID3(samples, []Attr{0, 1, 2, 3}, 1)
+	depth := tree.Depth()
+	if depth < 2 {
+		t.Fatalf("tree is too shallow: depth %d", depth)
+	}
+
+	expectedRoot := map[Class]float64{}
+	for _, s := range samples {
+		expectedRoot[s.Class()] += 1 / float64(len(samples))
+	}
+	for i, s := range samples {
+		if actual := tree.ClassifyDepth(s, depth); !reflect.DeepEqual(actual, tree.Classify(s)) {
+			t.Fatalf("sample %d: full depth gave %v but Classify gave %v", i, actual,
+				tree.Classify(s))
+		}
+		root := tree.ClassifyDepth(s, 0)
+		for class, prob := range expectedRoot {
+			if math.Abs(root[class]-prob) > 1e-8 {
+				t.Fatalf("sample %d: depth 0 gave %v but expected %v", i, root, expectedRoot)
+			}
+		}
+	}
+
+	leaf := func(class Class, weight float64) *Tree {
+		return &Tree{Weight: weight, Classification: map[Class]float64{class: 1}}
+	}
+	small := &Tree{
+		Attr: "a",
+		NumSplit: &NumSplit{
+			Threshold: 0.5,
+			LessEqual: leaf("x", 1),
+			Greater: &Tree{
+				Attr:   "b",
+				Weight: 3,
+				NumSplit: &NumSplit{
+					Threshold: 0.5,
+					LessEqual: leaf("x", 1),
+					Greater:   leaf("y", 2),
+				},
+			},
+		},
+	}
+	s := treeTestSample{"a": 1.0, "b": 1.0}
+	expected := []map[Class]float64{
+		{"x": 0.5, "y": 0.5},
+		{"x": 1.0 / 3, "y": 2.0 / 3},
+		{"y": 1},
+	}
+	for maxDepth, dist := range expected {
+		actual := small.ClassifyDepth(s, maxDepth)
+		for _, class := range []Class{"x", "y"} {
+			if math.Abs(actual[class]-dist[class]) > 1e-8 {
+				t.Errorf("depth %d: expected %v but got %v", maxDepth, dist, actual)
+				break
+			}
+		}
+	}
+}
+
+func TestTreeConcurrentReads(t *testing.T) {
+	rand.Seed(1337)
+	samples := presortTestSamples(500, 4)
+	for i, s := range samples {
+		s.(treeTestSample)["color"] = []string{"red", "green", "blue"}[rand.Intn(3)]
+		if i%7 == 0 {
+			s.(treeTestSample)[0] = nil
+		}
+	}
+	attrs := []Attr{0, 1, 2, 3, "color"}
+	tree := (&Builder{MaxSurrogates: 2, MaxDepth: 6}).Build(samples, attrs)
+	testSamples := append(samples, treeTestSample{1: int64(50), "color": "purple"})
+
+	expected := make([]map[Class]float64, len(testSamples))
+	for i, s := range testSamples {
+		expected[i] = tree.Classify(s)
+	}
+	expectedString := tree.String()
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j, s := range testSamples {
+				if !reflect.DeepEqual(tree.Classify(s), expected[j]) {
+					errs <- "unexpected classification"
+					return
+				}
+				tree.ClassifyOne(s)
+				tree.ClassifyPath(s)
+				tree.ClassifyDepth(s, i%5)
+				tree.Margin(s)
+			}
+			if tree.String() != expectedString {
+				errs <- "unexpected string"
+				return
+			}
+			tree.Rules()
+			tree.FeatureImportances(samples)
+			if _, err := tree.MarshalBinary(); err != nil {
+				errs <- err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
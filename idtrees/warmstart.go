@@ -0,0 +1,79 @@
+package idtrees
+
+// ID3WarmStart is like ID3, but it reuses the splits of
+// an existing tree rather than training from scratch.
+// See Builder.WarmStart for details.
+func ID3WarmStart(old *Tree, samples []Sample, attrs []Attr, maxGos int) *Tree {
+	b := &Builder{MaxGos: maxGos}
+	return b.WarmStart(old, samples, attrs)
+}
+
+// WarmStart updates an existing tree for a new training
+// set, which typically contains the samples that old was
+// trained on plus some new ones.
+//
+// The splits of old are kept as they are, and the samples
+// are routed through them to the leaves of old.
+// Every leaf which some samples reach is replaced by a
+// tree trained on those samples, so leaves whose samples
+// can now be split are grown into subtrees, while the
+// other leaves are refreshed with the new class
+// distributions.
+// MaxDepth limits the depth of the result, counting the
+// splits of old.
+// Leaves which no samples reach, and samples which old
+// cannot route, are left alone.
+//
+// The old tree is not modified.
+func (b *Builder) WarmStart(old *Tree, samples []Sample, attrs []Attr) *Tree {
+	return b.warmStart(old, samples, attrs, 0)
+}
+
+func (b *Builder) warmStart(t *Tree, samples []Sample, attrs []Attr, depth int) *Tree {
+	if len(samples) == 0 {
+		return copyTree(t)
+	}
+	if t.leaf() {
+		maxDepth := b.maxDepth()
+		if maxDepth >= 0 {
+			maxDepth -= depth
+			if maxDepth < 0 {
+				maxDepth = 0
+			}
+		}
+		return b.build(nil, samples, attrs, maxDepth)
+	}
+
+	branchSamples := map[*Tree][]Sample{}
+	for _, s := range samples {
+		if child := t.route(s); child != nil {
+			branchSamples[child] = append(branchSamples[child], s)
+		}
+	}
+	grow := func(child *Tree) *Tree {
+		return b.warmStart(child, branchSamples[child], attrs, depth+1)
+	}
+
+	res := &Tree{Attr: t.Attr, Gain: t.Gain, Surrogates: t.Surrogates,
+		MissingValue: t.MissingValue}
+	if t.NumSplit != nil {
+		var branches []*Tree
+		for _, child := range t.NumSplit.branches() {
+			branches = append(branches, grow(child))
+		}
+		res.NumSplit = t.NumSplit.withBranches(branches)
+	} else {
+		res.ValSplit = ValSplit{}
+		for val, child := range t.ValSplit {
+			res.ValSplit[val] = grow(child)
+		}
+	}
+	for _, child := range res.children() {
+		res.Weight += child.Weight
+		res.SampleCount += child.SampleCount
+	}
+	if t.Fallback != nil {
+		res.Fallback = mergedClassification(res)
+	}
+	return res
+}
@@ -0,0 +1,42 @@
+package idtrees
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestID3WarmStart(t *testing.T) {
+	rand.Seed(1337)
+	samples := forestTestSamples()
+	attrs := []Attr{0, 1, 2, 3}
+	train, test := samples[:600], samples[600:]
+	old := LimitedID3(train[:100], attrs, 1, 2)
+	oldCopy := copyTree(old)
+
+	b := &Builder{MaxDepth: 6}
+	warm := b.WarmStart(old, train, attrs)
+	if !old.Equal(oldCopy) {
+		t.Error("old tree was modified")
+	}
+	if warm.Attr != old.Attr || !valsEqual(warm.NumSplit.Threshold, old.NumSplit.Threshold) {
+		t.Errorf("root split changed from %v to %v", old, warm)
+	}
+	if warm.SampleCount != len(train) {
+		t.Errorf("expected %d samples but got %d", len(train), warm.SampleCount)
+	}
+	if warm.NumLeaves() <= old.NumLeaves() {
+		t.Error("no leaves were grown")
+	}
+	if d := warm.Depth(); d > 6 {
+		t.Errorf("depth %d exceeds the limit", d)
+	}
+	oldErrors, warmErrors := treeErrors(old, test), treeErrors(warm, test)
+	if warmErrors > oldErrors {
+		t.Errorf("warm start has %d errors, but the old tree has %d", warmErrors, oldErrors)
+	}
+
+	if !treesEqual(ID3WarmStart(&Tree{Classification: map[Class]float64{}}, train, attrs, 1),
+		ID3(train, attrs, 1)) {
+		t.Error("warm starting from a leaf should train from scratch")
+	}
+}